@@ -6,8 +6,11 @@ import (
 	"github.com/vbehar/openshift-git/pkg/cmd"
 
 	// init all the commands
+	_ "github.com/vbehar/openshift-git/pkg/cmd/decrypt"
 	_ "github.com/vbehar/openshift-git/pkg/cmd/export"
 	_ "github.com/vbehar/openshift-git/pkg/cmd/importer"
+	_ "github.com/vbehar/openshift-git/pkg/cmd/migrate"
+	_ "github.com/vbehar/openshift-git/pkg/cmd/verify"
 )
 
 func main() {
@@ -0,0 +1,313 @@
+package audit
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	// maxPendingRequests is the maximum number of requests waiting for a response
+	// that we keep track of
+	maxPendingRequests = 10000
+
+	// creationsRetention is how long the creations of resources are kept,
+	// waiting for the watch events of the created resources
+	creationsRetention = 5 * time.Minute
+
+	// creationTolerance is the tolerance when matching the creation timestamp of a resource
+	// (with a precision of a second) with the time at which a creation request has been read
+	creationTolerance = 2 * time.Second
+)
+
+// Log represents an OpenShift audit log, that is tailed to keep track
+// of the last user who modified (or created) each resource.
+type Log struct {
+	// Path is the path of the audit log file
+	Path string
+
+	// PollPeriod is the interval of time at which the file is checked for new lines
+	PollPeriod time.Duration
+
+	// readLock protects offset and readAt: the file is read by a single goroutine at a time
+	readLock sync.Mutex
+
+	// offset is the offset in the file of the next line to read (or -1 before the first read)
+	offset int64
+
+	// readAt is the time at which the file has been read for the last time
+	readAt time.Time
+
+	lock sync.RWMutex
+
+	// users is the name of the last user who modified a resource, indexed by resource key
+	users map[string]string
+
+	// creations are the recent creation requests (POST) on the lists of resources,
+	// indexed by list key (see resourceKey, without name)
+	creations map[string][]creation
+
+	// pending are the write requests that have not yet received a response, indexed by request ID
+	pending map[string]pendingRequest
+}
+
+// pendingRequest represents a write request that has not yet received a response
+type pendingRequest struct {
+	// key is the key of the modified resource (or of the list, for a creation)
+	key string
+
+	// previousUser is the user who modified the resource before this request
+	previousUser string
+
+	// creation is true for a creation request
+	creation bool
+}
+
+// creation represents a creation request (POST) on a list of resources:
+// the name of the created resource is not in the audit log
+type creation struct {
+	// id is the ID of the request
+	id string
+
+	// user is the user who made the request
+	user string
+
+	// readAt is the time at which the request has been read
+	readAt time.Time
+}
+
+// NewLog instantiates a new Log for the audit log file at the given path
+func NewLog(path string) *Log {
+	return &Log{
+		Path:       path,
+		PollPeriod: 1 * time.Second,
+		offset:     -1,
+		users:      map[string]string{},
+		creations:  map[string][]creation{},
+		pending:    map[string]pendingRequest{},
+	}
+}
+
+// RunUntil tails the audit log in a goroutine
+// until stopChan is closed.
+// Only the lines written after it has been started are read.
+func (l *Log) RunUntil(stopChan <-chan struct{}) {
+	l.read()
+	go func() {
+		ticker := time.NewTicker(l.PollPeriod)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stopChan:
+				return
+			case <-ticker.C:
+				l.read()
+			}
+		}
+	}()
+}
+
+// CatchUp reads the new lines of the audit log, unless it has already been read
+// after the given time - so that the requests logged before a watch event
+// (received at the given time) are known, without waiting for the next poll.
+func (l *Log) CatchUp(t time.Time) {
+	l.readLock.Lock()
+	readAt := l.readAt
+	l.readLock.Unlock()
+
+	if readAt.Before(t) {
+		l.read()
+	}
+}
+
+// UserFor returns the name of the last user who modified the resource
+// of the given type (in its plural form, like "buildconfigs"), namespace and name.
+func (l *Log) UserFor(resource, namespace, name string) (string, bool) {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	user, found := l.users[resourceKey(resource, namespace, name)]
+	return user, found
+}
+
+// CreatorFor returns the name of the user who created the resource
+// of the given type (in its plural form, like "buildconfigs") and namespace,
+// at the given time (its creation timestamp).
+// The name of the created resource is not in the audit log, so the user is only returned
+// if all the creations of resources of this type in this namespace around that time
+// have been made by the same user.
+func (l *Log) CreatorFor(resource, namespace string, createdAt time.Time) (string, bool) {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	// the creation timestamp is truncated to the second,
+	// and the request is read up to a poll period after it has been made
+	from := createdAt.Add(-creationTolerance)
+	to := createdAt.Add(creationTolerance + l.PollPeriod)
+
+	var user string
+	for _, c := range l.creations[resourceKey(resource, namespace, "")] {
+		if c.readAt.Before(from) || c.readAt.After(to) {
+			continue
+		}
+		if len(user) > 0 && user != c.user {
+			// created by several users at the same time
+			return "", false
+		}
+		user = c.user
+	}
+	return user, len(user) > 0
+}
+
+// read reads and processes all the complete lines written in the file
+// since the last read.
+// The first time, it just skips the current content of the file.
+func (l *Log) read() {
+	l.readLock.Lock()
+	defer l.readLock.Unlock()
+
+	now := time.Now()
+	l.offset = l.readFrom(l.offset, now)
+	l.readAt = now
+}
+
+// readFrom reads and processes all the complete lines written in the file
+// after the given offset, and returns the new offset.
+// If the given offset is negative, it just returns the current size of the file.
+func (l *Log) readFrom(offset int64, now time.Time) int64 {
+	file, err := os.Open(l.Path)
+	if err != nil {
+		glog.V(3).Infof("Failed to open audit log %s: %v", l.Path, err)
+		return offset
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		glog.V(3).Infof("Failed to stat audit log %s: %v", l.Path, err)
+		return offset
+	}
+	if offset < 0 {
+		return info.Size()
+	}
+	if info.Size() < offset {
+		glog.V(2).Infof("Audit log %s has been truncated, reading it from the start", l.Path)
+		offset = 0
+	}
+
+	if _, err := file.Seek(offset, os.SEEK_SET); err != nil {
+		glog.V(3).Infof("Failed to seek audit log %s: %v", l.Path, err)
+		return offset
+	}
+
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if err != io.EOF {
+				glog.V(3).Infof("Failed to read audit log %s: %v", l.Path, err)
+			}
+			// incomplete lines will be read again next time
+			return offset
+		}
+		offset += int64(len(line))
+		l.process(line, now)
+	}
+}
+
+// process processes a single line of the audit log, read at the given time
+func (l *Log) process(line string, now time.Time) {
+	fields := ParseLine(line)
+	if fields == nil {
+		return
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	id := fields["id"]
+	if response, found := fields["response"]; found {
+		if pending, found := l.pending[id]; found {
+			delete(l.pending, id)
+			if !strings.HasPrefix(response, "2") {
+				// the request failed, so the resource has not been modified
+				l.revert(id, pending)
+			}
+		}
+		return
+	}
+
+	switch fields["method"] {
+	case "POST", "PUT", "PATCH", "DELETE":
+	default:
+		return
+	}
+
+	resource, namespace, name := ParseURI(fields["uri"])
+	if len(resource) == 0 {
+		return
+	}
+
+	user := fields["user"]
+	if as := fields["as"]; len(as) > 0 && as != "<self>" {
+		user = as
+	}
+
+	if len(l.pending) >= maxPendingRequests {
+		// the responses are not logged, no need to keep track of the requests
+		l.pending = map[string]pendingRequest{}
+	}
+
+	key := resourceKey(resource, namespace, name)
+	switch {
+	case fields["method"] == "POST" && len(name) == 0:
+		l.pending[id] = pendingRequest{key: key, creation: true}
+		l.recordCreation(key, creation{id: id, user: user, readAt: now})
+	case len(name) > 0:
+		l.pending[id] = pendingRequest{key: key, previousUser: l.users[key]}
+		l.users[key] = user
+	}
+}
+
+// recordCreation records the given creation on the list with the given key,
+// and forgets the old creations
+func (l *Log) recordCreation(key string, c creation) {
+	creations := []creation{}
+	for _, previous := range l.creations[key] {
+		if c.readAt.Sub(previous.readAt) < creationsRetention {
+			creations = append(creations, previous)
+		}
+	}
+	l.creations[key] = append(creations, c)
+}
+
+// revert reverts the changes recorded for the given (failed) request
+func (l *Log) revert(id string, pending pendingRequest) {
+	if pending.creation {
+		creations := []creation{}
+		for _, c := range l.creations[pending.key] {
+			if c.id != id {
+				creations = append(creations, c)
+			}
+		}
+		l.creations[pending.key] = creations
+		return
+	}
+
+	if len(pending.previousUser) > 0 {
+		l.users[pending.key] = pending.previousUser
+	} else {
+		delete(l.users, pending.key)
+	}
+}
+
+// resourceKey returns the key for the given resource type, namespace and name
+func resourceKey(resource, namespace, name string) string {
+	return strings.Join([]string{resource, namespace, name}, "/")
+}
@@ -0,0 +1,93 @@
+package audit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLogAttribution(t *testing.T) {
+	dir, err := ioutil.TempDir("", "openshift-git-audit-")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "audit.log")
+	if err := ioutil.WriteFile(path, []byte(`AUDIT: id="0" method="PUT" user="old" as="<self>" uri="/oapi/v1/namespaces/demo/buildconfigs/old"`+"\n"), 0600); err != nil {
+		t.Fatalf("Failed to write audit log: %v", err)
+	}
+
+	l := NewLog(path)
+	l.PollPeriod = time.Hour
+	stopChan := make(chan struct{})
+	defer close(stopChan)
+	l.RunUntil(stopChan)
+
+	lines := []string{
+		`AUDIT: id="1" method="POST" user="alice" as="<self>" uri="/oapi/v1/namespaces/demo/buildconfigs"`,
+		`AUDIT: id="1" response="201"`,
+		`AUDIT: id="2" method="POST" user="bob" as="<self>" uri="/api/v1/namespaces/demo/secrets"`,
+		`AUDIT: id="2" response="409"`,
+		`AUDIT: id="3" method="PATCH" user="carol" as="system:admin" uri="/apis/extensions/v1beta1/namespaces/demo/jobs/job"`,
+		`AUDIT: id="3" response="200"`,
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatalf("Failed to open audit log: %v", err)
+	}
+	for _, line := range lines {
+		file.WriteString(line + "\n")
+	}
+	file.Close()
+
+	now := time.Now()
+	if _, found := l.UserFor("buildconfigs", "demo", "old"); found {
+		t.Errorf("Expected the lines written before the start to be skipped")
+	}
+	if _, found := l.UserFor("jobs", "demo", "job"); found {
+		t.Errorf("Expected the new lines not to be read before the next poll")
+	}
+
+	// the lines are read on demand, for a change received after the last poll
+	l.CatchUp(now)
+
+	tests := []struct {
+		resource     string
+		name         string
+		createdAt    time.Time
+		expectedUser string
+	}{
+		{resource: "buildconfigs", createdAt: now.Truncate(time.Second), expectedUser: "alice"},
+		{resource: "buildconfigs", createdAt: now.Add(-2 * time.Hour), expectedUser: ""},
+		{resource: "secrets", createdAt: now.Truncate(time.Second), expectedUser: ""},
+		{resource: "jobs", name: "job", expectedUser: "system:admin"},
+	}
+	for count, test := range tests {
+		var user string
+		if len(test.name) > 0 {
+			user, _ = l.UserFor(test.resource, "demo", test.name)
+		} else {
+			user, _ = l.CreatorFor(test.resource, "demo", test.createdAt)
+		}
+		if user != test.expectedUser {
+			t.Errorf("Test[%d] Failed: Expected '%s' but got '%s'", count, test.expectedUser, user)
+		}
+	}
+}
+
+func TestCreatorForConcurrentCreations(t *testing.T) {
+	l := NewLog("")
+	now := time.Now()
+	l.process(`AUDIT: id="1" method="POST" user="alice" as="<self>" uri="/api/v1/namespaces/demo/configmaps"`, now)
+	if user, _ := l.CreatorFor("configmaps", "demo", now); user != "alice" {
+		t.Errorf("Expected 'alice' but got '%s'", user)
+	}
+
+	l.process(`AUDIT: id="2" method="POST" user="bob" as="<self>" uri="/api/v1/namespaces/demo/configmaps"`, now)
+	if user, found := l.CreatorFor("configmaps", "demo", now); found {
+		t.Errorf("Expected no creator for concurrent creations by different users but got '%s'", user)
+	}
+}
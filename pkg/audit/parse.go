@@ -0,0 +1,114 @@
+package audit
+
+import (
+	"strconv"
+	"strings"
+)
+
+// linePrefix is the prefix of all the audit lines
+const linePrefix = "AUDIT:"
+
+// ParseLine parses a single line of an OpenShift audit log,
+// such as `AUDIT: id="5c3b8227" method="PUT" user="alice" uri="/oapi/v1/namespaces/demo/buildconfigs/app"`
+// and returns its fields (as key/value pairs).
+// Returns nil if the given line is not an audit line.
+func ParseLine(line string) map[string]string {
+	index := strings.Index(line, linePrefix)
+	if index < 0 {
+		return nil
+	}
+	line = strings.TrimSpace(line[index+len(linePrefix):])
+
+	fields := map[string]string{}
+	for len(line) > 0 {
+		equal := strings.Index(line, "=")
+		if equal <= 0 {
+			break
+		}
+		key := strings.TrimSpace(line[:equal])
+		line = line[equal+1:]
+
+		var value string
+		if strings.HasPrefix(line, `"`) {
+			end := closingQuoteIndex(line)
+			if end < 0 {
+				break
+			}
+			unquoted, err := strconv.Unquote(line[:end+1])
+			if err != nil {
+				break
+			}
+			value = unquoted
+			line = line[end+1:]
+		} else {
+			end := strings.Index(line, " ")
+			if end < 0 {
+				end = len(line)
+			}
+			value = line[:end]
+			line = line[end:]
+		}
+
+		fields[key] = value
+		line = strings.TrimSpace(line)
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+	return fields
+}
+
+// ParseURI parses the URI of an API request, such as "/oapi/v1/namespaces/demo/buildconfigs/app",
+// and returns the type of resource (in its plural form, like "buildconfigs"),
+// its namespace and its name.
+// The name is empty for requests on a list of resources,
+// and all the values are empty for requests on sub-resources (like "status").
+func ParseURI(uri string) (resource, namespace, name string) {
+	if index := strings.Index(uri, "?"); index >= 0 {
+		uri = uri[:index]
+	}
+	elems := strings.Split(strings.Trim(uri, "/"), "/")
+
+	// remove the API prefix: /api/v1, /oapi/v1 or /apis/group/version
+	switch {
+	case len(elems) >= 2 && (elems[0] == "api" || elems[0] == "oapi"):
+		elems = elems[2:]
+	case len(elems) >= 3 && elems[0] == "apis":
+		elems = elems[3:]
+	default:
+		return "", "", ""
+	}
+
+	if len(elems) > 2 && elems[0] == "namespaces" {
+		namespace = elems[1]
+		elems = elems[2:]
+	}
+
+	switch len(elems) {
+	case 1:
+		return elems[0], namespace, ""
+	case 2:
+		if elems[0] == "namespaces" {
+			// the namespace itself
+			return elems[0], "", elems[1]
+		}
+		return elems[0], namespace, elems[1]
+	}
+
+	return "", "", ""
+}
+
+// closingQuoteIndex returns the index of the quote that closes
+// the quoted string at the beginning of the given string, or -1
+func closingQuoteIndex(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
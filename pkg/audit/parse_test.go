@@ -0,0 +1,113 @@
+package audit
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		line           string
+		expectedResult map[string]string
+	}{
+		{
+			line:           "I0601 10:00:00.000000 1 some other log line",
+			expectedResult: nil,
+		},
+		{
+			line: `I0601 10:00:00.000000 1 audit.go:45] AUDIT: id="5c3b8227" ip="127.0.0.1" method="PUT" user="alice" as="<self>" namespace="demo" uri="/oapi/v1/namespaces/demo/buildconfigs/app"`,
+			expectedResult: map[string]string{
+				"id":        "5c3b8227",
+				"ip":        "127.0.0.1",
+				"method":    "PUT",
+				"user":      "alice",
+				"as":        "<self>",
+				"namespace": "demo",
+				"uri":       "/oapi/v1/namespaces/demo/buildconfigs/app",
+			},
+		},
+		{
+			line: `AUDIT: id="5c3b8227" response="200"`,
+			expectedResult: map[string]string{
+				"id":       "5c3b8227",
+				"response": "200",
+			},
+		},
+		{
+			line: `AUDIT: id="1" user="John \"JD\" Doe" response=404`,
+			expectedResult: map[string]string{
+				"id":       "1",
+				"user":     `John "JD" Doe`,
+				"response": "404",
+			},
+		},
+	}
+
+	for count, test := range tests {
+		result := ParseLine(test.line)
+		if !reflect.DeepEqual(result, test.expectedResult) {
+			t.Errorf("Test[%d] Failed: Expected '%v' but got '%v'", count, test.expectedResult, result)
+		}
+	}
+}
+
+func TestParseURI(t *testing.T) {
+	tests := []struct {
+		uri               string
+		expectedResource  string
+		expectedNamespace string
+		expectedName      string
+	}{
+		{
+			uri:               "/oapi/v1/namespaces/demo/buildconfigs/app",
+			expectedResource:  "buildconfigs",
+			expectedNamespace: "demo",
+			expectedName:      "app",
+		},
+		{
+			uri:               "/api/v1/namespaces/demo/services?watch=true",
+			expectedResource:  "services",
+			expectedNamespace: "demo",
+			expectedName:      "",
+		},
+		{
+			uri:               "/api/v1/namespaces/demo",
+			expectedResource:  "namespaces",
+			expectedNamespace: "",
+			expectedName:      "demo",
+		},
+		{
+			uri:               "/oapi/v1/users/alice",
+			expectedResource:  "users",
+			expectedNamespace: "",
+			expectedName:      "alice",
+		},
+		{
+			uri:               "/apis/extensions/v1beta1/namespaces/demo/jobs/backup",
+			expectedResource:  "jobs",
+			expectedNamespace: "demo",
+			expectedName:      "backup",
+		},
+		{
+			uri:               "/oapi/v1/namespaces/demo/deploymentconfigs/app/status",
+			expectedResource:  "",
+			expectedNamespace: "",
+			expectedName:      "",
+		},
+		{
+			uri:               "/healthz",
+			expectedResource:  "",
+			expectedNamespace: "",
+			expectedName:      "",
+		},
+	}
+
+	for count, test := range tests {
+		resource, namespace, name := ParseURI(test.uri)
+		if resource != test.expectedResource || namespace != test.expectedNamespace || name != test.expectedName {
+			t.Errorf("Test[%d] Failed: Expected '%s %s %s' but got '%s %s %s'", count,
+				test.expectedResource, test.expectedNamespace, test.expectedName,
+				resource, namespace, name)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package decrypt
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/vbehar/openshift-git/pkg/cmd"
+	"github.com/vbehar/openshift-git/pkg/encrypt"
+	"github.com/vbehar/openshift-git/pkg/sidecar"
+	"github.com/vbehar/openshift-git/pkg/store"
+
+	"github.com/golang/glog"
+	"github.com/spf13/cobra"
+)
+
+var (
+	decryptCmdLongDescription = `
+Decrypts the OpenShift resources encrypted by the 'export' command.
+
+When the '--encryption-key-file' flag is used with the 'export' command, the data of the secrets
+(and the additional fields listed with the '--encrypt-fields' flag) are encrypted before being written
+to the repository. Each value is encrypted separately (in the 'ENC[AES256_GCM,...]' format),
+so that the files can still be compared and diffed.
+
+This command decrypts all the encrypted values of the given files, using the same key,
+and prints the decrypted resources - or replaces the files with the '--in-place' flag.
+The values split into sidecar files (with the '--split-threshold' flag of the 'export' command)
+are joined back into the decrypted resources.
+
+The '--encryption-key-file' flag is mandatory: it defines the file containing the secret key.`
+	decryptCmdExample = `
+	# Print a decrypted secret
+	$ %[1]s /tmp/export/Namespace/my-namespace/Secret/my-secret.yaml --encryption-key-file=/etc/openshift-git/key
+
+	# Decrypt all the secrets of a namespace, in place
+	$ %[1]s /tmp/export/Namespace/my-namespace/Secret/* --encryption-key-file=/etc/openshift-git/key --in-place`
+
+	decryptCmd = &cobra.Command{
+		Use:   "decrypt FILE...",
+		Short: "Decrypt OpenShift resources exported to a Git repository",
+		PreRunE: func(command *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return fmt.Errorf("Missing file to decrypt.")
+			}
+			if len(decryptOptions.EncryptionKeyFile) == 0 {
+				return fmt.Errorf("Missing encryption key file.")
+			}
+			return nil
+		},
+		Run: func(command *cobra.Command, args []string) {
+			encrypter, err := encrypt.NewEncrypterFromFile(decryptOptions.EncryptionKeyFile, nil)
+			if err != nil {
+				glog.Fatalf("Failed to load encryption key: %v", err)
+			}
+
+			for _, path := range args {
+				if sidecar.IsSidecarDir(filepath.Clean(path)) {
+					glog.V(2).Infof("Skipping the sidecar directory %s: its files are decrypted with their resource", path)
+					continue
+				}
+				if err := decryptFile(encrypter, path); err != nil {
+					glog.Fatalf("Failed to decrypt %s: %v", path, err)
+				}
+			}
+		},
+	}
+
+	decryptOptions = &DecryptOptions{}
+)
+
+func init() {
+	cmd.RootCmd.AddCommand(decryptCmd)
+	decryptCmd.Long = decryptCmdLongDescription
+	decryptCmd.Example = fmt.Sprintf(decryptCmdExample, cmd.FullName(decryptCmd))
+	decryptCmd.Flags().StringVar(&decryptOptions.EncryptionKeyFile, "encryption-key-file", "", "Mandatory. Path of the file containing the secret key used to encrypt the resources.")
+	decryptCmd.Flags().BoolVar(&decryptOptions.InPlace, "in-place", false, "If present, replace the given files with their decrypted content, instead of printing it.")
+}
+
+// DecryptOptions represents the options of the decrypt command
+type DecryptOptions struct {
+	EncryptionKeyFile string
+	InPlace           bool
+}
+
+// decryptFile decrypts the given file (in YAML or JSON, depending on its extension),
+// with the values of its sidecar files joined back into it (see store.ReadResourceFile)
+// and either prints it, or replaces it - and removes its sidecar files.
+func decryptFile(encrypter *encrypt.Encrypter, path string) error {
+	content, err := store.ReadResourceFile(path)
+	if err != nil {
+		return err
+	}
+
+	decrypted, err := encrypter.Decrypt(content, strings.TrimPrefix(filepath.Ext(path), "."))
+	if err != nil {
+		return err
+	}
+
+	if decryptOptions.InPlace {
+		if err := ioutil.WriteFile(path, decrypted, 0644); err != nil {
+			return err
+		}
+		// the sidecar files are now joined into the decrypted file
+		return os.RemoveAll(store.SidecarDir(path))
+	}
+
+	_, err = os.Stdout.Write(decrypted)
+	return err
+}
@@ -0,0 +1,75 @@
+package export
+
+import (
+	"fmt"
+
+	"github.com/vbehar/openshift-git/pkg/audit"
+	"github.com/vbehar/openshift-git/pkg/openshift"
+
+	"k8s.io/kubernetes/pkg/api/meta"
+	"k8s.io/kubernetes/pkg/api/unversioned"
+
+	"github.com/golang/glog"
+)
+
+// newAuthorResolver returns an AuthorResolver that uses the configured sources
+// (audit log, annotations, build and deployment causes, and last applied configurations) to find the author of a change.
+// The audit log is only used if a stopChan is provided (in watch mode).
+func newAuthorResolver(mapper meta.RESTMapper, stopChan <-chan struct{}) openshift.AuthorResolver {
+	resolvers := openshift.AuthorResolvers{}
+
+	if len(exportOptions.AuthorAuditLog) > 0 && stopChan != nil {
+		glog.Infof("Tailing audit log %s to find the authors of the changes", exportOptions.AuthorAuditLog)
+		auditLog := audit.NewLog(exportOptions.AuthorAuditLog)
+		auditLog.RunUntil(stopChan)
+		resolvers = append(resolvers, &openshift.AuditLogAuthorResolver{
+			Log: auditLog,
+			ResourceForGroupKind: func(gk unversioned.GroupKind) (string, error) {
+				mapping, err := mapper.RESTMapping(gk)
+				if err != nil {
+					return "", err
+				}
+				return mapping.Resource, nil
+			},
+		})
+	}
+
+	if len(exportOptions.AuthorAnnotations) > 0 {
+		resolvers = append(resolvers, &openshift.AnnotationsAuthorResolver{
+			Annotations: exportOptions.AuthorAnnotations,
+		})
+	}
+
+	resolvers = append(resolvers, &openshift.BuildCauseAuthorResolver{}, &openshift.DeploymentCauseAuthorResolver{})
+
+	if len(exportOptions.AuthorApplyUser) > 0 {
+		resolvers = append(resolvers, &openshift.LastAppliedAuthorResolver{
+			Name: exportOptions.AuthorApplyUser,
+		})
+	}
+
+	return &emailAuthorResolver{
+		AuthorResolver: resolvers,
+	}
+}
+
+// emailAuthorResolver is an AuthorResolver that sets the email of the resolved authors,
+// either from the configured domain or from the repository user email.
+type emailAuthorResolver struct {
+	openshift.AuthorResolver
+}
+
+// AuthorFor implements the AuthorResolver interface
+func (r *emailAuthorResolver) AuthorFor(resource *openshift.Resource) *openshift.Author {
+	author := r.AuthorResolver.AuthorFor(resource)
+	if author == nil || len(author.Email) > 0 {
+		return author
+	}
+
+	if len(exportOptions.AuthorEmailDomain) > 0 {
+		author.Email = fmt.Sprintf("%s@%s", author.Name, exportOptions.AuthorEmailDomain)
+	} else {
+		author.Email = exportOptions.RepositoryUserEmail
+	}
+	return author
+}
@@ -2,11 +2,19 @@ package export
 
 import (
 	"fmt"
+	"path/filepath"
 	"time"
 
 	"github.com/vbehar/openshift-git/pkg/cmd"
+	"github.com/vbehar/openshift-git/pkg/encrypt"
 	"github.com/vbehar/openshift-git/pkg/git"
+	"github.com/vbehar/openshift-git/pkg/git/backend"
+	"github.com/vbehar/openshift-git/pkg/normalize"
 	"github.com/vbehar/openshift-git/pkg/openshift"
+	"github.com/vbehar/openshift-git/pkg/sidecar"
+	"github.com/vbehar/openshift-git/pkg/store"
+
+	projectapi "github.com/openshift/origin/pkg/project/api"
 
 	"github.com/golang/glog"
 	"github.com/spf13/cobra"
@@ -17,7 +25,8 @@ var (
 Exports OpenShift resources to a Git repository - optionally pushing to a configured remote.
 
 It can either be run:
-- as a one-time operation, just exporting all resources
+- as a one-time operation, exporting all resources, and recording them in a single "snapshot" commit
+  (the resources that don't exist anymore in the cluster are deleted from the repository)
 - as a daemon, first exporting all resources and then watching for changes (with the '--watch' option)
 
 It expects a comma-separated list of types to export, like buildconfig, pods, routes and so on.
@@ -62,23 +71,34 @@ Otherwise, you can use the same option as the OpenShift Client (oc):
 			if len(exportOptions.RepositoryPath) == 0 {
 				return fmt.Errorf("Missing repository path.")
 			}
-			return nil
+			switch exportOptions.Store {
+			case storeGit, storeDirectory:
+			default:
+				return fmt.Errorf("Invalid store '%s': should be '%s' or '%s'.", exportOptions.Store, storeGit, storeDirectory)
+			}
+			if err := exportOptions.loadNormalizationRules(); err != nil {
+				return err
+			}
+			if err := exportOptions.loadSplitter(); err != nil {
+				return err
+			}
+			return exportOptions.loadEncrypter()
 		},
 		Run: func(command *cobra.Command, args []string) {
-			repo, err := git.NewRepository(exportOptions.RepositoryPath,
-				exportOptions.RepositoryBranch,
-				exportOptions.RepositoryRemote,
-				exportOptions.RepositoryContextDir,
-				exportOptions.RepositoryUserName,
-				exportOptions.RepositoryUserEmail)
+			st, err := openStore()
 			if err != nil {
-				glog.Fatalf("Failed to init git repo: %v", err)
+				glog.Fatalf("Failed to open the %s store: %v", exportOptions.Store, err)
 			}
 
 			if exportOptions.Watch {
-				err = runWatch(args[0], repo)
+				err = runWatch(args[0], st)
 			} else {
-				err = runList(args[0], repo)
+				err = runList(args[0], st)
+			}
+
+			// so that the repository can be used by the git binary
+			if closeErr := st.Close(); closeErr != nil {
+				glog.Errorf("Failed to close the %s store: %v", exportOptions.Store, closeErr)
 			}
 
 			if err != nil {
@@ -90,42 +110,266 @@ Otherwise, you can use the same option as the OpenShift Client (oc):
 	exportOptions = &ExportOptions{}
 )
 
+// Stores supported by the '--store' flag
+const (
+	// storeGit stores the resources in a git repository
+	storeGit = "git"
+
+	// storeDirectory mirrors the resources in a plain directory, without any version control
+	storeDirectory = "directory"
+)
+
 func init() {
 	cmd.RootCmd.AddCommand(exportCmd)
 	exportCmd.Long = fmt.Sprintf(exportCmdLongDescription, openshift.AllKinds)
 	exportCmd.Example = fmt.Sprintf(exportCmdExample, cmd.FullName(exportCmd))
 	exportCmd.Flags().AddFlagSet(openshift.Flags)
-	exportCmd.Flags().StringVar(&exportOptions.RepositoryPath, "repository-path", "", "Mandatory. Path of the git repository on the filesystem. A new repository will be created if the path does not exists.")
+	exportCmd.Flags().StringVar(&exportOptions.RepositoryPath, "repository-path", "", "Mandatory. Path of the git repository (or of the directory, with '--store=directory') on the filesystem. A new repository will be created if the path does not exists.")
+	exportCmd.Flags().StringVar(&exportOptions.Store, "store", storeGit, "Where the resources are stored: 'git' commits them to a git repository, 'directory' mirrors them as plain files in a directory (without any version control), so that they can be versioned with another tool.")
+	exportCmd.Flags().StringVar(&exportOptions.SnapshotsDir, "snapshots-dir", "", "Optional path of the directory in which the snapshots are created with '--store=directory' and '--tag-period'. Defaults to the '.openshift-git/snapshots' directory of the store.")
 	exportCmd.Flags().StringVar(&exportOptions.RepositoryBranch, "repository-branch", "master", "Branch of the git repository to use for commits.")
 	exportCmd.Flags().StringVar(&exportOptions.RepositoryRemote, "repository-remote", "", "Optional URL of a remote git repository. If present, periodic push/pull operations will be scheduled, to keep the local and remote repositories in sync.")
 	exportCmd.Flags().StringVar(&exportOptions.RepositoryContextDir, "repository-context-dir", "", "Optional relative directory (in the repository) that will be used to store data.")
 	exportCmd.Flags().StringVar(&exportOptions.RepositoryUserName, "repository-user-name", "OpenShift", "Name used for the commits to the Git repository.")
 	exportCmd.Flags().StringVar(&exportOptions.RepositoryUserEmail, "repository-user-email", "openshift@example.com", "Email used for the commits to the Git repository.")
+	exportCmd.Flags().StringVar(&exportOptions.RepositoryCredentials.Username, "repository-username", "", "Optional name of the user used to access the remote git repository over HTTPS (not to be confused with '--repository-user-name', used for the commits). Defaults to 'oauth2' with '--repository-token-file'.")
+	exportCmd.Flags().StringVar(&exportOptions.RepositoryCredentials.PasswordFile, "repository-password-file", "", "Optional path of a file containing the password of the '--repository-username' user, used to access the remote git repository over HTTPS.")
+	exportCmd.Flags().StringVar(&exportOptions.RepositoryCredentials.TokenFile, "repository-token-file", "", "Optional path of a file containing a token, used to access the remote git repository over HTTPS.")
+	exportCmd.Flags().StringVar(&exportOptions.RepositorySSH.PrivateKeyFile, "ssh-private-key-file", "", "Optional path of the SSH private key used to access the remote git repository over SSH.")
+	exportCmd.Flags().StringVar(&exportOptions.RepositorySSH.KnownHostsFile, "ssh-known-hosts-file", "", "Optional path of a known_hosts file, with the public keys of the git servers, used to verify them when accessing the remote git repository over SSH. Defaults to the standard known_hosts files.")
+	exportCmd.Flags().StringVar(&exportOptions.Signing.KeyFile, "signing-key-file", "", "Optional path of a private key (GPG or SSH, see '--signing-format') used to sign all the commits.")
+	exportCmd.Flags().StringVar(&exportOptions.Signing.Format, "signing-format", git.SigningFormatGPG, "Format of the signing key ('gpg' or 'ssh').")
+	exportCmd.Flags().StringSliceVar(&exportOptions.AuthorAnnotations, "author-annotations", []string{projectapi.ProjectRequester}, "Annotations of the resources that may contain the name of the user who made the change, used as the author of the commits.")
+	exportCmd.Flags().StringVar(&exportOptions.AuthorAuditLog, "author-audit-log", "", "Optional path of an OpenShift audit log file, that will be tailed (in watch mode) to find the user who made each change, used as the author of the commits.")
+	exportCmd.Flags().StringVar(&exportOptions.AuthorApplyUser, "author-apply-user", "", "Optional name of the user who applies the configurations (with 'kubectl apply' or 'oc apply'), used as the author of the commits of the resources that still match their last applied configuration.")
+	exportCmd.Flags().StringVar(&exportOptions.AuthorEmailDomain, "author-email-domain", "", "Optional domain used to build the email of the authors of the commits (user@domain). If empty, the repository user email is used.")
+	exportCmd.Flags().StringVar(&exportOptions.ClusterName, "cluster-name", "", "Name of the cluster, recorded in the 'Cluster' trailer of the commits (and used if the layout of the repository contains {cluster}). Defaults to the URL of the OpenShift API server.")
 	exportCmd.Flags().StringVar(&exportOptions.Format, "format", "yaml", "Format of the exported resources ('json' or 'yaml')")
+	exportCmd.Flags().StringVar(&exportOptions.RepositoryLayout, "repository-layout", "", "Optional template of the layout of the resources in the repository, like 'clusters/{cluster}/{namespace}/{kind}/{name}'. Supported variables are {cluster}, {namespace}, {kind}, {group}, {name} and {label:KEY} ({namespace}, {kind} and {name} are mandatory). Parts between brackets are omitted if their variables are empty. Defaults to '[Namespace/{namespace}/]{kind}/{name}'.")
+	exportCmd.Flags().BoolVar(&exportOptions.RepositoryGroupLayout, "repository-group-layout", false, "If present (and no custom layout is provided), the directories of the kinds are qualified with their API group (like 'Deployment.extensions'), so that kinds with the same name in different API groups don't collide.")
 	exportCmd.Flags().StringVarP(&exportOptions.LabelSelector, "selector", "l", "", "Selector (label query) to filter on")
 	exportCmd.Flags().BoolVar(&exportOptions.AllNamespaces, "all-namespaces", false, "If present, export the requested resources across all namespaces. Namespace in current context is ignored even if specified with --namespace.")
 	exportCmd.Flags().BoolVar(&exportOptions.UseDefaultSelector, "default-selector", true, "If present, some default label selectors will be applied (for example, ignore build and deploy pods, ignore pods managed by RC or DC, or ignore RC managed by DC)")
+	exportCmd.Flags().StringVar(&exportOptions.NormalizationRules, "normalization-rules", "", "Optional path of a YAML file with rules to remove or normalize some fields of the resources (per kind) before writing them.")
+	exportCmd.Flags().BoolVar(&exportOptions.UseDefaultNormalizationRules, "default-normalization-rules", true, "If present, some default normalization rules will be applied (for example, remove the status, the generation, or the last triggered image of the deployment configs)")
+	exportCmd.Flags().StringVar(&exportOptions.EncryptionKeyFile, "encryption-key-file", "", "Optional path of a file containing a secret key, used to encrypt the data of the secrets (and the fields listed with '--encrypt-fields') before writing them.")
+	exportCmd.Flags().StringSliceVar(&exportOptions.EncryptFields, "encrypt-fields", []string{}, "Additional fields to encrypt (requires '--encryption-key-file'), in the 'Kind:path' format, like 'ConfigMap:data[password]'. Use '*' as the kind to encrypt the field for all kinds.")
+	exportCmd.Flags().IntVar(&exportOptions.SplitThreshold, "split-threshold", 0, "If not zero, defines the size (in bytes) above which the payloads of some fields (the data of the configmaps and secrets, the objects of the templates, the inline Dockerfile of the buildconfigs, and the fields listed with '--split-fields') are written to separate files, next to the file of the resource.")
+	exportCmd.Flags().StringSliceVar(&exportOptions.SplitFields, "split-fields", []string{}, "Additional fields whose payloads may be written to separate files (requires '--split-threshold'), in the 'Kind:path' format, like 'Route:spec.tls.certificate'.")
 	exportCmd.Flags().BoolVarP(&exportOptions.Watch, "watch", "w", false, "After exporting the requested types, watch for changes.")
+	exportCmd.Flags().StringVar(&exportOptions.ListenAddress, "listen-address", "", "Optional address (like ':8080') of an HTTP server exposing the /healthz, /readyz and /metrics (Prometheus) endpoints, in watch mode.")
+	exportCmd.Flags().BoolVar(&exportOptions.ResumeWatch, "resume-watch", true, "If present, the last resource version of each kind is persisted (in the .git directory) once committed, and on restart the watch resumes from there instead of listing all the resources again. A full list is still performed if the version is too old.")
 	exportCmd.Flags().DurationVar(&exportOptions.ResyncPeriod, "resync-period", 1*time.Hour, "If not zero, defines the interval of time to perform a full resync of the OpenShift resources to export.")
+	exportCmd.Flags().DurationVar(&exportOptions.NamespacePollPeriod, "namespace-poll-period", 30*time.Second, "Interval of time to check for changes of the namespace/project (when watching a single namespace), if it can't be watched.")
+	exportCmd.Flags().DurationVar(&exportOptions.CommitWindow, "commit-window", 0, "If not zero, defines the interval of time during which the changes are accumulated, and then committed together in a single commit - instead of one commit per resource.")
+	exportCmd.Flags().IntVar(&exportOptions.CommitWindowSize, "commit-window-size", 500, "If not zero, defines the maximum number of changes that can be accumulated in a commit window. The changes are committed as soon as this number is reached.")
 	exportCmd.Flags().DurationVar(&exportOptions.RepositoryPullPeriod, "repository-pull-period", 2*time.Minute, "If not zero, defines the interval of time to perform a pull of the remote git repository.")
 	exportCmd.Flags().DurationVar(&exportOptions.RepositoryPushPeriod, "repository-push-period", 2*time.Minute, "If not zero, defines the interval of time to perform a push to the remote git repository.")
+	exportCmd.Flags().StringVar(&exportOptions.RepositoryBackend, "repository-backend", backend.CLI, "Backend used to commit the changes: 'cli' runs the git binary, 'objects' writes the commits directly into the git object database - which is faster, but can't sign the commits.")
+	exportCmd.Flags().IntVar(&exportOptions.RepositoryPushRetries, "repository-push-retries", git.DefaultPushRetries, "Number of times a failed push to the remote git repository is retried - after rebasing the local commits on top of the remote ones.")
+	exportCmd.Flags().DurationVar(&exportOptions.RepositoryPushBackoff, "repository-push-backoff", git.DefaultPushBackoff, "Delay before retrying a failed push to the remote git repository. It is doubled after each retry.")
+	exportCmd.Flags().DurationVar(&exportOptions.TagPeriod, "tag-period", 0, "If not zero, defines the interval of time to create a snapshot tag (like 'snapshot/2016-06-01' for a period of 24h) on the last commit. Only a fixed period is supported, not a cron expression: the tags are created at the start of each period, aligned on the period in UTC (like midnight UTC for 24h). The tags are pushed with the branch. With '--store=directory', a copy of the directory is created in the '--snapshots-dir' instead.")
+	exportCmd.Flags().DurationVar(&exportOptions.TagRetention, "tag-retention", 0, "If not zero, defines how long the snapshot tags (or directories) are kept: older tags are deleted from the local and remote git repositories.")
+	exportCmd.Flags().DurationVar(&exportOptions.ShutdownPushTimeout, "shutdown-push-timeout", 1*time.Minute, "If not zero, defines the maximum duration of the last push to the remote git repository, when the daemon is stopped. After this delay, the running git push is killed and the failed push is no longer retried.")
 }
 
 // ExportOptions represents the options of the export command
 type ExportOptions struct {
-	AllNamespaces        bool
-	Namespace            string
-	Format               string
-	Watch                bool
-	UseDefaultSelector   bool
-	LabelSelector        string
-	ResyncPeriod         time.Duration
-	RepositoryPath       string
-	RepositoryBranch     string
-	RepositoryRemote     string
-	RepositoryContextDir string
-	RepositoryUserName   string
-	RepositoryUserEmail  string
-	RepositoryPullPeriod time.Duration
-	RepositoryPushPeriod time.Duration
+	AllNamespaces         bool
+	ClusterName           string
+	Namespace             string
+	Format                string
+	Watch                 bool
+	ListenAddress         string
+	UseDefaultSelector    bool
+	LabelSelector         string
+	ResumeWatch           bool
+	ResyncPeriod          time.Duration
+	NamespacePollPeriod   time.Duration
+	CommitWindow          time.Duration
+	CommitWindowSize      int
+	Store                 string
+	SnapshotsDir          string
+	RepositoryPath        string
+	RepositoryBranch      string
+	RepositoryRemote      string
+	RepositoryContextDir  string
+	RepositoryLayout      string
+	RepositoryGroupLayout bool
+	RepositoryUserName    string
+	RepositoryUserEmail   string
+	RepositoryBackend     string
+	RepositoryCredentials git.Credentials
+	RepositorySSH         git.SSHConfig
+	Signing               git.SigningConfig
+	AuthorAnnotations     []string
+	AuthorAuditLog        string
+	AuthorApplyUser       string
+	AuthorEmailDomain     string
+	RepositoryPullPeriod  time.Duration
+	RepositoryPushPeriod  time.Duration
+	RepositoryPushRetries int
+	RepositoryPushBackoff time.Duration
+	TagPeriod             time.Duration
+	TagRetention          time.Duration
+	ShutdownPushTimeout   time.Duration
+
+	NormalizationRules           string
+	UseDefaultNormalizationRules bool
+	EncryptionKeyFile            string
+	EncryptFields                []string
+	SplitThreshold               int
+	SplitFields                  []string
+
+	// normalizationRules are the rules loaded from the NormalizationRules file
+	// and the default rules
+	normalizationRules normalize.Rules
+
+	// encrypter is used to encrypt the resources (nil if there is no EncryptionKeyFile)
+	encrypter *encrypt.Encrypter
+
+	// splitter is used to split the large payloads into sidecar files (nil if there is no SplitThreshold)
+	splitter *sidecar.Splitter
+}
+
+// openStore opens (or creates) the configured store
+func openStore() (store.Store, error) {
+	if exportOptions.Store == storeDirectory {
+		return openDirectoryStore()
+	}
+	return openRepository()
+}
+
+// openRepository opens (or creates) the configured git repository
+func openRepository() (*git.Repository, error) {
+	if err := git.ConfigureCredentials(exportOptions.RepositoryCredentials); err != nil {
+		return nil, fmt.Errorf("Invalid repository credentials: %v", err)
+	}
+	if err := git.ConfigureSSH(exportOptions.RepositorySSH); err != nil {
+		return nil, fmt.Errorf("Invalid SSH configuration: %v", err)
+	}
+	if err := git.ConfigureSigning(exportOptions.Signing); err != nil {
+		return nil, fmt.Errorf("Invalid signing configuration: %v", err)
+	}
+
+	repo, err := git.NewRepository(exportOptions.RepositoryPath,
+		exportOptions.RepositoryBranch,
+		exportOptions.RepositoryRemote,
+		exportOptions.RepositoryContextDir,
+		exportOptions.RepositoryUserName,
+		exportOptions.RepositoryUserEmail)
+	if err != nil {
+		return nil, err
+	}
+
+	repo.ClusterName = openshift.ClusterName(exportOptions.ClusterName)
+	repo.PushRetries = exportOptions.RepositoryPushRetries
+	repo.PushBackoff = exportOptions.RepositoryPushBackoff
+	if err := repo.SetLayout(exportOptions.RepositoryLayout, exportOptions.RepositoryGroupLayout); err != nil {
+		return nil, fmt.Errorf("Invalid layout: %v", err)
+	}
+	if err := repo.SetBackend(exportOptions.RepositoryBackend); err != nil {
+		return nil, fmt.Errorf("Invalid backend: %v", err)
+	}
+	return repo, nil
+}
+
+// openDirectoryStore opens (or creates) the configured plain directory
+func openDirectoryStore() (*store.DirectoryStore, error) {
+	dir := exportOptions.RepositoryPath
+	if len(exportOptions.RepositoryContextDir) > 0 {
+		dir = filepath.Join(dir, exportOptions.RepositoryContextDir)
+	}
+
+	directory, err := store.NewDirectoryStore(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	directory.ClusterName = openshift.ClusterName(exportOptions.ClusterName)
+	if len(exportOptions.SnapshotsDir) > 0 {
+		directory.SnapshotsDir = exportOptions.SnapshotsDir
+	}
+	if err := directory.SetLayout(exportOptions.RepositoryLayout, exportOptions.RepositoryGroupLayout); err != nil {
+		return nil, fmt.Errorf("Invalid layout: %v", err)
+	}
+	return directory, nil
+}
+
+// loadNormalizationRules loads the normalization rules to apply to the resources
+func (o *ExportOptions) loadNormalizationRules() error {
+	rules := normalize.Rules{}
+	if o.UseDefaultNormalizationRules {
+		rules = append(rules, normalize.DefaultRules()...)
+	}
+	if len(o.NormalizationRules) > 0 {
+		customRules, err := normalize.LoadRules(o.NormalizationRules)
+		if err != nil {
+			return err
+		}
+		rules = append(rules, customRules...)
+	}
+	o.normalizationRules = rules
+	return nil
+}
+
+// loadEncrypter loads the encryption key from the EncryptionKeyFile (if any)
+func (o *ExportOptions) loadEncrypter() error {
+	if len(o.EncryptionKeyFile) == 0 {
+		if len(o.EncryptFields) > 0 {
+			return fmt.Errorf("Missing encryption key file to encrypt the fields %v.", o.EncryptFields)
+		}
+		return nil
+	}
+
+	fields := encrypt.DefaultFields()
+	for _, f := range o.EncryptFields {
+		field, err := normalize.ParseField(f)
+		if err != nil {
+			return err
+		}
+		fields = append(fields, field)
+	}
+
+	encrypter, err := encrypt.NewEncrypterFromFile(o.EncryptionKeyFile, fields)
+	if err != nil {
+		return err
+	}
+	o.encrypter = encrypter
+	return nil
+}
+
+// loadSplitter loads the splitter of the large payloads, if a SplitThreshold is defined
+func (o *ExportOptions) loadSplitter() error {
+	if o.SplitThreshold <= 0 {
+		if len(o.SplitFields) > 0 {
+			return fmt.Errorf("Missing split threshold to split the fields %v.", o.SplitFields)
+		}
+		return nil
+	}
+
+	fields := sidecar.DefaultFields()
+	for _, f := range o.SplitFields {
+		field, err := normalize.ParseField(f)
+		if err != nil {
+			return err
+		}
+		if err := normalize.ValidatePath(field.Path); err != nil {
+			return err
+		}
+		fields = append(fields, field)
+	}
+
+	o.splitter = sidecar.NewSplitter(o.SplitThreshold, fields)
+	return nil
+}
+
+// prepareContent normalizes and encrypts the given content of a resource of the given kind,
+// so that it can be written to the repository
+func (o *ExportOptions) prepareContent(kind string, content []byte) ([]byte, error) {
+	content, err := o.normalizationRules.Normalize(kind, content, o.Format)
+	if err != nil {
+		return nil, err
+	}
+	return o.encrypter.Encrypt(kind, content, o.Format)
 }
@@ -0,0 +1,346 @@
+package export
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/vbehar/openshift-git/pkg/cmd"
+	"github.com/vbehar/openshift-git/pkg/diff"
+	"github.com/vbehar/openshift-git/pkg/git"
+	"github.com/vbehar/openshift-git/pkg/normalize"
+	"github.com/vbehar/openshift-git/pkg/openshift"
+
+	"github.com/openshift/origin/pkg/util/parallel"
+
+	kapi "k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/meta"
+	"k8s.io/kubernetes/pkg/kubectl"
+	"k8s.io/kubernetes/pkg/kubectl/resource"
+	"k8s.io/kubernetes/pkg/util/sets"
+
+	"github.com/ghodss/yaml"
+	"github.com/golang/glog"
+	"github.com/spf13/cobra"
+)
+
+var (
+	diffCmdLongDescription = `
+Compares the OpenShift resources in the cluster with the resources stored in a Git repository.
+
+It lists the requested resources exactly like the 'export' command does, but instead of saving them,
+it compares each resource with its content in the last commit of the repository
+(the changes not committed yet are ignored), and prints:
+- the resources that only exist in the cluster (prefixed by '+')
+- the resources that only exist in the repository (prefixed by '-')
+- the resources that are different (prefixed by '~'), followed by a unified diff
+  or the list of the different fields (with the '--output=fields' option)
+
+It exits with a non-zero status if any difference has been found, so it can be used in a CI pipeline:
+1 if some resources are different, or 2 if some resources could not be compared.
+
+It expects a comma-separated list of types to compare, like buildconfig, pods, routes and so on.
+You can use the special 'all' alias (expanded by OpenShift to [bc builds is dc rc routes svc pods]),
+or the recommended 'everything' alias (expanded by openshift-git to %[1]s).
+
+The '--repository-path' flag is mandatory: it defines where the repository is stored on the filesystem.
+
+Note that it behaves like the standard OpenShift Client (oc) to connect to the OpenShift Cluster.
+By default, if a ~/.kube/config file exists, it will be used.
+Otherwise, you can use the same option as the OpenShift Client (oc):
+--config to use a custom kube config file
+--server and --token to specify the master URL and (service account) token directly`
+	diffCmdExample = `
+	# Basic usage: compare everything from the current namespace with the Git repository at /tmp/export
+	$ %[1]s everything --repository-path=/tmp/export
+
+	# Only print the list of the different fields for the deployment configs of the "my-namespace" namespace
+	$ %[1]s dc -n my-namespace --repository-path=/tmp/export --output=fields`
+
+	diffCmd = &cobra.Command{
+		Use:   "diff TYPE",
+		Short: "Compare OpenShift resources with a Git repository",
+		PreRunE: func(command *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return fmt.Errorf("Missing diff type.")
+			}
+			if len(diffOptions.RepositoryPath) == 0 {
+				return fmt.Errorf("Missing repository path.")
+			}
+			switch diffOptions.Output {
+			case "unified", "fields":
+			default:
+				return fmt.Errorf("Invalid output '%s': should be either 'unified' or 'fields'.", diffOptions.Output)
+			}
+			if err := diffOptions.loadNormalizationRules(); err != nil {
+				return err
+			}
+			return diffOptions.loadEncrypter()
+		},
+		Run: func(command *cobra.Command, args []string) {
+			repo, err := git.OpenExistingRepository(diffOptions.RepositoryPath,
+				diffOptions.RepositoryContextDir)
+			if err != nil {
+				glog.Fatalf("Failed to open git repo: %v", err)
+			}
+			repo.ClusterName = openshift.ClusterName(diffOptions.ClusterName)
+			if err := repo.SetLayout(diffOptions.RepositoryLayout, diffOptions.RepositoryGroupLayout); err != nil {
+				glog.Fatalf("Invalid layout: %v", err)
+			}
+
+			stats, err := runDiff(args[0], repo, os.Stdout)
+			if err != nil {
+				glog.Fatalf("Failed: %v", err)
+			}
+
+			switch {
+			case stats.failed > 0:
+				os.Exit(diffExitFailed)
+			case stats.drift():
+				os.Exit(diffExitDrift)
+			}
+		},
+	}
+
+	diffOptions = &DiffOptions{
+		ExportOptions: &ExportOptions{},
+	}
+)
+
+// Exit codes of the diff command
+const (
+	// diffExitDrift is used when some differences have been found
+	diffExitDrift = 1
+
+	// diffExitFailed is used when some resources could not be compared
+	// (whether differences have been found or not)
+	diffExitFailed = 2
+)
+
+func init() {
+	cmd.RootCmd.AddCommand(diffCmd)
+	diffCmd.Long = fmt.Sprintf(diffCmdLongDescription, openshift.AllKinds)
+	diffCmd.Example = fmt.Sprintf(diffCmdExample, cmd.FullName(diffCmd))
+	diffCmd.Flags().AddFlagSet(openshift.Flags)
+	diffCmd.Flags().StringVar(&diffOptions.RepositoryPath, "repository-path", "", "Mandatory. Path of the git repository on the filesystem.")
+	diffCmd.Flags().StringVar(&diffOptions.RepositoryContextDir, "repository-context-dir", "", "Optional relative directory (in the repository) that is used to store data.")
+	diffCmd.Flags().StringVar(&diffOptions.Format, "format", "yaml", "Format of the exported resources ('json' or 'yaml')")
+	diffCmd.Flags().StringVar(&diffOptions.Output, "output", "unified", "Output of the differences ('unified' or 'fields')")
+	diffCmd.Flags().StringVar(&diffOptions.ClusterName, "cluster-name", "", "Name of the cluster, used if the layout of the repository contains {cluster}. Defaults to the URL of the OpenShift API server.")
+	diffCmd.Flags().StringVar(&diffOptions.RepositoryLayout, "repository-layout", "", "Optional template of the layout of the resources in the repository, like 'clusters/{cluster}/{namespace}/{kind}/{name}'. Supported variables are {cluster}, {namespace}, {kind}, {group}, {name} and {label:KEY} ({namespace}, {kind} and {name} are mandatory). Parts between brackets are omitted if their variables are empty. Defaults to '[Namespace/{namespace}/]{kind}/{name}'.")
+	diffCmd.Flags().BoolVar(&diffOptions.RepositoryGroupLayout, "repository-group-layout", false, "If present (and no custom layout is provided), the directories of the kinds are qualified with their API group (like 'Deployment.extensions'), so that kinds with the same name in different API groups don't collide.")
+	diffCmd.Flags().StringVarP(&diffOptions.LabelSelector, "selector", "l", "", "Selector (label query) to filter on")
+	diffCmd.Flags().StringVar(&diffOptions.NormalizationRules, "normalization-rules", "", "Optional path of a YAML file with rules to remove or normalize some fields of the resources (per kind) before comparing them. Should be the same as the one used for the export.")
+	diffCmd.Flags().BoolVar(&diffOptions.UseDefaultNormalizationRules, "default-normalization-rules", true, "If present, some default normalization rules will be applied (for example, remove the status, the generation, or the last triggered image of the deployment configs)")
+	diffCmd.Flags().StringVar(&diffOptions.EncryptionKeyFile, "encryption-key-file", "", "Optional path of the file containing the secret key used to encrypt the secrets during the export.")
+	diffCmd.Flags().StringSliceVar(&diffOptions.EncryptFields, "encrypt-fields", []string{}, "Additional fields encrypted during the export, in the 'Kind:path' format.")
+	diffCmd.Flags().BoolVar(&diffOptions.AllNamespaces, "all-namespaces", false, "If present, compare the requested resources across all namespaces. Namespace in current context is ignored even if specified with --namespace.")
+	diffCmd.Flags().BoolVar(&diffOptions.UseDefaultSelector, "default-selector", true, "If present, some default label selectors will be applied (for example, ignore build and deploy pods, ignore pods managed by RC or DC, or ignore RC managed by DC)")
+}
+
+// DiffOptions represents the options of the diff command
+type DiffOptions struct {
+	*ExportOptions
+	Output string
+}
+
+// diffStats represents the number of differences found by the diff command
+type diffStats struct {
+	onlyInCluster    int64
+	onlyInRepository int64
+	modified         int64
+	identical        int64
+	failed           int64
+}
+
+// drift returns true if any difference has been found
+func (s *diffStats) drift() bool {
+	return s.onlyInCluster+s.onlyInRepository+s.modified > 0
+}
+
+// runDiff compares the given resources with the content of the given repository,
+// and writes the differences to the given writer.
+// Returns the number of differences found - and of resources that could not be compared.
+func runDiff(resources string, repo *git.Repository, out io.Writer) (*diffStats, error) {
+	diffWaiter := &sync.WaitGroup{}
+	resourcesChan := make(chan openshift.Resource, 10)
+
+	namespace, _, err := openshift.Factory.DefaultNamespace()
+	if err != nil {
+		return nil, err
+	}
+	if diffOptions.AllNamespaces {
+		namespace = kapi.NamespaceAll
+	}
+
+	mapper, _ := openshift.Factory.Object()
+
+	kinds, err := openshift.KindsFor(mapper, resource.SplitResourceArgument(resources))
+	if err != nil {
+		return nil, err
+	}
+	if len(kinds) == 0 {
+		return nil, fmt.Errorf("No valid kinds for '%s'", resources)
+	}
+
+	if diffOptions.AllNamespaces {
+		glog.Infof("Running diff for kinds %v for all namespaces", kinds)
+	} else {
+		glog.Infof("Running diff for kinds %v for namespace %s", kinds, namespace)
+	}
+
+	printer, _, err := kubectl.GetPrinter(diffOptions.Format, "")
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &diffStats{}
+	seenKeys := map[string]sets.String{}
+	diffWaiter.Add(1)
+	go func() {
+		defer diffWaiter.Done()
+		diffResources(repo, resourcesChan, mapper, printer, seenKeys, stats, out)
+	}()
+
+	listers, err := listersFor(kinds, namespace, mapper, resourcesChan, diffOptions.ExportOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	errs := parallel.Run(listers...)
+
+	close(resourcesChan)
+	diffWaiter.Wait()
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("Got %d errors: %+v", len(errs), errs)
+	}
+
+	// now look for the resources that only exist in the repository
+	staleResources, err := findStaleResources(repo, kinds, namespace, mapper, seenKeys, diffOptions.ExportOptions)
+	if err != nil {
+		return nil, err
+	}
+	for _, stale := range staleResources {
+		fmt.Fprintf(out, "- %s (only in the repository)\n", stale.resource)
+		stats.onlyInRepository++
+	}
+
+	fmt.Fprintf(out, "%d resources only in the cluster, %d resources only in the repository, %d resources modified, and %d resources identical.\n",
+		stats.onlyInCluster, stats.onlyInRepository, stats.modified, stats.identical)
+	if stats.failed > 0 {
+		fmt.Fprintf(out, "%d resources could not be compared.\n", stats.failed)
+	}
+
+	return stats, nil
+}
+
+// diffResources compares all the resources coming from the given channel with the content of the given repository,
+// and writes the differences to the given writer.
+// The keys of the compared resources are recorded (per kind - with its API group) in the given seenKeys map,
+// and the resources that could not be compared are counted in the given stats.
+// should be run in a single goroutine
+func diffResources(repo *git.Repository, resourcesChan <-chan openshift.Resource, mapper meta.RESTMapper, printer kubectl.ResourcePrinter,
+	seenKeys map[string]sets.String, stats *diffStats, out io.Writer) {
+
+	for resource := range resourcesChan {
+		gk := resource.GroupKind()
+		if _, found := seenKeys[gk.String()]; !found {
+			seenKeys[gk.String()] = sets.NewString()
+		}
+		seenKeys[gk.String()].Insert(resource.NamespacedName())
+
+		if err := diffResource(repo, &resource, mapper, printer, stats, out); err != nil {
+			glog.Errorf("Failed to diff %s: %v", resource.String(), err)
+			stats.failed++
+		}
+	}
+}
+
+// diffResource compares the single given resource with the content of the given repository
+func diffResource(repo *git.Repository, resource *openshift.Resource, mapper meta.RESTMapper, printer kubectl.ResourcePrinter, stats *diffStats, out io.Writer) error {
+	glog.V(2).Infof("Comparing %s", resource)
+
+	printer, err := upgradePrinterForObject(printer, resource.Object, mapper)
+	if err != nil {
+		return err
+	}
+
+	printedContent := &bytes.Buffer{}
+	if err := printer.PrintObj(resource.Object, printedContent); err != nil {
+		return err
+	}
+
+	preparedContent, err := diffOptions.prepareContent(resource.Kind, printedContent.Bytes())
+	if err != nil {
+		return err
+	}
+	clusterContent, err := diffOptions.comparableContent(resource.Kind, preparedContent)
+	if err != nil {
+		return err
+	}
+
+	// the content of the last commit, not of the working tree:
+	// the changes not committed yet are not in the repository
+	path := repo.PathForResource(resource, diffOptions.Format)
+	committedContent, err := repo.ReadCommittedResourceFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			fmt.Fprintf(out, "+ %s (only in the cluster)\n", resource)
+			stats.onlyInCluster++
+			return nil
+		}
+		return err
+	}
+	repositoryContent, err := diffOptions.comparableContent(resource.Kind, committedContent)
+	if err != nil {
+		return err
+	}
+
+	if bytes.Equal(repositoryContent, clusterContent) {
+		stats.identical++
+		return nil
+	}
+
+	stats.modified++
+	fmt.Fprintf(out, "~ %s\n", resource)
+
+	switch diffOptions.Output {
+	case "fields":
+		fields, err := diff.Fields(repositoryContent, clusterContent)
+		if err != nil {
+			return err
+		}
+		for _, field := range fields {
+			fmt.Fprintf(out, "    %s\n", field)
+		}
+	default:
+		relPath, err := filepath.Rel(repo.Path, path)
+		if err != nil {
+			relPath = path
+		}
+		fmt.Fprint(out, diff.Unified(repositoryContent, clusterContent, "repository/"+relPath, "cluster/"+relPath))
+	}
+
+	return nil
+}
+
+// comparableContent returns the given content of a resource of the given kind,
+// normalized and encoded the same way on both sides of the comparison:
+// the content read from the repository is re-encoded when its sidecar files are joined back into it,
+// so it could differ from the content printed from the cluster only by its encoding otherwise.
+func (o *DiffOptions) comparableContent(kind string, content []byte) ([]byte, error) {
+	content, err := o.normalizationRules.Normalize(kind, content, o.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	obj := map[string]interface{}{}
+	if err := yaml.Unmarshal(content, &obj); err != nil {
+		return nil, err
+	}
+	return normalize.Encode(obj, o.Format)
+}
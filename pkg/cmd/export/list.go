@@ -2,27 +2,31 @@ package export
 
 import (
 	"fmt"
-	"strings"
 	"sync"
+	"time"
 
-	"github.com/vbehar/openshift-git/pkg/git"
 	"github.com/vbehar/openshift-git/pkg/openshift"
+	"github.com/vbehar/openshift-git/pkg/store"
 
 	"github.com/openshift/origin/pkg/util/parallel"
 
 	kapi "k8s.io/kubernetes/pkg/api"
 	"k8s.io/kubernetes/pkg/api/meta"
 	"k8s.io/kubernetes/pkg/api/unversioned"
+	"k8s.io/kubernetes/pkg/client/cache"
 	"k8s.io/kubernetes/pkg/kubectl"
 	"k8s.io/kubernetes/pkg/kubectl/resource"
 	"k8s.io/kubernetes/pkg/labels"
 	"k8s.io/kubernetes/pkg/runtime"
+	"k8s.io/kubernetes/pkg/util/sets"
 
 	"github.com/golang/glog"
 )
 
-// runList run the "list" operations in parallel to export the given resources to the given repository
-func runList(resources string, repo *git.Repository) error {
+// runList run the "list" operations in parallel to export the given resources to the given store.
+// All the changes are recorded in a single "snapshot" commit, including the deletion
+// of the resources that don't exist anymore in the cluster.
+func runList(resources string, st store.Store) error {
 	saveWaiter := &sync.WaitGroup{}
 	resourcesChan := make(chan openshift.Resource, 10)
 
@@ -35,10 +39,6 @@ func runList(resources string, repo *git.Repository) error {
 	}
 
 	mapper, _ := openshift.Factory.Object()
-	oclient, kclient, err := openshift.Factory.Clients()
-	if err != nil {
-		return err
-	}
 
 	kinds, err := openshift.KindsFor(mapper, resource.SplitResourceArgument(resources))
 	if err != nil {
@@ -59,39 +59,120 @@ func runList(resources string, repo *git.Repository) error {
 		return err
 	}
 
+	// build the listers before starting the goroutines, which only stop once listedChan is closed
+	listedChan := make(chan openshift.Resource, 10)
+	listers, err := listersFor(kinds, namespace, mapper, listedChan, exportOptions)
+	if err != nil {
+		return err
+	}
+
+	// all the changes are recorded in a single "snapshot" commit
+	batch := st.NewBatch()
+
 	saveWaiter.Add(1)
 	go func() {
 		defer saveWaiter.Done()
-		saveResources(repo, resourcesChan, mapper, printer)
+		saveResources(st, resourcesChan, mapper, printer, batch, newAuthorResolver(mapper, nil), nil)
 	}()
 
-	knownTypes := kapi.Scheme.KnownTypes(kapi.Unversioned)
+	// record the keys of the listed resources,
+	// to find the stale resources in the store at the end
+	listedKeys := map[string]sets.String{}
+	go func() {
+		for resource := range listedChan {
+			gk := resource.GroupKind()
+			if _, found := listedKeys[gk.String()]; !found {
+				listedKeys[gk.String()] = sets.NewString()
+			}
+			listedKeys[gk.String()].Insert(resource.NamespacedName())
+			resourcesChan <- resource
+		}
+		close(resourcesChan)
+	}()
+
+	errs := parallel.Run(listers...)
+
+	close(listedChan)
+	saveWaiter.Wait()
+
+	title := "Snapshot"
+	if len(errs) > 0 {
+		// we can't know which resources have been deleted from the cluster
+		glog.Warningf("Not deleting the stale resources because of %d errors", len(errs))
+		title = "Partial snapshot"
+	} else {
+		if err := deleteStaleResources(st, kinds, namespace, mapper, listedKeys, batch); err != nil {
+			return err
+		}
+	}
+
+	glog.Infof("Committing %d changes...", batch.Len())
+	if err := batch.Commit(fmt.Sprintf("%s at %s", title, time.Now().Format(time.RFC3339))); err != nil {
+		return err
+	}
+
+	if err := st.Push(); err != nil {
+		return fmt.Errorf("Failed to push to %s: %v", st, err)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("Got %d errors: %+v", len(errs), errs)
+	}
+
+	return nil
+}
+
+// deleteStaleResources deletes (and stage in the given batch) the resources of the given kinds
+// that are stored in the store, but have not been listed (they are not in the given listedKeys)
+// - ie that don't exist anymore in the cluster
+func deleteStaleResources(st store.Store, kinds []unversioned.GroupVersionKind, namespace string,
+	mapper meta.RESTMapper, listedKeys map[string]sets.String, batch store.Batch) error {
+
+	staleResources, err := findStaleResources(st, kinds, namespace, mapper, listedKeys, exportOptions)
+	if err != nil {
+		return err
+	}
+
+	for _, stale := range staleResources {
+		stale.resource.Status = string(cache.Deleted)
+		if err := deleteResource(st, stale.resource, batch); err != nil {
+			glog.Errorf("Failed to delete %s: %v", stale.resource.String(), err)
+		}
+	}
+
+	glog.V(1).Infof("Deleted %d stale resources", len(staleResources))
+	return nil
+}
+
+// listersFor returns the "lister" funcs that can be used to list objects of the given kinds,
+// in the given namespace
+func listersFor(kinds []unversioned.GroupVersionKind,
+	namespace string,
+	mapper meta.RESTMapper,
+	resourcesChan chan<- openshift.Resource, exportOptions *ExportOptions) ([]func() error, error) {
 
 	listers := []func() error{}
 	for _, gvk := range kinds {
 		mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		var restClient resource.RESTClient
-		restClient = kclient
-		if kindType, found := knownTypes[gvk.Kind]; found {
-			if strings.Contains(kindType.PkgPath(), "openshift") {
-				restClient = oclient
-			}
+		restClient, err := openshift.RESTClientFor(mapping)
+		if err != nil {
+			return nil, err
 		}
 
 		var lister func() error
 		if mapping.Scope.Name() == meta.RESTScopeNameRoot && !exportOptions.AllNamespaces {
 			switch gvk.Kind {
 			case "Namespace", "Project":
-				lister = listerForNamespace(gvk, namespace, mapper, restClient, resourcesChan, exportOptions.LabelSelector)
+				lister = listerForNamespace(gvk, namespace, mapper, restClient, resourcesChan, exportOptions)
 			default:
 				glog.Warningf("Ignoring root kind %s because you asked for a specific namespace", gvk)
 			}
 		} else {
-			lister = listerFor(gvk, namespace, mapper, restClient, resourcesChan, exportOptions.LabelSelector)
+			lister = listerFor(gvk, namespace, mapper, restClient, resourcesChan, exportOptions)
 		}
 
 		if lister != nil {
@@ -99,14 +180,7 @@ func runList(resources string, repo *git.Repository) error {
 		}
 	}
 
-	if errs := parallel.Run(listers...); len(errs) > 0 {
-		return fmt.Errorf("Got %d errors: %+v", len(errs), errs)
-	}
-
-	close(resourcesChan)
-	saveWaiter.Wait()
-
-	return nil
+	return listers, nil
 }
 
 // listerFor returns a "lister" func that can be used to list objects of the given kind,
@@ -114,7 +188,7 @@ func runList(resources string, repo *git.Repository) error {
 func listerFor(gvk unversioned.GroupVersionKind,
 	namespace string,
 	mapper meta.RESTMapper, restClient resource.RESTClient,
-	resourcesChan chan<- openshift.Resource, labelSelector string) func() error {
+	resourcesChan chan<- openshift.Resource, exportOptions *ExportOptions) func() error {
 
 	if !kapi.Scheme.Recognizes(gvk) {
 		return func() error { return fmt.Errorf("GVK %s not recognizes", gvk) }
@@ -135,7 +209,7 @@ func listerFor(gvk unversioned.GroupVersionKind,
 	glog.V(1).Infof("Listing %s...", gvk.Kind)
 	return (&openshift.ExportLister{
 		ResourcesChan: resourcesChan,
-		LabelSelector: labelSelector,
+		LabelSelector: exportOptions.LabelSelector,
 		ListFunc: func(options kapi.ListOptions) (runtime.Object, error) {
 			return helper.List(namespace, gvk.Version, options.LabelSelector, false)
 		},
@@ -147,7 +221,7 @@ func listerFor(gvk unversioned.GroupVersionKind,
 func listerForNamespace(gvk unversioned.GroupVersionKind,
 	namespace string,
 	mapper meta.RESTMapper, restClient resource.RESTClient,
-	resourcesChan chan<- openshift.Resource, labelSelector string) func() error {
+	resourcesChan chan<- openshift.Resource, exportOptions *ExportOptions) func() error {
 
 	gvkList := gvk.GroupVersion().WithKind(gvk.Kind + "List")
 
@@ -170,7 +244,7 @@ func listerForNamespace(gvk unversioned.GroupVersionKind,
 	glog.V(1).Infof("Getting %s %s...", gvk.Kind, namespace)
 	return (&openshift.ExportLister{
 		ResourcesChan: resourcesChan,
-		LabelSelector: labelSelector,
+		LabelSelector: exportOptions.LabelSelector,
 		ListFunc: func(options kapi.ListOptions) (runtime.Object, error) {
 			obj, err := helper.Get(namespace, namespace, false)
 			if err != nil {
@@ -1,100 +1,330 @@
 package export
 
 import (
+	"bytes"
+	"fmt"
 	"time"
 
-	"github.com/vbehar/openshift-git/pkg/git"
+	"github.com/vbehar/openshift-git/pkg/metrics"
 	"github.com/vbehar/openshift-git/pkg/openshift"
+	"github.com/vbehar/openshift-git/pkg/store"
 
 	"k8s.io/kubernetes/pkg/api/meta"
+	"k8s.io/kubernetes/pkg/api/unversioned"
 	"k8s.io/kubernetes/pkg/kubectl"
 
 	"github.com/golang/glog"
 )
 
-// saveResources saves all the resources coming from the given channel to the given git repository.
-// it pulls/pushes from/to the remote repository at configured interval if the git repository has a remote.
+// saveResources saves all the resources coming from the given channel to the given store.
+// it pulls/pushes from/to the remote repository at configured interval if the store is a git repository with a remote.
+// if a batch is provided, the changes are staged in the batch instead of being committed one by one:
+// - if a commit window is configured, the batch is committed at the end of each window
+// - otherwise, the caller is responsible for committing the batch
+// the author of each change is resolved with the given authors resolver.
+// if a versions tracker is provided, the resource versions of the changes are persisted once committed.
 // should be run in a single goroutine (the git-related operations are not thread-safe)
-func saveResources(repo *git.Repository, resourcesChan <-chan openshift.Resource, mapper meta.RESTMapper, printer kubectl.ResourcePrinter) {
-	var saved, deleted int64
+func saveResources(st store.Store, resourcesChan <-chan openshift.Resource, mapper meta.RESTMapper, printer kubectl.ResourcePrinter,
+	batch store.Batch, authors openshift.AuthorResolver, versions *resourceVersionsTracker) {
+	var saved, unchanged, deleted int64
+	var pushFailures int
 	pullTicker := time.NewTicker(exportOptions.RepositoryPullPeriod)
 	pushTicker := time.NewTicker(exportOptions.RepositoryPushPeriod)
 
+	var windowBatch store.Batch
+	var commitWindowChan <-chan time.Time
+	if batch != nil && exportOptions.CommitWindow > 0 {
+		windowBatch = batch
+		commitWindowTicker := time.NewTicker(exportOptions.CommitWindow)
+		defer commitWindowTicker.Stop()
+		commitWindowChan = commitWindowTicker.C
+	}
+
+	// the snapshots are created at the start of each period (aligned on the period, see store.SnapshotName),
+	// and the missing snapshot of the current period is created on startup (the process may restart more often).
+	// They are created once the commits have been pushed, so that they are never orphaned by a rebase.
+	var tagChan <-chan time.Time
+	var pendingSnapshot time.Time
+	if exportOptions.TagPeriod > 0 {
+		tagTimer := time.NewTimer(nextSnapshotDelay(time.Now(), exportOptions.TagPeriod))
+		defer tagTimer.Stop()
+		tagChan = tagTimer.C
+		pendingSnapshot = time.Now()
+	}
+	snapshotIfPushed := func(pushErr error) {
+		if pushErr != nil || pendingSnapshot.IsZero() {
+			return
+		}
+		snapshotStore(st, pendingSnapshot)
+		pendingSnapshot = time.Time{}
+	}
+
+	// the changes staged in the current commit window
+	var windowChanges []stagedResource
+	commitWindow := func() {
+		if commitBatch(windowBatch) {
+			for _, staged := range windowChanges {
+				metrics.ObserveCommitLag(staged.receivedAt)
+			}
+			windowChanges = nil
+			versions.commit()
+		} else {
+			// the changes will be handled again by the next run,
+			// so their versions (and the next ones) can't be persisted
+			for _, staged := range windowChanges {
+				versions.fail(staged.gk, staged.key, staged.receivedAt)
+			}
+			windowChanges = nil
+		}
+	}
+
 	for {
 		select {
 
 		case <-pullTicker.C:
-			if err := repo.Pull(); err != nil {
-				glog.Errorf("Failed to pull from %s: %v", repo.RemoteURL, err)
+			commitWindow()
+			if batch != nil && batch.Len() > 0 {
+				// can't rebase with staged changes, let's wait for the batch to be committed
+				glog.V(2).Infof("Not pulling from %s because of %d uncommitted changes", st, batch.Len())
+				continue
 			}
+			pullStore(st)
 
 		case <-pushTicker.C:
-			if err := repo.Push(); err != nil {
-				glog.Errorf("Failed to push to %s: %v", repo.RemoteURL, err)
+			commitWindow()
+			err := pushStore(st)
+			if err != nil {
+				pushFailures++
+				glog.Errorf("Failed to push to %s (%d consecutive failures): %v", st, pushFailures, err)
+			} else {
+				pushFailures = 0
+			}
+			snapshotIfPushed(err)
+
+		case <-commitWindowChan:
+			commitWindow()
+
+		case now := <-tagChan:
+			tagChan = time.After(nextSnapshotDelay(now, exportOptions.TagPeriod))
+			commitWindow()
+			pendingSnapshot = now
+			err := pushStore(st)
+			if err != nil {
+				glog.Errorf("Failed to push to %s before creating a snapshot: %v", st, err)
 			}
+			snapshotIfPushed(err)
 
 		case resource, open := <-resourcesChan:
 			if !open {
-				glog.Infof("Closing ! Stats: %d resources saved, and %d resources deleted.", saved, deleted)
+				commitWindow()
+				glog.Infof("Closing ! Stats: %d resources saved, %d resources unchanged, and %d resources deleted.", saved, unchanged, deleted)
 				return
 			}
 
+			resource.Author = authors.AuthorFor(&resource)
+
+			var err error
+			changed := true
 			if resource.Exists {
-				if err := saveResource(repo, &resource, mapper, printer); err != nil {
+				if changed, err = saveResource(st, &resource, mapper, printer, batch); err != nil {
 					glog.Errorf("Failed to save %s: %v", resource.String(), err)
+				} else if !changed {
+					unchanged++
+					metrics.ResourcesUnchanged.WithLabelValues(resource.Kind).Inc()
 				} else {
 					saved++
+					metrics.ResourcesSaved.WithLabelValues(resource.Kind).Inc()
 				}
 			} else {
-				if err := deleteResource(repo, &resource); err != nil {
+				if err = deleteResource(st, &resource, batch); err != nil {
 					glog.Errorf("Failed to delete %s: %v", resource.String(), err)
 				} else {
 					deleted++
+					metrics.ResourcesDeleted.WithLabelValues(resource.Kind).Inc()
+				}
+			}
+
+			if err != nil {
+				versions.fail(resource.GroupKind(), resource.NamespacedName(), resource.ReceivedAt)
+			} else {
+				versions.observe(&resource)
+				switch {
+				case !changed:
+					// nothing to commit - but the versions of the changes staged
+					// in the current commit window can't be persisted before them
+					if windowBatch == nil || windowBatch.Len() == 0 {
+						versions.commit()
+					}
+				case batch == nil:
+					metrics.ObserveCommitLag(resource.ReceivedAt)
+					versions.commit()
+				case windowBatch != nil:
+					windowChanges = append(windowChanges, stagedResource{
+						gk:         resource.GroupKind(),
+						key:        resource.NamespacedName(),
+						receivedAt: resource.ReceivedAt,
+					})
 				}
 			}
+
+			if windowBatch != nil && exportOptions.CommitWindowSize > 0 && windowBatch.Len() >= exportOptions.CommitWindowSize {
+				commitWindow()
+			}
+		}
+	}
+}
+
+// stagedResource is a change of a resource, staged in a commit window
+type stagedResource struct {
+	gk         unversioned.GroupKind
+	key        string
+	receivedAt time.Time
+}
+
+// nextSnapshotDelay returns the delay from the given time
+// until the start of the next period (see store.SnapshotName)
+func nextSnapshotDelay(now time.Time, period time.Duration) time.Duration {
+	return now.Truncate(period).Add(period).Sub(now)
+}
+
+// snapshotStore creates a snapshot of the given store (a tag on the last commit of a git repository),
+// and deletes the snapshots older than the configured retention (if any).
+func snapshotStore(st store.Store, now time.Time) {
+	name, err := st.CreateSnapshot(now, exportOptions.TagPeriod)
+	if err != nil {
+		glog.Errorf("Failed to create a snapshot: %v", err)
+	} else if len(name) > 0 {
+		glog.V(1).Infof("Created snapshot %s", name)
+	}
+
+	if exportOptions.TagRetention > 0 {
+		deleted, err := st.PruneSnapshots(now.Add(-exportOptions.TagRetention))
+		if err != nil {
+			glog.Errorf("Failed to delete the old snapshots: %v", err)
+		}
+		if len(deleted) > 0 {
+			glog.V(1).Infof("Deleted %d old snapshots: %v", len(deleted), deleted)
 		}
 	}
 }
 
-// saveResource saves (and commit) the single given resource to the given git repository
-func saveResource(repo *git.Repository, resource *openshift.Resource, mapper meta.RESTMapper, printer kubectl.ResourcePrinter) error {
+// commitBatch commits the changes accumulated in the given batch (if any)
+// Returns false if the commit failed.
+func commitBatch(batch store.Batch) bool {
+	if batch == nil || batch.Len() == 0 {
+		return true
+	}
+
+	count := batch.Len()
+	glog.V(1).Infof("Committing %d changes...", count)
+	if err := batch.Commit(fmt.Sprintf("Update of %d resources", count)); err != nil {
+		metrics.CommitFailures.Inc()
+		glog.Errorf("Failed to commit %d changes: %v", count, err)
+		return false
+	}
+	return true
+}
+
+// pullStore pulls from the remote of the given store (if any), and records the metrics
+func pullStore(st store.Store) {
+	start := time.Now()
+	err := st.Pull()
+	metrics.PullDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		metrics.PullFailures.Inc()
+		glog.Errorf("Failed to pull from %s: %v", st, err)
+	}
+}
+
+// pushStore pushes to the remote of the given store (if any), and records the metrics
+func pushStore(st store.Store) error {
+	start := time.Now()
+	err := st.Push()
+	metrics.PushDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		metrics.PushFailures.Inc()
+	}
+	return err
+}
+
+// saveResource saves (and commit) the single given resource to the given store
+// or stage it in the given batch (if not nil).
+// Returns false if the resource is already stored with the same content:
+// in this case, nothing is written.
+func saveResource(st store.Store, resource *openshift.Resource, mapper meta.RESTMapper, printer kubectl.ResourcePrinter, batch store.Batch) (bool, error) {
 	glog.V(2).Infof("Saving %s", resource)
 
 	printer, err := upgradePrinterForObject(printer, resource.Object, mapper)
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	gitResource := git.NewGitResource(repo, resource, exportOptions.Format)
+	content := &bytes.Buffer{}
+	if err := printer.PrintObj(resource.Object, content); err != nil {
+		return false, err
+	}
 
-	if err := gitResource.Open(); err != nil {
-		return err
+	preparedContent, err := exportOptions.prepareContent(resource.Kind, content.Bytes())
+	if err != nil {
+		return false, err
 	}
 
-	if err := printer.PrintObj(resource.Object, gitResource); err != nil {
-		gitResource.Close()
-		return err
+	preparedContent, sidecarFiles, err := exportOptions.splitter.Split(resource.Kind, preparedContent, exportOptions.Format)
+	if err != nil {
+		return false, err
 	}
-	gitResource.Close()
 
-	if err = gitResource.Commit(); err != nil {
-		return err
+	stored := st.Resource(resource, exportOptions.Format)
+	if stored.IsUnchanged(store.ContentHash(preparedContent, sidecarFiles)) {
+		glog.V(3).Infof("Skipping %s: unchanged", resource)
+		return false, nil
 	}
 
-	return nil
+	if err := stored.Open(); err != nil {
+		return false, err
+	}
+
+	if _, err := stored.Write(preparedContent); err != nil {
+		stored.Close()
+		return false, err
+	}
+	if err := stored.Close(); err != nil {
+		return false, err
+	}
+
+	if err := stored.WriteSidecarFiles(sidecarFiles); err != nil {
+		return false, err
+	}
+
+	if batch != nil {
+		return true, batch.Add(stored)
+	}
+
+	if err := stored.Commit(); err != nil {
+		metrics.CommitFailures.Inc()
+		return false, err
+	}
+
+	return true, nil
 }
 
-// deleteResource deletes (and commit) the single given resource from the given git repository
-func deleteResource(repo *git.Repository, resource *openshift.Resource) error {
+// deleteResource deletes (and commit) the single given resource from the given store
+// or stage it in the given batch (if not nil)
+func deleteResource(st store.Store, resource *openshift.Resource, batch store.Batch) error {
 	glog.V(3).Infof("Deleting %s", resource.String())
 
-	gitResource := git.NewGitResource(repo, resource, exportOptions.Format)
+	stored := st.Resource(resource, exportOptions.Format)
 
-	if err := gitResource.Delete(); err != nil {
+	if err := stored.Delete(); err != nil {
 		return err
 	}
 
-	if err := gitResource.Commit(); err != nil {
+	if batch != nil {
+		return batch.Add(stored)
+	}
+
+	if err := stored.Commit(); err != nil {
+		metrics.CommitFailures.Inc()
 		return err
 	}
 
@@ -0,0 +1,121 @@
+package export
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/vbehar/openshift-git/pkg/openshift"
+	"github.com/vbehar/openshift-git/pkg/store"
+
+	"k8s.io/kubernetes/pkg/api/meta"
+	"k8s.io/kubernetes/pkg/api/unversioned"
+	"k8s.io/kubernetes/pkg/labels"
+	"k8s.io/kubernetes/pkg/util/sets"
+
+	"github.com/ghodss/yaml"
+)
+
+// storedResource represents a resource stored in a store
+type storedResource struct {
+	// path is the full absolute path of the file in which the resource is stored
+	path string
+
+	// resource is a (minimalist) representation of the resource
+	resource *openshift.Resource
+}
+
+// findStaleResources returns the resources of the given kinds stored in the given store (in the configured format),
+// that are not in the given listedKeys (per kind - with its API group) - ie that don't exist anymore in the cluster.
+// It only returns the resources that would have been listed with the given options
+// (with the same selector and default requirements as the listers), in the given namespace.
+func findStaleResources(st store.Store, kinds []unversioned.GroupVersionKind, namespace string,
+	mapper meta.RESTMapper, listedKeys map[string]sets.String, exportOptions *ExportOptions) ([]storedResource, error) {
+
+	staleResources := []storedResource{}
+	for _, gvk := range kinds {
+		mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			return nil, err
+		}
+		rootScoped := mapping.Scope.Name() == meta.RESTScopeNameRoot
+
+		if rootScoped && !exportOptions.AllNamespaces {
+			switch gvk.Kind {
+			case "Namespace", "Project":
+			default:
+				continue
+			}
+		}
+
+		var requirements []func() (*labels.Requirement, error)
+		if exportOptions.UseDefaultSelector {
+			requirements = DefaultRequirementsFor(gvk)
+		}
+		selector, err := openshift.SelectorFor(nil, exportOptions.LabelSelector, requirements...)
+		if err != nil {
+			return nil, err
+		}
+
+		gk := gvk.GroupKind()
+		err = st.WalkResources(func(path string, r *openshift.Resource) error {
+			if !st.IsResourceOfKind(r, gk) || listedKeys[gk.String()].Has(r.NamespacedName()) {
+				return nil
+			}
+			if filepath.Ext(path) != "."+exportOptions.Format {
+				return nil
+			}
+			if !exportOptions.AllNamespaces {
+				if rootScoped && r.Name != namespace {
+					return nil
+				}
+				if !rootScoped && r.Namespace != namespace {
+					return nil
+				}
+			}
+
+			matches, err := fileMatchesSelector(path, selector)
+			if err != nil {
+				return err
+			}
+			if !matches {
+				return nil
+			}
+
+			staleResources = append(staleResources, storedResource{
+				path:     path,
+				resource: r,
+			})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return staleResources, nil
+}
+
+// fileMatchesSelector returns true if the labels of the resource stored
+// in the file at the given path matches the given selector
+func fileMatchesSelector(path string, selector labels.Selector) (bool, error) {
+	if selector.Empty() {
+		return true, nil
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+
+	var object struct {
+		Metadata struct {
+			Labels map[string]string `json:"labels"`
+		} `json:"metadata"`
+	}
+	if err := yaml.Unmarshal(content, &object); err != nil {
+		return false, fmt.Errorf("Failed to read labels from %s: %v", path, err)
+	}
+
+	return selector.Matches(labels.Set(object.Metadata.Labels)), nil
+}
@@ -0,0 +1,78 @@
+package export
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/vbehar/openshift-git/pkg/openshift"
+	"github.com/vbehar/openshift-git/pkg/store"
+
+	kapi "k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/unversioned"
+	"k8s.io/kubernetes/pkg/util/sets"
+)
+
+func TestFindStaleResources(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stale-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	st, err := store.NewDirectoryStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, content := range map[string]string{
+		"foo/listed":  "metadata:\n  labels:\n    app: web\n",
+		"foo/deleted": "metadata:\n  labels:\n    app: web\n",
+		"foo/build":   "metadata:\n  labels:\n    app: web\n    openshift.io/build.name: web-1\n",
+		"foo/other":   "metadata:\n  labels:\n    app: db\n",
+		"bar/deleted": "metadata:\n  labels:\n    app: web\n",
+	} {
+		r := st.Resource(openshift.NewResource("Pod", key), "yaml")
+		if err := r.Open(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := r.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	kinds := []unversioned.GroupVersionKind{{Version: "v1", Kind: "Pod"}}
+	gk := unversioned.GroupKind{Kind: "Pod"}
+	listedKeys := map[string]sets.String{
+		gk.String(): sets.NewString("foo/listed"),
+	}
+	options := &ExportOptions{
+		Format:             "yaml",
+		LabelSelector:      "app=web",
+		UseDefaultSelector: true,
+	}
+
+	staleResources, err := findStaleResources(st, kinds, "foo", kapi.RESTMapper, listedKeys, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale := []string{}
+	for _, r := range staleResources {
+		rel, err := filepath.Rel(dir, r.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stale = append(stale, filepath.ToSlash(rel))
+	}
+	sort.Strings(stale)
+
+	// the pods of the builds are not listed (see DefaultRequirementsFor), so they are never stale
+	if expected := []string{"Namespace/foo/Pod/deleted.yaml"}; !reflect.DeepEqual(stale, expected) {
+		t.Errorf("Expected the stale resources %v, but got %v", expected, stale)
+	}
+}
@@ -0,0 +1,221 @@
+package export
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/vbehar/openshift-git/pkg/openshift"
+	"github.com/vbehar/openshift-git/pkg/store"
+
+	"k8s.io/kubernetes/pkg/api/unversioned"
+	"k8s.io/kubernetes/pkg/client/cache"
+
+	"github.com/golang/glog"
+)
+
+// resourceVersionsTracker keeps track of the resource versions (per kind) of the changes
+// saved in the store, and persists them once they have been committed,
+// so that the watches can be resumed from there on restart.
+// The version of a kind is not persisted while a change of a resource of this kind has failed
+// (or is being retried), until a change of the same resource received later is committed:
+// on restart, the watch is resumed from before the failed change, which is handled again.
+// The versions of the changes from a (re)list are only persisted once the list has been handled
+// (see synced), so that a version is persisted even for the kinds which never change.
+// It is safe for concurrent use.
+type resourceVersionsTracker struct {
+	store store.Store
+	scope string
+
+	lock sync.Mutex
+
+	// versions are the persisted versions
+	versions map[string]string
+
+	// pending are the versions of the changes not committed yet
+	pending map[string]string
+
+	// listed are the highest versions of the changes from a (re)list
+	listed map[string]string
+
+	// synced is an (optional) function that returns true once the initial list
+	// of the resources of the given kind has been handled
+	synced func(kind string) bool
+
+	// pendingChanges are the times at which the changes not committed yet have been received,
+	// per key ("namespace/name" format) and kind
+	pendingChanges map[string]map[string]time.Time
+
+	// failedChanges are the times at which the failed changes have been received,
+	// per key and kind
+	failedChanges map[string]map[string]time.Time
+}
+
+// newResourceVersionsTracker instantiates a new tracker for the given store,
+// with the versions persisted by a previous run for the same scope (see resourceVersionsScope).
+func newResourceVersionsTracker(st store.Store, scope string) (*resourceVersionsTracker, error) {
+	versions, err := st.LoadResourceVersions(scope)
+	if err != nil {
+		return nil, err
+	}
+	return &resourceVersionsTracker{
+		store:          st,
+		scope:          scope,
+		versions:       versions,
+		pending:        map[string]string{},
+		listed:         map[string]string{},
+		pendingChanges: map[string]map[string]time.Time{},
+		failedChanges:  map[string]map[string]time.Time{},
+	}, nil
+}
+
+// resourceVersionsScope returns a representation of what is watched - in the given cluster
+// and namespace (empty for all namespaces), with the given options:
+// the persisted versions can't be used to resume watches with a different scope.
+func resourceVersionsScope(clusterName, namespace string, options *ExportOptions) string {
+	return fmt.Sprintf("cluster=%s namespace=%s all-namespaces=%v selector=%s default-selector=%v",
+		clusterName, namespace, options.AllNamespaces,
+		options.LabelSelector, options.UseDefaultSelector)
+}
+
+// snapshot returns a copy of the persisted versions (per kind)
+func (t *resourceVersionsTracker) snapshot() map[string]string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	versions := map[string]string{}
+	for kind, version := range t.versions {
+		versions[kind] = version
+	}
+	return versions
+}
+
+// observe records the version of the given (saved) resource.
+// The changes from a (re)list are not ordered: only the highest of their versions is recorded.
+// All the changes up to this version are reflected in the listed resources,
+// so the watch can be resumed from there once they have all been handled
+// - it may only replay some changes, which are then skipped.
+func (t *resourceVersionsTracker) observe(resource *openshift.Resource) {
+	if t == nil || resource.ObjectReference == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	gk := resource.GroupKind()
+	kind := gk.String()
+	recordChange(t.pendingChanges, kind, resource.NamespacedName(), resource.ReceivedAt)
+
+	if len(resource.ResourceVersion) == 0 {
+		return
+	}
+	if resource.Status == string(cache.Sync) {
+		if isNewerResourceVersion(resource.ResourceVersion, t.listed[kind]) {
+			t.listed[kind] = resource.ResourceVersion
+		}
+		return
+	}
+	t.pending[kind] = resource.ResourceVersion
+}
+
+// fail records that the change of the resource with the given kind and key ("namespace/name" format),
+// received at the given time, has failed - or could not be committed.
+func (t *resourceVersionsTracker) fail(gk unversioned.GroupKind, key string, receivedAt time.Time) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	recordChange(t.failedChanges, gk.String(), key, receivedAt)
+}
+
+// failureFuncFor returns a function that records the failed changes of the resources
+// of the given kind (see fail) - for an openshift.ExportController
+func (t *resourceVersionsTracker) failureFuncFor(gk unversioned.GroupKind) func(key string) {
+	return func(key string) {
+		t.fail(gk, key, time.Now())
+	}
+}
+
+// commit persists the versions observed since the last commit,
+// except for the kinds with failed changes - or whose list has not been handled yet.
+// It should be called once the changes have been committed.
+func (t *resourceVersionsTracker) commit() {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	// the failed changes are replaced by the changes received after them
+	for kind, changes := range t.pendingChanges {
+		failed := t.failedChanges[kind]
+		for key, receivedAt := range changes {
+			if failedAt, found := failed[key]; found && receivedAt.After(failedAt) {
+				delete(failed, key)
+			}
+		}
+		if failed != nil && len(failed) == 0 {
+			delete(t.failedChanges, kind)
+		}
+	}
+	t.pendingChanges = map[string]map[string]time.Time{}
+
+	changed := false
+	for kind, version := range t.pending {
+		if _, failed := t.failedChanges[kind]; failed {
+			glog.V(3).Infof("Not persisting the resource version %s of %s because of %d failed changes", version, kind, len(t.failedChanges[kind]))
+			continue
+		}
+		t.versions[kind] = version
+		delete(t.pending, kind)
+		changed = true
+	}
+	for kind, version := range t.listed {
+		if _, failed := t.failedChanges[kind]; failed {
+			continue
+		}
+		if t.synced != nil && !t.synced(kind) {
+			continue
+		}
+		if isNewerResourceVersion(version, t.versions[kind]) {
+			t.versions[kind] = version
+			changed = true
+		}
+		delete(t.listed, kind)
+	}
+	if !changed {
+		return
+	}
+
+	if err := t.store.SaveResourceVersions(t.scope, t.versions); err != nil {
+		glog.Errorf("Failed to save the resource versions: %v", err)
+	}
+}
+
+// recordChange records the (latest) time at which the change of the resource
+// with the given kind and key has been received
+func recordChange(changes map[string]map[string]time.Time, kind, key string, receivedAt time.Time) {
+	if _, found := changes[kind]; !found {
+		changes[kind] = map[string]time.Time{}
+	}
+	if receivedAt.After(changes[kind][key]) {
+		changes[kind][key] = receivedAt
+	}
+}
+
+// isNewerResourceVersion returns true if the given resource version is newer than the given current version,
+// or if there is no current version. The versions are compared as numbers:
+// if they are not, the version can't be known to be newer.
+func isNewerResourceVersion(version, current string) bool {
+	v, err := strconv.ParseUint(version, 10, 64)
+	if err != nil {
+		return false
+	}
+	if len(current) == 0 {
+		return true
+	}
+	c, err := strconv.ParseUint(current, 10, 64)
+	return err == nil && v > c
+}
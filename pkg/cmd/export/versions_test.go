@@ -0,0 +1,150 @@
+package export
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/vbehar/openshift-git/pkg/openshift"
+	"github.com/vbehar/openshift-git/pkg/store"
+)
+
+// commitResourceVersion records and persists the given resource version of a service,
+// with a tracker for the given scope
+func commitResourceVersion(t *testing.T, st store.Store, scope, resourceVersion string) {
+	tracker, err := newResourceVersionsTracker(st, scope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resource := openshift.NewResource("Service", "foo/a")
+	resource.ResourceVersion = resourceVersion
+	resource.Status = "modified"
+	resource.ReceivedAt = time.Now()
+	tracker.observe(resource)
+	tracker.commit()
+}
+
+func TestResourceVersionsTrackerScope(t *testing.T) {
+	dir, err := ioutil.TempDir("", "versions-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	st, err := store.NewDirectoryStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	options := &ExportOptions{UseDefaultSelector: true}
+	scope := resourceVersionsScope("https://cluster-a:8443", "foo", options)
+	commitResourceVersion(t, st, scope, "42")
+
+	tests := []struct {
+		name            string
+		scope           string
+		expectedVersion string
+	}{
+		{
+			name:            "same scope",
+			scope:           resourceVersionsScope("https://cluster-a:8443", "foo", options),
+			expectedVersion: "42",
+		},
+		{
+			name:  "other namespace",
+			scope: resourceVersionsScope("https://cluster-a:8443", "bar", options),
+		},
+		{
+			name:  "all namespaces",
+			scope: resourceVersionsScope("https://cluster-a:8443", "", &ExportOptions{AllNamespaces: true, UseDefaultSelector: true}),
+		},
+		{
+			name:  "other cluster",
+			scope: resourceVersionsScope("https://cluster-b:8443", "foo", options),
+		},
+		{
+			name:  "other selector",
+			scope: resourceVersionsScope("https://cluster-a:8443", "foo", &ExportOptions{LabelSelector: "app=foo", UseDefaultSelector: true}),
+		},
+	}
+
+	for _, test := range tests {
+		tracker, err := newResourceVersionsTracker(st, test.scope)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		versions := tracker.snapshot()
+		if version := versions["Service"]; version != test.expectedVersion {
+			t.Errorf("%s: expected the resource version '%s', got '%s'", test.name, test.expectedVersion, version)
+		}
+		if len(test.expectedVersion) == 0 && len(versions) > 0 {
+			t.Errorf("%s: expected no resource versions, got %v", test.name, versions)
+		}
+	}
+}
+
+func TestResourceVersionsTrackerListedVersions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "versions-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	st, err := store.NewDirectoryStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tracker, err := newResourceVersionsTracker(st, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	synced := false
+	tracker.synced = func(kind string) bool {
+		return synced
+	}
+
+	for _, listed := range []struct {
+		key             string
+		resourceVersion string
+	}{
+		{key: "foo/a", resourceVersion: "12"},
+		{key: "foo/b", resourceVersion: "35"},
+		{key: "foo/c", resourceVersion: "7"},
+	} {
+		resource := openshift.NewResource("Service", listed.key)
+		resource.ResourceVersion = listed.resourceVersion
+		resource.Status = "Sync"
+		resource.ReceivedAt = time.Now()
+		tracker.observe(resource)
+	}
+
+	// the list has not been handled yet
+	tracker.commit()
+	if versions := tracker.snapshot(); len(versions) != 0 {
+		t.Errorf("Expected no versions before the list has been handled, but got %v", versions)
+	}
+
+	synced = true
+	tracker.commit()
+	if version := tracker.snapshot()["Service"]; version != "35" {
+		t.Errorf("Expected the highest listed version 35, but got '%s'", version)
+	}
+
+	// the versions of the changes from a relist don't go back in time
+	resource := openshift.NewResource("Service", "foo/a")
+	resource.ResourceVersion = "20"
+	resource.Status = "Sync"
+	resource.ReceivedAt = time.Now()
+	tracker.observe(resource)
+	tracker.commit()
+
+	reloaded, err := newResourceVersionsTracker(st, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version := reloaded.snapshot()["Service"]; version != "35" {
+		t.Errorf("Expected the persisted version 35, but got '%s'", version)
+	}
+}
@@ -4,13 +4,13 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
-	"strings"
 	"sync"
 	"syscall"
 	"time"
 
-	"github.com/vbehar/openshift-git/pkg/git"
+	"github.com/vbehar/openshift-git/pkg/metrics"
 	"github.com/vbehar/openshift-git/pkg/openshift"
+	"github.com/vbehar/openshift-git/pkg/store"
 
 	kapi "k8s.io/kubernetes/pkg/api"
 	"k8s.io/kubernetes/pkg/api/meta"
@@ -25,7 +25,7 @@ import (
 )
 
 // runWatch run the export controllers for the given resources
-func runWatch(resources string, repo *git.Repository) error {
+func runWatch(resources string, st store.Store) error {
 	saveWaiter := &sync.WaitGroup{}
 	stopChan := make(chan struct{})
 	resourcesChan := make(chan openshift.Resource, 10)
@@ -39,10 +39,6 @@ func runWatch(resources string, repo *git.Repository) error {
 	}
 
 	mapper, _ := openshift.Factory.Object()
-	oclient, kclient, err := openshift.Factory.Clients()
-	if err != nil {
-		return err
-	}
 
 	kinds, err := openshift.KindsFor(mapper, resource.SplitResourceArgument(resources))
 	if err != nil {
@@ -63,13 +59,98 @@ func runWatch(resources string, repo *git.Repository) error {
 		return err
 	}
 
+	var batch store.Batch
+	if exportOptions.CommitWindow > 0 {
+		batch = st.NewBatch()
+	}
+
+	controllers := &runningControllers{}
+
+	// the versions from which the watches are resumed
+	var versions *resourceVersionsTracker
+	resumeVersions := map[string]string{}
+	if exportOptions.ResumeWatch {
+		scope := resourceVersionsScope(openshift.ClusterName(exportOptions.ClusterName), namespace, exportOptions)
+		if versions, err = newResourceVersionsTracker(st, scope); err != nil {
+			return err
+		}
+		resumeVersions = versions.snapshot()
+		versions.synced = controllers.hasSynced
+	}
+
 	saveWaiter.Add(1)
 	go func() {
 		defer saveWaiter.Done()
-		saveResources(repo, resourcesChan, mapper, printer)
+		saveResources(st, resourcesChan, mapper, printer, batch, newAuthorResolver(mapper, stopChan), versions)
+	}()
+
+	if len(exportOptions.ListenAddress) > 0 {
+		metrics.RegisterBacklog(func() int {
+			return len(resourcesChan)
+		})
+		metrics.ListenAndServe(exportOptions.ListenAddress, controllers.checkSynced, st.CheckWritable)
+	}
+
+	// on shutdown (or if a controller fails to start), stop the reflectors,
+	// wait for the changes being handled, and then commit everything
+	// - so that the store can be closed once the saver is done
+	shutdown := func() {
+		close(stopChan)
+		controllers.stop()
+		close(resourcesChan)
+		saveWaiter.Wait()
+	}
+
+	if err := startControllers(kinds, namespace, resumeVersions, mapper, stopChan, resourcesChan, st, versions, controllers); err != nil {
+		shutdown()
+		return err
+	}
+	controllers.setStarted()
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	<-c
+	glog.Infof("Interrupted by user (or killed) ! Shutting down...")
+	shutdown()
+
+	// and push a last time, so that no history is lost
+	glog.Infof("Pushing the last commits...")
+	if err := pushWithTimeout(st, exportOptions.ShutdownPushTimeout); err != nil {
+		return fmt.Errorf("Failed to push to %s: %v", st, err)
+	}
+
+	return nil
+}
+
+// pushWithTimeout pushes to the remote of the given store (if any),
+// and gives up after the given timeout (if not zero): the push is stopped (its git command is killed),
+// and it returns right away - closing the store then waits for the push to be done.
+func pushWithTimeout(st store.Store, timeout time.Duration) error {
+	if timeout <= 0 {
+		return pushStore(st)
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		result <- pushStore(st)
 	}()
 
-	knownTypes := kapi.Scheme.KnownTypes(kapi.Unversioned)
+	select {
+	case err := <-result:
+		return err
+	case <-time.After(timeout):
+		glog.Warningf("Push to %s timed out after %v, stopping it...", st, timeout)
+		st.StopPush()
+		return fmt.Errorf("Timed out after %v", timeout)
+	}
+}
+
+// startControllers starts the export controllers for the given kinds, in the given namespace
+// - resuming the watches from the given resource versions (per kind, with its API group) -
+// and adds them to the given running controllers.
+func startControllers(kinds []unversioned.GroupVersionKind, namespace string, resumeVersions map[string]string,
+	mapper meta.RESTMapper, stopChan <-chan struct{}, resourcesChan chan<- openshift.Resource,
+	st store.Store, versions *resourceVersionsTracker, controllers *runningControllers) error {
 
 	for _, gvk := range kinds {
 		mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
@@ -77,64 +158,57 @@ func runWatch(resources string, repo *git.Repository) error {
 			return err
 		}
 
-		var restClient resource.RESTClient
-		restClient = kclient
-		if kindType, found := knownTypes[gvk.Kind]; found {
-			if strings.Contains(kindType.PkgPath(), "openshift") {
-				restClient = oclient
-			}
+		restClient, err := openshift.RESTClientFor(mapping)
+		if err != nil {
+			return err
 		}
 
+		gk := gvk.GroupKind()
+		resourceVersion := resumeVersions[gk.String()]
+
+		var controller *openshift.ExportController
 		if mapping.Scope.Name() == meta.RESTScopeNameRoot && !exportOptions.AllNamespaces {
 			switch gvk.Kind {
 			case "Namespace", "Project":
-				if err := runControllerForNamespace(gvk, namespace, mapper, restClient, stopChan, resourcesChan, repo, exportOptions); err != nil {
+				if controller, err = runControllerForNamespace(gvk, namespace, resourceVersion, mapper, restClient, stopChan, resourcesChan, st, versions, exportOptions); err != nil {
 					return err
 				}
 			default:
 				glog.Warningf("Ignoring root kind %s because you asked for a specific namespace", gvk)
 			}
 		} else {
-			if err := runController(gvk, namespace, mapper, restClient, stopChan, resourcesChan, repo, exportOptions); err != nil {
+			if controller, err = runController(gvk, namespace, resourceVersion, mapper, restClient, stopChan, resourcesChan, st, versions, exportOptions); err != nil {
 				return err
 			}
 		}
+		if controller != nil {
+			controllers.add(gvk, controller)
+		}
 	}
-
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, os.Kill, syscall.SIGTERM)
-	select {
-	case <-c:
-		glog.Infof("Interrupted by user (or killed) !")
-		close(stopChan)
-		time.Sleep(1 * time.Second)
-		close(resourcesChan)
-		saveWaiter.Wait()
-	}
-
 	return nil
 }
 
 // runController starts an export controller (in a new goroutine) for the given kind,
-// in the given namespace
+// in the given namespace - resuming the watch from the given resource version (if any).
+// The failed changes are recorded by the given versions tracker (if any).
 func runController(gvk unversioned.GroupVersionKind,
-	namespace string,
+	namespace, resourceVersion string,
 	mapper meta.RESTMapper, restClient resource.RESTClient,
 	stopChan <-chan struct{}, resourcesChan chan<- openshift.Resource,
-	repo *git.Repository, exportOptions *ExportOptions) error {
+	st store.Store, versions *resourceVersionsTracker, exportOptions *ExportOptions) (*openshift.ExportController, error) {
 
 	if !kapi.Scheme.Recognizes(gvk) {
-		return fmt.Errorf("GVK %s not recognizes", gvk)
+		return nil, fmt.Errorf("GVK %s not recognizes", gvk)
 	}
 
 	obj, err := kapi.Scheme.New(gvk)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	helper := resource.NewHelper(restClient, mapping)
@@ -145,47 +219,53 @@ func runController(gvk unversioned.GroupVersionKind,
 	}
 
 	glog.V(1).Infof("Starting export controller for %s", gvk.Kind)
-	(&openshift.ExportController{
+	controller := &openshift.ExportController{
 		ResourcesChan: resourcesChan,
 		LabelSelector: exportOptions.LabelSelector,
 		ResyncPeriod:  exportOptions.ResyncPeriod,
 		Kind:          obj,
-		KeyListFunc:   repo.KeyListFuncForKind(gvk.Kind),
-		KeyGetFunc:    repo.KeyGetFuncForKindAndFormat(gvk.Kind, exportOptions.Format),
+		KeyListFunc:   st.KeyListFuncForGroupKind(gvk.GroupKind()),
+		KeyGetFunc:    st.KeyGetFuncForGroupKindAndFormat(gvk.GroupKind(), exportOptions.Format),
 		ListFunc: func(options kapi.ListOptions) (runtime.Object, error) {
 			return helper.List(namespace, gvk.Version, options.LabelSelector, false)
 		},
 		WatchFunc: func(options kapi.ListOptions) (watch.Interface, error) {
 			return helper.Watch(namespace, options.ResourceVersion, gvk.Version, options.LabelSelector)
 		},
-		Requirements: requirements,
-	}).RunUntil(stopChan)
+		Requirements:    requirements,
+		ResourceVersion: resourceVersion,
+		FailureFunc:     versions.failureFuncFor(gvk.GroupKind()),
+	}
+	controller.RunUntil(stopChan)
 
-	return nil
+	return controller, nil
 }
 
 // runControllerForNamespace starts an export controller (in a new goroutine)
 // that can be used to export a single namespace/project.
+// it watches the single namespace/project if allowed, or polls it otherwise
+// - resuming from the given resource version (if any).
+// The failed changes are recorded by the given versions tracker (if any).
 func runControllerForNamespace(gvk unversioned.GroupVersionKind,
-	namespace string,
+	namespace, resourceVersion string,
 	mapper meta.RESTMapper, restClient resource.RESTClient,
 	stopChan <-chan struct{}, resourcesChan chan<- openshift.Resource,
-	repo *git.Repository, exportOptions *ExportOptions) error {
+	st store.Store, versions *resourceVersionsTracker, exportOptions *ExportOptions) (*openshift.ExportController, error) {
 
 	gvkList := gvk.GroupVersion().WithKind(gvk.Kind + "List")
 
 	if !kapi.Scheme.Recognizes(gvk) {
-		return fmt.Errorf("GVK %s not recognizes", gvk)
+		return nil, fmt.Errorf("GVK %s not recognizes", gvk)
 	}
 
 	obj, err := kapi.Scheme.New(gvk)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	helper := resource.NewHelper(restClient, mapping)
@@ -195,14 +275,17 @@ func runControllerForNamespace(gvk unversioned.GroupVersionKind,
 		requirements = DefaultRequirementsFor(gvk)
 	}
 
+	// true if we can't watch the namespace, and need to poll it instead
+	polling := false
+
 	glog.V(1).Infof("Starting export controller for %s %s...", gvk.Kind, namespace)
-	(&openshift.ExportController{
+	controller := &openshift.ExportController{
 		ResourcesChan: resourcesChan,
 		LabelSelector: exportOptions.LabelSelector,
 		ResyncPeriod:  exportOptions.ResyncPeriod,
 		Kind:          obj,
-		KeyListFunc:   repo.KeyListFuncForKind(gvk.Kind),
-		KeyGetFunc:    repo.KeyGetFuncForKindAndFormat(gvk.Kind, exportOptions.Format),
+		KeyListFunc:   st.KeyListFuncForGroupKind(gvk.GroupKind()),
+		KeyGetFunc:    st.KeyGetFuncForGroupKindAndFormat(gvk.GroupKind(), exportOptions.Format),
 		ListFunc: func(options kapi.ListOptions) (runtime.Object, error) {
 			obj, err := helper.Get(namespace, namespace, false)
 			if err != nil {
@@ -223,14 +306,108 @@ func runControllerForNamespace(gvk unversioned.GroupVersionKind,
 				return nil, err
 			}
 
+			// use the resourceVersion of the namespace, so that the watch starts from there
+			accessor, err := meta.Accessor(obj)
+			if err != nil {
+				return nil, err
+			}
+			listMeta, err := kapi.ListMetaFor(listObject)
+			if err != nil {
+				return nil, err
+			}
+			listMeta.ResourceVersion = accessor.GetResourceVersion()
+
 			return listObject, nil
 		},
 		WatchFunc: func(options kapi.ListOptions) (watch.Interface, error) {
-			// can't watch a single specific namespace, so let's watch nothing for the moment
-			return watch.NewFake(), nil
+			if !polling {
+				w, err := helper.WatchSingle("", namespace, options.ResourceVersion)
+				if err == nil {
+					return w, nil
+				}
+				// we may not be allowed to watch the namespace (or the API may not support it),
+				// so let's poll it instead
+				glog.Warningf("Failed to watch %s %s, polling it every %v instead: %v", gvk.Kind, namespace, exportOptions.NamespacePollPeriod, err)
+				polling = true
+			}
+
+			return openshift.NewPollWatcher(func() (runtime.Object, error) {
+				obj, err := helper.Get(namespace, namespace, false)
+				if err != nil {
+					return nil, err
+				}
+				return kapi.Scheme.ConvertToVersion(obj, gvk.Version)
+			}, options.ResourceVersion, exportOptions.NamespacePollPeriod), nil
 		},
-		Requirements: requirements,
-	}).RunUntil(stopChan)
+		Requirements:    requirements,
+		ResourceVersion: resourceVersion,
+		FailureFunc:     versions.failureFuncFor(gvk.GroupKind()),
+	}
+	controller.RunUntil(stopChan)
+
+	return controller, nil
+}
+
+// runningControllers keeps track of the running export controllers,
+// to check if they have synced
+type runningControllers struct {
+	sync.Mutex
+	controllers map[string]*openshift.ExportController
+	started     bool
+}
+
+// add adds the given running controller for the given kind
+func (c *runningControllers) add(gvk unversioned.GroupVersionKind, controller *openshift.ExportController) {
+	c.Lock()
+	defer c.Unlock()
+	if c.controllers == nil {
+		c.controllers = map[string]*openshift.ExportController{}
+	}
+	gk := gvk.GroupKind()
+	c.controllers[gk.String()] = controller
+}
+
+// setStarted records that all the controllers have been started
+func (c *runningControllers) setStarted() {
+	c.Lock()
+	defer c.Unlock()
+	c.started = true
+}
 
+// stop stops all the controllers, and waits for the changes being handled
+func (c *runningControllers) stop() {
+	c.Lock()
+	controllers := []*openshift.ExportController{}
+	for _, controller := range c.controllers {
+		controllers = append(controllers, controller)
+	}
+	c.Unlock()
+
+	for _, controller := range controllers {
+		controller.Stop()
+	}
+}
+
+// hasSynced returns true if the controller of the given kind (with its API group) is running,
+// and has handled the initial list of the resources
+func (c *runningControllers) hasSynced(kind string) bool {
+	c.Lock()
+	defer c.Unlock()
+	controller, found := c.controllers[kind]
+	return found && controller.HasSynced()
+}
+
+// checkSynced returns an error if the controllers are not all started and synced
+func (c *runningControllers) checkSynced() error {
+	c.Lock()
+	defer c.Unlock()
+	if !c.started {
+		return fmt.Errorf("The export controllers are not started yet")
+	}
+	for kind, controller := range c.controllers {
+		if !controller.HasSynced() {
+			return fmt.Errorf("The export controller for %s has not synced yet", kind)
+		}
+	}
 	return nil
 }
@@ -0,0 +1,59 @@
+package export
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vbehar/openshift-git/pkg/store"
+)
+
+// blockingPushStore is a store whose pushes are blocked until they are stopped
+type blockingPushStore struct {
+	store.Store
+
+	stop   chan struct{}
+	pushed chan struct{}
+}
+
+func (s *blockingPushStore) String() string {
+	return "blocking-store"
+}
+
+func (s *blockingPushStore) Push() error {
+	defer close(s.pushed)
+	<-s.stop
+	// like a git command which takes some time to be interrupted
+	time.Sleep(50 * time.Millisecond)
+	return fmt.Errorf("push stopped")
+}
+
+func (s *blockingPushStore) StopPush() {
+	close(s.stop)
+}
+
+func TestPushWithTimeout(t *testing.T) {
+	st := &blockingPushStore{
+		stop:   make(chan struct{}),
+		pushed: make(chan struct{}),
+	}
+
+	err := pushWithTimeout(st, 10*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "Timed out") {
+		t.Errorf("Expected a timeout error, but got %v", err)
+	}
+
+	// the push is stopped, but it does not wait for it to be done
+	select {
+	case <-st.stop:
+	default:
+		t.Errorf("Expected the push to be stopped")
+	}
+	select {
+	case <-st.pushed:
+		t.Errorf("Expected to return before the push is done")
+	default:
+	}
+	<-st.pushed
+}
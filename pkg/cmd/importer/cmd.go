@@ -1,7 +1,11 @@
 package importer
 
 import (
+	"fmt"
+
 	"github.com/vbehar/openshift-git/pkg/cmd"
+	"github.com/vbehar/openshift-git/pkg/encrypt"
+	"github.com/vbehar/openshift-git/pkg/git"
 	"github.com/vbehar/openshift-git/pkg/openshift"
 
 	"github.com/golang/glog"
@@ -9,24 +13,99 @@ import (
 )
 
 var (
-	importCmd = &cobra.Command{
-		Use:   "import",
-		Short: "Import OpenShift resources from a Git repository",
-		Long: `
+	importCmdLongDescription = `
 Imports OpenShift resources from a Git repository.
 
+It reads the resources previously exported by the 'export' command (in YAML or JSON format)
+from the local repository, and creates them - or updates them if they already exist - in the cluster.
+
+It expects a comma-separated list of types to import, like buildconfig, pods, routes and so on.
+You can use the special 'all' alias (expanded by OpenShift to [bc builds is dc rc routes svc pods]),
+or the recommended 'everything' alias (expanded by openshift-git to %[1]s).
+
+The '--repository-path' flag is mandatory: it defines where the repository is stored on the filesystem.
+
 Note that it behaves like the standard OpenShift Client (oc) to connect to the OpenShift Cluster.
 By default, if a ~/.kube/config file exists, it will be used.
 Otherwise, you can use the same option as the OpenShift Client (oc):
 --config to use a custom kube config file
---server and --token to specify the master URL and (service account) token directly`,
-		Run: func(cmd *cobra.Command, args []string) {
-			glog.Fatal("The import command is not implemented yet!")
+--server and --token to specify the master URL and (service account) token directly`
+	importCmdExample = `
+	# Basic usage: import everything from the Git repository at /tmp/export to the current namespace
+	$ %[1]s everything --repository-path=/tmp/export
+
+	# Import specific types to the "my-namespace" namespace
+	$ %[1]s bc,dc,is,svc,route -n my-namespace --repository-path=/tmp/export
+
+	# Import everything for all namespaces
+	# Note that it requires at least the cluster-admin role
+	$ %[1]s everything --all-namespaces --repository-path=/tmp/export`
+
+	importCmd = &cobra.Command{
+		Use:   "import TYPE",
+		Short: "Import OpenShift resources from a Git repository",
+		PreRunE: func(command *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return fmt.Errorf("Missing import type.")
+			}
+			if len(importOptions.RepositoryPath) == 0 {
+				return fmt.Errorf("Missing repository path.")
+			}
+			if len(importOptions.EncryptionKeyFile) > 0 {
+				encrypter, err := encrypt.NewEncrypterFromFile(importOptions.EncryptionKeyFile, nil)
+				if err != nil {
+					return err
+				}
+				importOptions.encrypter = encrypter
+			}
+			return nil
+		},
+		Run: func(command *cobra.Command, args []string) {
+			repo, err := git.OpenExistingRepository(importOptions.RepositoryPath,
+				importOptions.RepositoryContextDir)
+			if err != nil {
+				glog.Fatalf("Failed to open git repo: %v", err)
+			}
+			repo.ClusterName = openshift.ClusterName(importOptions.ClusterName)
+			if err := repo.SetLayout(importOptions.RepositoryLayout, importOptions.RepositoryGroupLayout); err != nil {
+				glog.Fatalf("Invalid layout: %v", err)
+			}
+
+			if err = runImport(args[0], repo); err != nil {
+				glog.Fatalf("Failed: %v", err)
+			}
 		},
 	}
+
+	importOptions = &ImportOptions{}
 )
 
 func init() {
 	cmd.RootCmd.AddCommand(importCmd)
+	importCmd.Long = fmt.Sprintf(importCmdLongDescription, openshift.AllKinds)
+	importCmd.Example = fmt.Sprintf(importCmdExample, cmd.FullName(importCmd))
 	importCmd.Flags().AddFlagSet(openshift.Flags)
+	importCmd.Flags().StringVar(&importOptions.RepositoryPath, "repository-path", "", "Mandatory. Path of the git repository on the filesystem.")
+	importCmd.Flags().StringVar(&importOptions.RepositoryContextDir, "repository-context-dir", "", "Optional relative directory (in the repository) that is used to store data.")
+	importCmd.Flags().StringVar(&importOptions.ClusterName, "cluster-name", "", "Name of the cluster, used if the layout of the repository contains {cluster}. Defaults to the URL of the OpenShift API server.")
+	importCmd.Flags().StringVar(&importOptions.RepositoryLayout, "repository-layout", "", "Optional template of the layout of the resources in the repository, like 'clusters/{cluster}/{namespace}/{kind}/{name}'. Supported variables are {cluster}, {namespace}, {kind}, {group}, {name} and {label:KEY} ({namespace}, {kind} and {name} are mandatory). Parts between brackets are omitted if their variables are empty. Defaults to '[Namespace/{namespace}/]{kind}/{name}'.")
+	importCmd.Flags().BoolVar(&importOptions.RepositoryGroupLayout, "repository-group-layout", false, "If present (and no custom layout is provided), the directories of the kinds are qualified with their API group (like 'Deployment.extensions'), so that kinds with the same name in different API groups don't collide.")
+	importCmd.Flags().StringVarP(&importOptions.LabelSelector, "selector", "l", "", "Selector (label query) to filter on")
+	importCmd.Flags().StringVar(&importOptions.EncryptionKeyFile, "encryption-key-file", "", "Optional path of the file containing the secret key used to decrypt the encrypted fields (like the data of the secrets).")
+	importCmd.Flags().BoolVar(&importOptions.AllNamespaces, "all-namespaces", false, "If present, import the requested resources across all namespaces. Namespace in current context is ignored even if specified with --namespace.")
+}
+
+// ImportOptions represents the options of the import command
+type ImportOptions struct {
+	AllNamespaces         bool
+	ClusterName           string
+	LabelSelector         string
+	RepositoryPath        string
+	RepositoryContextDir  string
+	RepositoryLayout      string
+	RepositoryGroupLayout bool
+	EncryptionKeyFile     string
+
+	// encrypter is used to decrypt the resources (nil if there is no EncryptionKeyFile)
+	encrypter *encrypt.Encrypter
 }
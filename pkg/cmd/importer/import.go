@@ -0,0 +1,193 @@
+package importer
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/vbehar/openshift-git/pkg/git"
+	"github.com/vbehar/openshift-git/pkg/openshift"
+	"github.com/vbehar/openshift-git/pkg/store"
+
+	kapi "k8s.io/kubernetes/pkg/api"
+	kerrors "k8s.io/kubernetes/pkg/api/errors"
+	"k8s.io/kubernetes/pkg/api/meta"
+	"k8s.io/kubernetes/pkg/api/unversioned"
+	"k8s.io/kubernetes/pkg/kubectl/resource"
+	"k8s.io/kubernetes/pkg/labels"
+	"k8s.io/kubernetes/pkg/runtime"
+
+	"github.com/golang/glog"
+)
+
+// runImport imports the given resources from the given repository to the cluster
+func runImport(resources string, repo *git.Repository) error {
+	var imported, ignored, failed int64
+
+	namespace, _, err := openshift.Factory.DefaultNamespace()
+	if err != nil {
+		return err
+	}
+	if importOptions.AllNamespaces {
+		namespace = kapi.NamespaceAll
+	}
+
+	selector, err := labels.Parse(importOptions.LabelSelector)
+	if err != nil {
+		return err
+	}
+
+	mapper, _ := openshift.Factory.Object()
+
+	kinds, err := openshift.KindsFor(mapper, resource.SplitResourceArgument(resources))
+	if err != nil {
+		return err
+	}
+	if len(kinds) == 0 {
+		return fmt.Errorf("No valid kinds for '%s'", resources)
+	}
+
+	if importOptions.AllNamespaces {
+		glog.Infof("Running import for kinds %v for all namespaces", kinds)
+	} else {
+		glog.Infof("Running import for kinds %v for namespace %s", kinds, namespace)
+	}
+
+	// import the root-scoped kinds first,
+	// so that the namespaces exists before we import their content
+	rootKinds := []unversioned.GroupVersionKind{}
+	namespacedKinds := []unversioned.GroupVersionKind{}
+	for _, gvk := range kinds {
+		mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			return err
+		}
+		if mapping.Scope.Name() == meta.RESTScopeNameRoot {
+			rootKinds = append(rootKinds, gvk)
+		} else {
+			namespacedKinds = append(namespacedKinds, gvk)
+		}
+	}
+
+	for _, gvk := range append(rootKinds, namespacedKinds...) {
+		mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			return err
+		}
+
+		rootScoped := mapping.Scope.Name() == meta.RESTScopeNameRoot
+		if rootScoped && !importOptions.AllNamespaces {
+			switch gvk.Kind {
+			case "Namespace", "Project":
+			default:
+				glog.Warningf("Ignoring root kind %s because you asked for a specific namespace", gvk)
+				continue
+			}
+		}
+
+		restClient, err := openshift.RESTClientFor(mapping)
+		if err != nil {
+			return err
+		}
+		helper := resource.NewHelper(restClient, mapping)
+
+		glog.V(1).Infof("Importing %s...", gvk.Kind)
+		gk := gvk.GroupKind()
+		err = repo.WalkResources(func(path string, r *openshift.Resource) error {
+			if !repo.IsResourceOfKind(r, gk) {
+				return nil
+			}
+			if !importOptions.AllNamespaces {
+				if rootScoped && r.Name != namespace {
+					return nil
+				}
+				if !rootScoped && r.Namespace != namespace {
+					return nil
+				}
+			}
+
+			done, err := importResource(helper, gvk, path, r, selector)
+			switch {
+			case err != nil:
+				glog.Errorf("Failed to import %s from %s: %v", r, path, err)
+				failed++
+			case done:
+				imported++
+			default:
+				ignored++
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	glog.Infof("Stats: %d resources imported, %d resources ignored, and %d failures.", imported, ignored, failed)
+	if failed > 0 {
+		return fmt.Errorf("Failed to import %d resources", failed)
+	}
+
+	return nil
+}
+
+// importResource creates (or updates if it already exists) the single given resource,
+// stored at the given path, in the cluster.
+// Returns false if the resource has been ignored because it does not match the given selector.
+func importResource(helper *resource.Helper, gvk unversioned.GroupVersionKind, path string, r *openshift.Resource, selector labels.Selector) (bool, error) {
+	glog.V(2).Infof("Importing %s from %s", r, path)
+
+	data, err := store.ReadResourceFile(path)
+	if err != nil {
+		return false, err
+	}
+
+	if data, err = importOptions.encrypter.Decrypt(data, strings.TrimPrefix(filepath.Ext(path), ".")); err != nil {
+		return false, err
+	}
+
+	obj, err := runtime.Decode(kapi.Codecs.UniversalDecoder(), data)
+	if err != nil {
+		return false, err
+	}
+
+	objGVK, err := kapi.Scheme.ObjectKind(obj)
+	if err != nil {
+		return false, err
+	}
+	if objGVK.Kind != gvk.Kind {
+		return false, fmt.Errorf("expected kind %s but found %s", gvk.Kind, objGVK.Kind)
+	}
+
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return false, err
+	}
+	if !selector.Matches(labels.Set(accessor.GetLabels())) {
+		glog.V(3).Infof("Ignoring %s: labels %v does not match selector %s", r, accessor.GetLabels(), selector)
+		return false, nil
+	}
+
+	// the namespace is not stored in the exported content,
+	// we need to restore it from the location of the resource
+	accessor.SetNamespace(r.Namespace)
+	accessor.SetName(r.Name)
+
+	if _, err := helper.Get(r.Namespace, r.Name, false); err != nil {
+		if !kerrors.IsNotFound(err) {
+			return false, err
+		}
+
+		glog.V(2).Infof("Creating %s", r)
+		if _, err := helper.Create(r.Namespace, true, obj); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+
+	glog.V(2).Infof("Updating %s", r)
+	if _, err := helper.Replace(r.Namespace, r.Name, true, obj); err != nil {
+		return false, err
+	}
+	return true, nil
+}
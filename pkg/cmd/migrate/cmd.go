@@ -0,0 +1,108 @@
+package migrate
+
+import (
+	"fmt"
+
+	"github.com/vbehar/openshift-git/pkg/cmd"
+	"github.com/vbehar/openshift-git/pkg/git"
+	"github.com/vbehar/openshift-git/pkg/layout"
+	"github.com/vbehar/openshift-git/pkg/openshift"
+
+	"github.com/golang/glog"
+	"github.com/spf13/cobra"
+)
+
+var (
+	migrateCmdLongDescription = `
+Migrates a Git repository from a layout to another.
+
+It moves all the resources stored in the repository with the '--from-layout' layout
+to the paths defined by the '--to-layout' layout, and records the changes in a single commit (that you can then push).
+The resources are not read from the cluster: the fields used by the new layout are read
+from the current paths, and from the content of the files (for the labels and the API group).
+If a resource can't be moved, all the resources are moved back, and nothing is committed.
+
+A layout is a template, like 'clusters/{cluster}/{namespace}/{kind}/{name}'.
+The supported variables are {cluster}, {namespace}, {kind}, {group}, {name} and {label:KEY}.
+The parts between brackets are omitted if their variables are empty.
+The default layout is '%[1]s'.
+
+The '--repository-path' and '--to-layout' flags are mandatory.`
+	migrateCmdExample = `
+	# Migrate from the default layout to a layout with the namespaces at the root of the repository
+	$ %[1]s --repository-path=/tmp/export --to-layout='[{namespace}/]{kind}/{name}'
+
+	# Migrate to a layout with one directory per application (based on the "app" label)
+	$ %[1]s --repository-path=/tmp/export --to-layout='[{namespace}/]{label:app}/{kind}/{name}'`
+
+	migrateCmd = &cobra.Command{
+		Use:   "migrate",
+		Short: "Migrate a Git repository to a new layout",
+		PreRunE: func(command *cobra.Command, args []string) error {
+			if len(migrateOptions.RepositoryPath) == 0 {
+				return fmt.Errorf("Missing repository path.")
+			}
+			if len(migrateOptions.ToLayout) == 0 {
+				return fmt.Errorf("Missing target layout.")
+			}
+			return nil
+		},
+		Run: func(command *cobra.Command, args []string) {
+			if err := git.ConfigureSigning(migrateOptions.Signing); err != nil {
+				glog.Fatalf("Invalid signing configuration: %v", err)
+			}
+
+			repo, err := git.OpenExistingRepository(migrateOptions.RepositoryPath,
+				migrateOptions.RepositoryContextDir)
+			if err != nil {
+				glog.Fatalf("Failed to open git repo: %v", err)
+			}
+
+			repo.ClusterName = openshift.ClusterName(migrateOptions.ClusterName)
+			if err := repo.SetLayout(migrateOptions.FromLayout, false); err != nil {
+				glog.Fatalf("Invalid layout: %v", err)
+			}
+
+			to, err := layout.New(migrateOptions.ToLayout)
+			if err != nil {
+				glog.Fatalf("Invalid layout: %v", err)
+			}
+			for _, l := range []*layout.Layout{repo.Layout, to} {
+				if l.HasVariable("cluster") && len(repo.ClusterName) == 0 {
+					glog.Fatalf("Missing cluster name for the layout %s", l.Template)
+				}
+			}
+
+			moved, err := repo.MigrateLayout(to)
+			if err != nil {
+				glog.Fatalf("Failed to migrate: %v", err)
+			}
+			glog.Infof("Moved %d resources from %s to %s", moved, migrateOptions.FromLayout, migrateOptions.ToLayout)
+		},
+	}
+
+	migrateOptions = &MigrateOptions{}
+)
+
+func init() {
+	cmd.RootCmd.AddCommand(migrateCmd)
+	migrateCmd.Long = fmt.Sprintf(migrateCmdLongDescription, layout.DefaultTemplate)
+	migrateCmd.Example = fmt.Sprintf(migrateCmdExample, cmd.FullName(migrateCmd))
+	migrateCmd.Flags().StringVar(&migrateOptions.RepositoryPath, "repository-path", "", "Mandatory. Path of the git repository on the filesystem.")
+	migrateCmd.Flags().StringVar(&migrateOptions.RepositoryContextDir, "repository-context-dir", "", "Optional relative directory (in the repository) that is used to store data.")
+	migrateCmd.Flags().StringVar(&migrateOptions.FromLayout, "from-layout", layout.DefaultTemplate, "Current layout of the repository.")
+	migrateCmd.Flags().StringVar(&migrateOptions.ToLayout, "to-layout", "", "Mandatory. New layout of the repository.")
+	migrateCmd.Flags().StringVar(&migrateOptions.ClusterName, "cluster-name", "", "Name of the cluster, used if one of the layouts contains {cluster}. Defaults to the URL of the OpenShift API server (as for the export).")
+	migrateCmd.Flags().StringVar(&migrateOptions.Signing.KeyFile, "signing-key-file", "", "Optional path of a private key (GPG or SSH, see '--signing-format') used to sign the commit.")
+	migrateCmd.Flags().StringVar(&migrateOptions.Signing.Format, "signing-format", git.SigningFormatGPG, "Format of the signing key ('gpg' or 'ssh').")
+}
+
+// MigrateOptions represents the options of the migrate command
+type MigrateOptions struct {
+	RepositoryPath       string
+	RepositoryContextDir string
+	FromLayout           string
+	ToLayout             string
+	ClusterName          string
+	Signing              git.SigningConfig
+}
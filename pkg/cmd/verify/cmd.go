@@ -0,0 +1,83 @@
+package verify
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/vbehar/openshift-git/pkg/cmd"
+	"github.com/vbehar/openshift-git/pkg/git"
+
+	"github.com/golang/glog"
+	"github.com/spf13/cobra"
+)
+
+var (
+	verifyCmdLongDescription = `
+Verifies that the commits of a Git repository are signed with a given key.
+
+It checks that every commit of the '--repository-branch' branch (or only the commits after the '--since' revision)
+is signed with the key provided with the '--signing-key-file' flag - the same key used by the 'export' command,
+or its public key. It prints the commits that are not signed, and exits with a non-zero status if there is any.
+
+The '--repository-path' and '--signing-key-file' flags are mandatory.`
+	verifyCmdExample = `
+	# Verify that all the commits are signed with the given GPG key
+	$ %[1]s --repository-path=/tmp/export --signing-key-file=/path/to/key.asc
+
+	# Verify that all the commits after the initial import are signed with the given SSH key
+	$ %[1]s --repository-path=/tmp/export --signing-key-file=/path/to/id_ed25519.pub --signing-format=ssh --since=abc123`
+
+	verifyCmd = &cobra.Command{
+		Use:   "verify",
+		Short: "Verify the signatures of the commits of a Git repository",
+		PreRunE: func(command *cobra.Command, args []string) error {
+			if len(verifyOptions.RepositoryPath) == 0 {
+				return fmt.Errorf("Missing repository path.")
+			}
+			if len(verifyOptions.Signing.KeyFile) == 0 {
+				return fmt.Errorf("Missing signing key file.")
+			}
+			return verifyOptions.Signing.Validate()
+		},
+		Run: func(command *cobra.Command, args []string) {
+			revisionRange := verifyOptions.RepositoryBranch
+			if len(verifyOptions.Since) > 0 {
+				revisionRange = fmt.Sprintf("%s..%s", verifyOptions.Since, verifyOptions.RepositoryBranch)
+			}
+
+			unsigned, err := git.VerifyCommits(verifyOptions.RepositoryPath, revisionRange, verifyOptions.Signing)
+			if err != nil {
+				glog.Fatalf("Failed to verify the commits: %v", err)
+			}
+
+			for _, commit := range unsigned {
+				fmt.Fprintf(os.Stdout, "%s is not signed with %s\n", commit, verifyOptions.Signing.KeyFile)
+			}
+			if len(unsigned) > 0 {
+				os.Exit(1)
+			}
+			glog.Infof("All the commits of %s are signed with %s", revisionRange, verifyOptions.Signing.KeyFile)
+		},
+	}
+
+	verifyOptions = &VerifyOptions{}
+)
+
+func init() {
+	cmd.RootCmd.AddCommand(verifyCmd)
+	verifyCmd.Long = verifyCmdLongDescription
+	verifyCmd.Example = fmt.Sprintf(verifyCmdExample, cmd.FullName(verifyCmd))
+	verifyCmd.Flags().StringVar(&verifyOptions.RepositoryPath, "repository-path", "", "Mandatory. Path of the git repository on the filesystem.")
+	verifyCmd.Flags().StringVar(&verifyOptions.RepositoryBranch, "repository-branch", "master", "Branch of the git repository to verify.")
+	verifyCmd.Flags().StringVar(&verifyOptions.Since, "since", "", "Optional revision (excluded) from which the commits are verified, to ignore the commits made before the signing was enabled.")
+	verifyCmd.Flags().StringVar(&verifyOptions.Signing.KeyFile, "signing-key-file", "", "Mandatory. Path of the key used to sign the commits (or of its public key).")
+	verifyCmd.Flags().StringVar(&verifyOptions.Signing.Format, "signing-format", git.SigningFormatGPG, "Format of the signing key ('gpg' or 'ssh').")
+}
+
+// VerifyOptions represents the options of the verify command
+type VerifyOptions struct {
+	RepositoryPath   string
+	RepositoryBranch string
+	Since            string
+	Signing          git.SigningConfig
+}
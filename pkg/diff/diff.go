@@ -0,0 +1,269 @@
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+const (
+	// contextLines is the number of unchanged lines printed around each change
+	// in a unified diff
+	contextLines = 3
+
+	// maxEditScriptCells is the maximum size of the table of the longest common subsequence
+	// (the product of the numbers of changed lines), above which the changed lines
+	// are just replaced, to limit the time and memory used by the diffs of large files
+	maxEditScriptCells = 1 << 22
+)
+
+// Unified returns a unified diff (like `diff -u`) between the given contents,
+// using the given names for the headers.
+// Returns an empty string if both contents are identical.
+func Unified(from, to []byte, fromName, toName string) string {
+	if bytes.Equal(from, to) {
+		return ""
+	}
+
+	a := splitLines(from)
+	b := splitLines(to)
+	ops := editScript(a, b)
+
+	out := &bytes.Buffer{}
+	fmt.Fprintf(out, "--- %s\n", fromName)
+	fmt.Fprintf(out, "+++ %s\n", toName)
+
+	for start := 0; start < len(ops); {
+		// find the next change
+		for start < len(ops) && ops[start].kind == ' ' {
+			start++
+		}
+		if start == len(ops) {
+			break
+		}
+
+		// extend the hunk until we find enough unchanged lines
+		hunkStart := start - contextLines
+		if hunkStart < 0 {
+			hunkStart = 0
+		}
+		end := start
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			unchanged := 0
+			for end+unchanged < len(ops) && ops[end+unchanged].kind == ' ' {
+				unchanged++
+			}
+			if end+unchanged == len(ops) || unchanged > 2*contextLines {
+				end += contextLines
+				if end > len(ops) {
+					end = len(ops)
+				}
+				break
+			}
+			end += unchanged
+		}
+
+		writeHunk(out, ops[hunkStart:end])
+		start = end
+	}
+
+	return out.String()
+}
+
+// Fields returns the list of the fields (in a "path.to.field" format)
+// that are different between the given YAML or JSON contents.
+func Fields(from, to []byte) ([]string, error) {
+	var a, b interface{}
+	if err := yaml.Unmarshal(from, &a); err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(to, &b); err != nil {
+		return nil, err
+	}
+
+	fields := []string{}
+	compareValues("", a, b, &fields)
+	sort.Strings(fields)
+	return fields, nil
+}
+
+// compareValues compares recursively the given values,
+// and appends to fields the paths of the values that are different
+func compareValues(path string, a, b interface{}, fields *[]string) {
+	mapA, okA := a.(map[string]interface{})
+	mapB, okB := b.(map[string]interface{})
+	if okA && okB {
+		keys := map[string]struct{}{}
+		for k := range mapA {
+			keys[k] = struct{}{}
+		}
+		for k := range mapB {
+			keys[k] = struct{}{}
+		}
+		for k := range keys {
+			compareValues(joinPath(path, k), mapA[k], mapB[k], fields)
+		}
+		return
+	}
+
+	sliceA, okA := a.([]interface{})
+	sliceB, okB := b.([]interface{})
+	if okA && okB && len(sliceA) == len(sliceB) {
+		for i := range sliceA {
+			compareValues(fmt.Sprintf("%s[%d]", path, i), sliceA[i], sliceB[i], fields)
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(a, b) {
+		*fields = append(*fields, path)
+	}
+}
+
+// joinPath appends the given key to the given fields path
+func joinPath(path, key string) string {
+	if len(path) == 0 {
+		return key
+	}
+	return path + "." + key
+}
+
+// op is a single operation of an edit script:
+// an unchanged (' '), deleted ('-') or inserted ('+') line
+type op struct {
+	kind       byte
+	line       string
+	fromLineNo int
+	toLineNo   int
+}
+
+// editScript returns the shortest list of operations to transform a into b:
+// the common first and last lines are unchanged, and the lines in between are compared
+// based on their longest common subsequence - or just replaced if there are too many of them
+// (see maxEditScriptCells)
+func editScript(a, b []string) []op {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	ops := make([]op, 0, len(a)+len(b)-prefix-suffix)
+	for i := 0; i < prefix; i++ {
+		ops = append(ops, op{kind: ' ', line: a[i], fromLineNo: i, toLineNo: i})
+	}
+
+	middleA, middleB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	if len(middleA)*len(middleB) > maxEditScriptCells {
+		ops = append(ops, replaceScript(middleA, middleB, prefix, prefix)...)
+	} else {
+		ops = append(ops, lcsScript(middleA, middleB, prefix, prefix)...)
+	}
+
+	for k := 0; k < suffix; k++ {
+		i, j := len(a)-suffix+k, len(b)-suffix+k
+		ops = append(ops, op{kind: ' ', line: a[i], fromLineNo: i, toLineNo: j})
+	}
+	return ops
+}
+
+// lcsScript returns the shortest list of operations to transform a into b,
+// based on the longest common subsequence of lines.
+// The line numbers of the operations start at the given offsets.
+func lcsScript(a, b []string, fromOffset, toOffset int) []op {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	ops := []op{}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = append(ops, op{kind: ' ', line: a[i], fromLineNo: fromOffset + i, toLineNo: toOffset + j})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, op{kind: '-', line: a[i], fromLineNo: fromOffset + i, toLineNo: toOffset + j})
+			i++
+		default:
+			ops = append(ops, op{kind: '+', line: b[j], fromLineNo: fromOffset + i, toLineNo: toOffset + j})
+			j++
+		}
+	}
+	return ops
+}
+
+// replaceScript returns the operations to replace all the lines of a with the lines of b.
+// The line numbers of the operations start at the given offsets.
+func replaceScript(a, b []string, fromOffset, toOffset int) []op {
+	ops := make([]op, 0, len(a)+len(b))
+	for i := range a {
+		ops = append(ops, op{kind: '-', line: a[i], fromLineNo: fromOffset + i, toLineNo: toOffset})
+	}
+	for j := range b {
+		ops = append(ops, op{kind: '+', line: b[j], fromLineNo: fromOffset + len(a), toLineNo: toOffset + j})
+	}
+	return ops
+}
+
+// writeHunk writes a single hunk (header and lines) of a unified diff
+func writeHunk(out *bytes.Buffer, ops []op) {
+	var fromCount, toCount int
+	for _, o := range ops {
+		if o.kind != '+' {
+			fromCount++
+		}
+		if o.kind != '-' {
+			toCount++
+		}
+	}
+
+	fromStart, toStart := ops[0].fromLineNo, ops[0].toLineNo
+	if fromCount > 0 {
+		fromStart++
+	}
+	if toCount > 0 {
+		toStart++
+	}
+
+	fmt.Fprintf(out, "@@ -%d,%d +%d,%d @@\n", fromStart, fromCount, toStart, toCount)
+	for _, o := range ops {
+		fmt.Fprintf(out, "%c%s\n", o.kind, o.line)
+	}
+}
+
+// splitLines splits the given content in lines
+// (ignoring the trailing newline)
+func splitLines(content []byte) []string {
+	s := strings.TrimSuffix(string(content), "\n")
+	if len(s) == 0 {
+		return []string{}
+	}
+	return strings.Split(s, "\n")
+}
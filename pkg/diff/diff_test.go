@@ -0,0 +1,104 @@
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		from           string
+		to             string
+		expectedResult string
+	}{
+		{
+			from:           "a\nb\nc\n",
+			to:             "a\nb\nc\n",
+			expectedResult: "",
+		},
+		{
+			from:           "a\nb\nc\n",
+			to:             "a\nB\nc\n",
+			expectedResult: "--- from\n+++ to\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		},
+		{
+			from:           "",
+			to:             "a\n",
+			expectedResult: "--- from\n+++ to\n@@ -0,0 +1,1 @@\n+a\n",
+		},
+		{
+			from:           "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+			to:             "0\n1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n",
+			expectedResult: "--- from\n+++ to\n@@ -1,3 +1,4 @@\n+0\n 1\n 2\n 3\n@@ -9,4 +10,3 @@\n 9\n 10\n 11\n-12\n",
+		},
+	}
+
+	for count, test := range tests {
+		result := Unified([]byte(test.from), []byte(test.to), "from", "to")
+		if result != test.expectedResult {
+			t.Errorf("Test[%d] Failed: Expected '%s' but got '%s'", count, test.expectedResult, result)
+		}
+	}
+}
+
+func TestUnifiedLargeFiles(t *testing.T) {
+	from, to := &bytes.Buffer{}, &bytes.Buffer{}
+	from.WriteString("header\n")
+	to.WriteString("header\n")
+	for i := 0; i < 3000; i++ {
+		fmt.Fprintf(from, "a%d\n", i)
+		fmt.Fprintf(to, "b%d\n", i)
+	}
+	from.WriteString("footer\n")
+	to.WriteString("footer\n")
+
+	result := Unified(from.Bytes(), to.Bytes(), "from", "to")
+	lines := strings.Split(strings.TrimSuffix(result, "\n"), "\n")
+	if expected := "@@ -1,3002 +1,3002 @@"; lines[2] != expected {
+		t.Fatalf("Expected the hunk header '%s' but got '%s'", expected, lines[2])
+	}
+	if expected := 2 + 1 + 2 + 2*3000; len(lines) != expected {
+		t.Errorf("Expected %d lines but got %d", expected, len(lines))
+	}
+	if lines[4] != "-a0" || lines[3004] != "+b0" || lines[len(lines)-1] != " footer" {
+		t.Errorf("Expected all the lines to be replaced but got '%s', '%s' and '%s'", lines[4], lines[3004], lines[len(lines)-1])
+	}
+}
+
+func TestFields(t *testing.T) {
+	tests := []struct {
+		from           string
+		to             string
+		expectedResult []string
+	}{
+		{
+			from:           "a: 1\nb: 2\n",
+			to:             `{"b": 2, "a": 1}`,
+			expectedResult: []string{},
+		},
+		{
+			from:           "metadata:\n  name: foo\n  labels:\n    app: foo\nspec:\n  replicas: 1\n",
+			to:             "metadata:\n  name: foo\nspec:\n  replicas: 2\n",
+			expectedResult: []string{"metadata.labels", "spec.replicas"},
+		},
+		{
+			from:           "spec:\n  ports:\n  - port: 80\n  - port: 443\n",
+			to:             "spec:\n  ports:\n  - port: 8080\n  - port: 443\n",
+			expectedResult: []string{"spec.ports[0].port"},
+		},
+	}
+
+	for count, test := range tests {
+		result, err := Fields([]byte(test.from), []byte(test.to))
+		if err != nil {
+			t.Errorf("Test[%d] Failed: %v", count, err)
+			continue
+		}
+		if !reflect.DeepEqual(result, test.expectedResult) {
+			t.Errorf("Test[%d] Failed: Expected '%v' but got '%v'", count, test.expectedResult, result)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package encrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/vbehar/openshift-git/pkg/normalize"
+
+	"github.com/ghodss/yaml"
+)
+
+const (
+	// valuePrefix is the prefix of the encrypted values
+	valuePrefix = "ENC[AES256_GCM,"
+
+	// valueSuffix is the suffix of the encrypted values
+	valueSuffix = "]"
+)
+
+// DefaultFields returns the fields that are always encrypted:
+// the values of the data and stringData of the secrets,
+// and their last applied configuration (which contains a copy of the data)
+func DefaultFields() []normalize.Field {
+	return []normalize.Field{
+		{Kind: "Secret", Path: "data[*]"},
+		{Kind: "Secret", Path: "stringData[*]"},
+		{Kind: "Secret", Path: "metadata.annotations[kubectl.kubernetes.io/last-applied-configuration]"},
+	}
+}
+
+// Encrypter encrypts (and decrypts) the values of some fields of the resources.
+// The encryption is deterministic: the same value is always encrypted the same way,
+// so that the encrypted resources can still be compared and diffed, and unchanged
+// values don't produce new commits.
+// Each value is bound to its field (kind, namespace and name of the resource, and path of the field):
+// an encrypted value can't be decrypted once copied to another field or resource.
+// A nil Encrypter does not encrypt nor decrypt anything.
+type Encrypter struct {
+	// Fields are the fields to encrypt
+	Fields []normalize.Field
+
+	// aead is the cipher used to encrypt the values
+	aead cipher.AEAD
+
+	// nonceKey is the key used to derive the nonce from the value to encrypt
+	nonceKey []byte
+}
+
+// NewEncrypterFromFile instantiates a new Encrypter, using a key read from the given file.
+// The file can contain any secret data (like a random passphrase), that is used to derive the keys.
+func NewEncrypterFromFile(path string, fields []normalize.Field) (*Encrypter, error) {
+	key, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key = []byte(strings.TrimSpace(string(key)))
+	if len(key) == 0 {
+		return nil, fmt.Errorf("Empty encryption key in %s", path)
+	}
+
+	return NewEncrypter(key, fields)
+}
+
+// NewEncrypter instantiates a new Encrypter, using the given key to derive the encryption keys
+func NewEncrypter(key []byte, fields []normalize.Field) (*Encrypter, error) {
+	for _, field := range fields {
+		if err := normalize.ValidatePath(field.Path); err != nil {
+			return nil, err
+		}
+	}
+
+	block, err := aes.NewCipher(deriveKey(key, "encryption"))
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Encrypter{
+		Fields:   fields,
+		aead:     aead,
+		nonceKey: deriveKey(key, "nonce"),
+	}, nil
+}
+
+// Encrypt encrypts the fields of the given content (in the given format, "json" or "yaml")
+// for a resource of the given kind.
+// The content is returned as-is if there is no field to encrypt for the given kind.
+func (e *Encrypter) Encrypt(kind string, content []byte, format string) ([]byte, error) {
+	if e == nil {
+		return content, nil
+	}
+
+	fields := e.fieldsForKind(kind)
+	if len(fields) == 0 {
+		return content, nil
+	}
+
+	obj := map[string]interface{}{}
+	if err := yaml.Unmarshal(content, &obj); err != nil {
+		return nil, err
+	}
+
+	for _, field := range fields {
+		err := normalize.TransformWithPath(obj, field.Path, func(fieldPath string, value interface{}) (interface{}, error) {
+			s, ok := value.(string)
+			if !ok || IsEncrypted(s) {
+				return value, nil
+			}
+			return e.EncryptString(s, AdditionalData(obj, fieldPath)), nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return normalize.Encode(obj, format)
+}
+
+// Decrypt decrypts all the encrypted values of the given content (in the given format, "json" or "yaml")
+// The content is returned as-is if it does not contain any encrypted value.
+func (e *Encrypter) Decrypt(content []byte, format string) ([]byte, error) {
+	if e == nil || !strings.Contains(string(content), valuePrefix) {
+		return content, nil
+	}
+
+	obj := map[string]interface{}{}
+	if err := yaml.Unmarshal(content, &obj); err != nil {
+		return nil, err
+	}
+
+	if err := e.decryptAll(obj, obj, ""); err != nil {
+		return nil, err
+	}
+
+	return normalize.Encode(obj, format)
+}
+
+// AdditionalData returns the data authenticated with the encrypted value
+// of the field at the given path in the given (generic) object:
+// the kind, namespace and name of the object, and the path of the field.
+func AdditionalData(obj map[string]interface{}, fieldPath string) string {
+	kind, _ := obj["kind"].(string)
+	metadata, _ := obj["metadata"].(map[string]interface{})
+	namespace, _ := metadata["namespace"].(string)
+	name, _ := metadata["name"].(string)
+	return strings.Join([]string{kind, namespace, name, fieldPath}, "\x00")
+}
+
+// EncryptString encrypts the given value, bound to the given additional data (see AdditionalData),
+// and returns it in the "ENC[AES256_GCM,...]" format
+func (e *Encrypter) EncryptString(value, additionalData string) string {
+	// the nonce depends on the additional data too,
+	// so that the same value in 2 fields never reuses a nonce
+	mac := hmac.New(sha256.New, e.nonceKey)
+	mac.Write([]byte(additionalData))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+	nonce := mac.Sum(nil)[:e.aead.NonceSize()]
+
+	sealed := e.aead.Seal(nonce, nonce, []byte(value), []byte(additionalData))
+	return valuePrefix + base64.StdEncoding.EncodeToString(sealed) + valueSuffix
+}
+
+// DecryptString decrypts the given value (in the "ENC[AES256_GCM,...]" format),
+// which must have been encrypted with the same additional data
+func (e *Encrypter) DecryptString(value, additionalData string) (string, error) {
+	if !IsEncrypted(value) {
+		return "", fmt.Errorf("Value is not encrypted")
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(value[len(valuePrefix) : len(value)-len(valueSuffix)])
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < e.aead.NonceSize() {
+		return "", fmt.Errorf("Encrypted value is too short")
+	}
+
+	nonce, ciphertext := sealed[:e.aead.NonceSize()], sealed[e.aead.NonceSize():]
+	plaintext, err := e.aead.Open(nil, nonce, ciphertext, []byte(additionalData))
+	if err != nil {
+		return "", fmt.Errorf("Failed to decrypt value (wrong key, or value moved from another field?): %v", err)
+	}
+	return string(plaintext), nil
+}
+
+// IsEncrypted returns true if the given value has been encrypted by an Encrypter
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, valuePrefix) && strings.HasSuffix(value, valueSuffix)
+}
+
+// decryptAll decrypts recursively all the encrypted values of the given value (map or list),
+// at the given path in the given (generic) object
+func (e *Encrypter) decryptAll(obj map[string]interface{}, value interface{}, path string) error {
+	decrypt := func(child interface{}, childPath string) (interface{}, error) {
+		if s, ok := child.(string); ok && IsEncrypted(s) {
+			return e.DecryptString(s, AdditionalData(obj, childPath))
+		}
+		return child, e.decryptAll(obj, child, childPath)
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			result, err := decrypt(child, normalize.FieldPath(path, key))
+			if err != nil {
+				return err
+			}
+			v[key] = result
+		}
+	case []interface{}:
+		for i, child := range v {
+			result, err := decrypt(child, normalize.ElementPath(path, i))
+			if err != nil {
+				return err
+			}
+			v[i] = result
+		}
+	}
+	return nil
+}
+
+// fieldsForKind returns the fields to encrypt for the given kind
+func (e *Encrypter) fieldsForKind(kind string) []normalize.Field {
+	fields := []normalize.Field{}
+	for _, field := range e.Fields {
+		if field.AppliesTo(kind) {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// deriveKey derives a 256-bit key for the given purpose from the given key
+func deriveKey(key []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
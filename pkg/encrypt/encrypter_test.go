@@ -0,0 +1,141 @@
+package encrypt
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	encrypter, err := NewEncrypter([]byte("my-secret-key"), DefaultFields())
+	if err != nil {
+		t.Fatalf("Failed to create encrypter: %v", err)
+	}
+
+	tests := []struct {
+		kind    string
+		format  string
+		content string
+	}{
+		{
+			kind:    "Secret",
+			format:  "yaml",
+			content: "data:\n  password: cGFzc3dvcmQ=\n  username: YWRtaW4=\nkind: Secret\nmetadata:\n  name: creds\n",
+		},
+		{
+			kind:    "Secret",
+			format:  "json",
+			content: "{\n    \"kind\": \"Secret\",\n    \"stringData\": {\n        \"token\": \"abc\"\n    }\n}\n",
+		},
+	}
+
+	for count, test := range tests {
+		encrypted, err := encrypter.Encrypt(test.kind, []byte(test.content), test.format)
+		if err != nil {
+			t.Errorf("Test[%d] Failed to encrypt: %v", count, err)
+			continue
+		}
+		if strings.Contains(string(encrypted), "cGFzc3dvcmQ=") || strings.Contains(string(encrypted), "\"abc\"") {
+			t.Errorf("Test[%d] Failed: Expected the values to be encrypted but got '%s'", count, string(encrypted))
+		}
+		if !strings.Contains(string(encrypted), "Secret") {
+			t.Errorf("Test[%d] Failed: Expected the other fields to be kept but got '%s'", count, string(encrypted))
+		}
+
+		encryptedAgain, err := encrypter.Encrypt(test.kind, []byte(test.content), test.format)
+		if err != nil || string(encryptedAgain) != string(encrypted) {
+			t.Errorf("Test[%d] Failed: Expected a deterministic encryption '%s' but got '%s' (%v)", count, string(encrypted), string(encryptedAgain), err)
+		}
+
+		decrypted, err := encrypter.Decrypt(encrypted, test.format)
+		if err != nil {
+			t.Errorf("Test[%d] Failed to decrypt: %v", count, err)
+			continue
+		}
+		if string(decrypted) != test.content {
+			t.Errorf("Test[%d] Failed: Expected '%s' but got '%s'", count, test.content, string(decrypted))
+		}
+	}
+}
+
+func TestEncryptOtherKinds(t *testing.T) {
+	encrypter, err := NewEncrypter([]byte("my-secret-key"), DefaultFields())
+	if err != nil {
+		t.Fatalf("Failed to create encrypter: %v", err)
+	}
+
+	content := "data:\n  key: value\nkind: ConfigMap\n"
+	result, err := encrypter.Encrypt("ConfigMap", []byte(content), "yaml")
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+	if string(result) != content {
+		t.Errorf("Expected '%s' but got '%s'", content, string(result))
+	}
+}
+
+func TestDecryptWithWrongKey(t *testing.T) {
+	encrypter, _ := NewEncrypter([]byte("my-secret-key"), DefaultFields())
+	otherEncrypter, _ := NewEncrypter([]byte("another-key"), DefaultFields())
+
+	if _, err := otherEncrypter.DecryptString(encrypter.EncryptString("value", "data"), "data"); err == nil {
+		t.Errorf("Expected an error when decrypting with the wrong key")
+	}
+}
+
+func TestEncryptLastAppliedConfiguration(t *testing.T) {
+	encrypter, _ := NewEncrypter([]byte("my-secret-key"), DefaultFields())
+
+	content := "data:\n  password: cGFzc3dvcmQ=\nkind: Secret\nmetadata:\n  annotations:\n    kubectl.kubernetes.io/last-applied-configuration: '{\"data\":{\"password\":\"cGFzc3dvcmQ=\"}}'\n  name: creds\n"
+	encrypted, err := encrypter.Encrypt("Secret", []byte(content), "yaml")
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+	if strings.Contains(string(encrypted), "cGFzc3dvcmQ=") {
+		t.Errorf("Expected the last applied configuration to be encrypted but got '%s'", string(encrypted))
+	}
+
+	decrypted, err := encrypter.Decrypt(encrypted, "yaml")
+	if err != nil {
+		t.Fatalf("Failed to decrypt: %v", err)
+	}
+	if string(decrypted) != content {
+		t.Errorf("Expected '%s' but got '%s'", content, string(decrypted))
+	}
+}
+
+func TestDecryptMovedValue(t *testing.T) {
+	encrypter, _ := NewEncrypter([]byte("my-secret-key"), DefaultFields())
+
+	content := "data:\n  password: cGFzc3dvcmQ=\n  username: YWRtaW4=\nkind: Secret\nmetadata:\n  name: creds\n  namespace: foo\n"
+	encrypted, err := encrypter.Encrypt("Secret", []byte(content), "yaml")
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		old  string
+		new  string
+	}{
+		{name: "other namespace", old: "namespace: foo", new: "namespace: bar"},
+		{name: "other name", old: "name: creds", new: "name: other"},
+		{name: "other field", old: "password:", new: "token:"},
+	}
+	for _, test := range tests {
+		moved := strings.Replace(string(encrypted), test.old, test.new, 1)
+		if _, err := encrypter.Decrypt([]byte(moved), "yaml"); err == nil {
+			t.Errorf("Expected an error when decrypting a value moved to %s", test.name)
+		}
+	}
+
+	// the same value in 2 fields is encrypted differently
+	same := "data:\n  a: dmFsdWU=\n  b: dmFsdWU=\nkind: Secret\nmetadata:\n  name: creds\n"
+	encrypted, err = encrypter.Encrypt("Secret", []byte(same), "yaml")
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+	lines := strings.Split(string(encrypted), "\n")
+	if strings.TrimPrefix(lines[1], "  a: ") == strings.TrimPrefix(lines[2], "  b: ") {
+		t.Errorf("Expected the same value to be encrypted differently in 2 fields but got '%s'", string(encrypted))
+	}
+}
@@ -0,0 +1,193 @@
+package git
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+const (
+	// defaultTokenUsername is the user name used with a token, if none is provided.
+	// It is accepted by most Git servers (GitHub, GitLab, ...)
+	defaultTokenUsername = "oauth2"
+
+	// askPassScript is the script used as GIT_ASKPASS:
+	// git runs it with the prompt as its first argument, and reads the answer from its output.
+	// The secret is read from the file only when needed, so that it is never
+	// written anywhere else (in the git config, in the environment or in the logs).
+	askPassScript = `#!/bin/sh
+case "$1" in
+  Username*) printf '%s\n' "$OPENSHIFT_GIT_USERNAME" ;;
+  *) cat "$OPENSHIFT_GIT_PASSWORD_FILE" ;;
+esac
+`
+)
+
+// Credentials are the credentials used to access a remote repository over HTTPS
+type Credentials struct {
+	// Username is the name of the user
+	Username string
+
+	// PasswordFile is the path of a file containing the password of the user
+	PasswordFile string
+
+	// TokenFile is the path of a file containing a token,
+	// used instead of a password
+	TokenFile string
+}
+
+// IsEmpty returns true if no credentials have been provided
+func (c Credentials) IsEmpty() bool {
+	return len(c.Username) == 0 && len(c.PasswordFile) == 0 && len(c.TokenFile) == 0
+}
+
+// Validate returns an error if the credentials are incomplete or inconsistent
+func (c Credentials) Validate() error {
+	if len(c.PasswordFile) > 0 && len(c.TokenFile) > 0 {
+		return fmt.Errorf("Both a password file and a token file are provided, but only one can be used.")
+	}
+	if len(c.PasswordFile) > 0 && len(c.Username) == 0 {
+		return fmt.Errorf("Missing user name for the password file %s.", c.PasswordFile)
+	}
+	if len(c.Username) > 0 && len(c.PasswordFile) == 0 && len(c.TokenFile) == 0 {
+		return fmt.Errorf("Missing password file or token file for the user %s.", c.Username)
+	}
+	for _, file := range []string{c.PasswordFile, c.TokenFile} {
+		if len(file) == 0 {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ConfigureCredentials configures the git commands run by this process
+// (clone, pull, push, ...) to use the given credentials, through a GIT_ASKPASS script.
+// It does nothing if the credentials are empty.
+func ConfigureCredentials(credentials Credentials) error {
+	if credentials.IsEmpty() {
+		return nil
+	}
+	if err := credentials.Validate(); err != nil {
+		return err
+	}
+
+	username, passwordFile := credentials.Username, credentials.PasswordFile
+	if len(credentials.TokenFile) > 0 {
+		passwordFile = credentials.TokenFile
+		if len(username) == 0 {
+			username = defaultTokenUsername
+		}
+	}
+	passwordFile, err := filepath.Abs(passwordFile)
+	if err != nil {
+		return err
+	}
+
+	dir, err := ioutil.TempDir("", "openshift-git-")
+	if err != nil {
+		return err
+	}
+	script := filepath.Join(dir, "askpass.sh")
+	if err := ioutil.WriteFile(script, []byte(askPassScript), 0700); err != nil {
+		return err
+	}
+
+	glog.V(1).Infof("Using the credentials of %s (from %s) to access the remote repository", username, passwordFile)
+	return setenv(map[string]string{
+		"GIT_ASKPASS":                 script,
+		"GIT_TERMINAL_PROMPT":         "0",
+		"OPENSHIFT_GIT_USERNAME":      username,
+		"OPENSHIFT_GIT_PASSWORD_FILE": passwordFile,
+	})
+}
+
+// SSHConfig is the configuration used to access a remote repository over SSH
+type SSHConfig struct {
+	// PrivateKeyFile is the path of the private key
+	PrivateKeyFile string
+
+	// KnownHostsFile is the path of a known_hosts file,
+	// containing the public keys of the Git servers
+	KnownHostsFile string
+}
+
+// IsEmpty returns true if no SSH configuration has been provided
+func (c SSHConfig) IsEmpty() bool {
+	return len(c.PrivateKeyFile) == 0 && len(c.KnownHostsFile) == 0
+}
+
+// ConfigureSSH configures the git commands run by this process
+// (clone, pull, push, ...) to use the given SSH configuration, through a GIT_SSH script
+// (GIT_SSH_COMMAND is not supported by git < 2.3).
+// The host keys are always verified: against the given known_hosts file if any,
+// or against the default known_hosts files otherwise.
+// It does nothing if the configuration is empty.
+func ConfigureSSH(config SSHConfig) error {
+	if config.IsEmpty() {
+		return nil
+	}
+
+	args := []string{"ssh", "-o", "StrictHostKeyChecking=yes", "-o", "BatchMode=yes"}
+
+	if len(config.PrivateKeyFile) > 0 {
+		key, err := ioutil.ReadFile(config.PrivateKeyFile)
+		if err != nil {
+			return err
+		}
+
+		// ssh refuses to use a private key readable by others,
+		// which is the case of the files mounted from a secret by default
+		keyFile, err := writePrivateFile("id", key)
+		if err != nil {
+			return err
+		}
+		args = append(args, "-i", shellQuote(keyFile), "-o", "IdentitiesOnly=yes")
+	}
+
+	if len(config.KnownHostsFile) > 0 {
+		knownHostsFile, err := filepath.Abs(config.KnownHostsFile)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(knownHostsFile); err != nil {
+			return err
+		}
+		args = append(args, "-o", "UserKnownHostsFile="+shellQuote(knownHostsFile))
+	}
+
+	// git runs the script with the host and the command as arguments
+	script, err := writePrivateFile("ssh.sh", []byte(fmt.Sprintf("#!/bin/sh\nexec %s \"$@\"\n", strings.Join(args, " "))))
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(script, 0700); err != nil {
+		return err
+	}
+
+	glog.V(1).Infof("Using the SSH private key %s and known hosts %s to access the remote repository", config.PrivateKeyFile, config.KnownHostsFile)
+	return setenv(map[string]string{
+		"GIT_SSH": script,
+	})
+}
+
+// shellQuote quotes the given value, so that it can be used as a single argument in a shell command
+func shellQuote(value string) string {
+	return "'" + strings.Replace(value, "'", `'\''`, -1) + "'"
+}
+
+// setenv sets the given environment variables for this process (and the git commands it runs)
+func setenv(env map[string]string) error {
+	for key, value := range env {
+		if err := os.Setenv(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,280 @@
+package backend
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/vbehar/openshift-git/pkg/gitobj"
+
+	git "github.com/gogits/git-module"
+)
+
+// Backends supported by New
+const (
+	// CLI runs the git binary to stage and commit the changes
+	CLI = "cli"
+
+	// Objects writes the objects (blobs, trees and commits)
+	// directly into the object database, without running the git binary
+	Objects = "objects"
+)
+
+// Change types returned by Backend.Change
+const (
+	ChangeAdded    = "A"
+	ChangeModified = "M"
+	ChangeDeleted  = "D"
+)
+
+// Author is the author of a commit
+type Author struct {
+	Name  string
+	Email string
+}
+
+// Backend stages and commits the changes of the files of a repository
+type Backend interface {
+	// Change returns the type of change of the given file (or directory),
+	// compared to the last commit: ChangeAdded, ChangeModified or ChangeDeleted.
+	// Returns an empty string if it has not been changed.
+	Change(path string) (string, error)
+
+	// Add stages the changes of the given file (or directory), including its deletion
+	Add(path string) error
+
+	// Stage stages the changes of the given files (or directories), including their deletion,
+	// and returns their type of change compared to the last commit (see Change), per given path
+	// - the unchanged paths are omitted. It is like calling Add and Change for each path,
+	// but faster for many paths (the CLI backend runs the git binary only a few times).
+	Stage(paths ...string) (map[string]string, error)
+
+	// Commit commits the staged changes, with the given message.
+	// If an author is provided, it is used instead of the configured user.
+	Commit(message string, author *Author) error
+
+	// Reset unstages the staged changes
+	Reset() error
+
+	// Sync synchronizes the backend with the repository,
+	// before and after it is changed by the git binary (by a pull for example)
+	Sync() error
+
+	// Close leaves the repository ready to be used by the git binary
+	// (its index is up to date with the last commit): it should be called
+	// when the backend is not used anymore.
+	Close() error
+}
+
+// New instantiates the backend with the given name (CLI or Objects) for the given repository.
+// The given command function is used by the CLI backend to build the "git commit" commands
+// (for example to sign them) - it defaults to git.NewCommand.
+func New(name, repoPath string, command func(args ...string) *git.Command) (Backend, error) {
+	switch name {
+	case CLI:
+		return NewCLI(repoPath, command), nil
+	case Objects:
+		return NewObjects(repoPath)
+	default:
+		return nil, fmt.Errorf("Invalid backend '%s': should be '%s' or '%s'", name, CLI, Objects)
+	}
+}
+
+// maxPathsPerCommand is the maximum number of paths given to a single git command,
+// so that its command line does not get too long
+const maxPathsPerCommand = 500
+
+// FileChange returns the type of change of the given file in the given git repository,
+// compared to the last commit: ChangeAdded, ChangeModified or ChangeDeleted.
+// Returns an empty string if the file has not been changed.
+func FileChange(repoPath, file string) (string, error) {
+	output, err := git.NewCommand("status", "--porcelain", "--", file).RunInDir(repoPath)
+	if err != nil || len(output) < 2 {
+		return "", err
+	}
+	return statusChange(output[0], output[1]), nil
+}
+
+// statusChange returns the type of change for the given columns of "git status --porcelain":
+// the first column is the status of the index,
+// the second column is the status of the working tree
+func statusChange(index, workTree byte) string {
+	status := index
+	if status == ' ' {
+		status = workTree
+	}
+	switch status {
+	case '?', 'A':
+		return ChangeAdded
+	case 'D':
+		return ChangeDeleted
+	default:
+		return ChangeModified
+	}
+}
+
+// changedFiles returns the type of change of the files in the given paths (files or directories)
+// of the given git repository, compared to the last commit - per path of file, relative to the repository.
+// The unchanged files are omitted.
+func changedFiles(repoPath string, paths []string) (map[string]string, error) {
+	files := map[string]string{}
+	for start := 0; start < len(paths); start += maxPathsPerCommand {
+		end := start + maxPathsPerCommand
+		if end > len(paths) {
+			end = len(paths)
+		}
+		args := append([]string{"status", "--porcelain", "-z", "--untracked-files=all", "--"}, paths[start:end]...)
+		output, err := git.NewCommand(args...).RunInDir(repoPath)
+		if err != nil {
+			return nil, err
+		}
+
+		entries := strings.Split(output, "\x00")
+		for i := 0; i < len(entries); i++ {
+			entry := entries[i]
+			if len(entry) < 4 {
+				continue
+			}
+			switch entry[0] {
+			case 'R', 'C':
+				// the new path is followed by the original path
+				files[entry[3:]] = ChangeAdded
+				if i++; i < len(entries) && entry[0] == 'R' {
+					files[entries[i]] = ChangeDeleted
+				}
+			default:
+				files[entry[3:]] = statusChange(entry[0], entry[1])
+			}
+		}
+	}
+	return files, nil
+}
+
+// ResetIndex resets the index of the given repository to the last commit (if any),
+// without changing the working tree: the changes are unstaged.
+// The index may be outdated if the last commits have been written by the Objects backend.
+func ResetIndex(repoPath string) error {
+	if _, err := git.NewCommand("rev-parse", "--verify", "-q", "HEAD").RunInDir(repoPath); err != nil {
+		// no commit yet
+		return nil
+	}
+	_, err := git.NewCommand("reset", "-q").RunInDir(repoPath)
+	return err
+}
+
+// changesOf returns the type of change of the given paths (files or directories) of the given repository,
+// from the changes of its files (relative to the repository, see changedFiles).
+// A directory has the type of change of one of its files.
+func changesOf(repoPath string, paths []string, files map[string]string) (map[string]string, error) {
+	relativePaths := map[string]string{}
+	for _, path := range paths {
+		rel, err := filepath.Rel(repoPath, path)
+		if err != nil {
+			return nil, err
+		}
+		relativePaths[filepath.ToSlash(rel)] = path
+	}
+
+	changes := map[string]string{}
+	for file, change := range files {
+		// the file itself, or one of its parent directories
+		p := file
+		for {
+			if path, found := relativePaths[p]; found && len(changes[path]) == 0 {
+				changes[path] = change
+			}
+			i := strings.LastIndex(p, "/")
+			if i < 0 {
+				break
+			}
+			p = p[:i]
+		}
+	}
+	return changes, nil
+}
+
+// cliBackend is a Backend that runs the git binary
+type cliBackend struct {
+	repoPath string
+
+	// command builds the "git commit" commands
+	command func(args ...string) *git.Command
+}
+
+// NewCLI instantiates a new CLI backend for the given repository (see New)
+func NewCLI(repoPath string, command func(args ...string) *git.Command) Backend {
+	if command == nil {
+		command = git.NewCommand
+	}
+	return &cliBackend{
+		repoPath: repoPath,
+		command:  command,
+	}
+}
+
+// Change returns the type of change of the given file (see FileChange)
+func (b *cliBackend) Change(path string) (string, error) {
+	return FileChange(b.repoPath, path)
+}
+
+// Add stages the changes of the given file
+func (b *cliBackend) Add(path string) error {
+	return git.AddChanges(b.repoPath, true, path)
+}
+
+// Stage stages the changes of the given files (or directories):
+// the changed files are listed, added, and listed again to get their changes
+// compared to the last commit - whatever the number of paths, with a few git commands.
+func (b *cliBackend) Stage(paths ...string) (map[string]string, error) {
+	files, err := changedFiles(b.repoPath, paths)
+	if err != nil {
+		return nil, err
+	}
+	changed := []string{}
+	for file := range files {
+		changed = append(changed, file)
+	}
+	sort.Strings(changed)
+	for start := 0; start < len(changed); start += maxPathsPerCommand {
+		end := start + maxPathsPerCommand
+		if end > len(changed) {
+			end = len(changed)
+		}
+		args := append([]string{"add", "--all", "--"}, changed[start:end]...)
+		if _, err := git.NewCommand(args...).RunInDir(b.repoPath); err != nil {
+			return nil, err
+		}
+	}
+
+	if files, err = changedFiles(b.repoPath, paths); err != nil {
+		return nil, err
+	}
+	return changesOf(b.repoPath, paths, files)
+}
+
+// Commit commits the staged changes.
+// The name and email of the author are cleaned (see gitobj.CleanIdent).
+func (b *cliBackend) Commit(message string, author *Author) error {
+	cmd := b.command("commit", "-m", message)
+	if author != nil {
+		cmd.AddArguments(fmt.Sprintf("--author=%s <%s>", gitobj.CleanIdent(author.Name), gitobj.CleanIdent(author.Email)))
+	}
+	_, err := cmd.RunInDir(b.repoPath)
+	return err
+}
+
+// Reset unstages the staged changes
+func (b *cliBackend) Reset() error {
+	return git.ResetHEAD(b.repoPath, false, "HEAD")
+}
+
+// Sync does nothing: the git binary is always in sync with itself
+func (b *cliBackend) Sync() error {
+	return nil
+}
+
+// Close does nothing: the git binary keeps its index up to date
+func (b *cliBackend) Close() error {
+	return nil
+}
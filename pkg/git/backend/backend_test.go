@@ -0,0 +1,253 @@
+package backend
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newTestRepository initializes a new git repository in a temp dir,
+// with the given files committed, and returns its path
+func newTestRepository(t testing.TB, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "backend-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, dir, "init", "-q")
+	runGit(t, dir, "config", "user.name", "Test")
+	runGit(t, dir, "config", "user.email", "test@example.com")
+	for path, content := range files {
+		writeFile(t, dir, path, content)
+	}
+	if len(files) > 0 {
+		runGit(t, dir, "add", "--all")
+		runGit(t, dir, "commit", "-q", "-m", "Initial export")
+	}
+	return dir
+}
+
+// writeFile writes the given content to the given (relative) path of the repository
+func writeFile(t testing.TB, repo, path, content string) string {
+	file := filepath.Join(repo, filepath.FromSlash(path))
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+// runGit runs the git binary in the given directory, and returns its output
+func runGit(t testing.TB, dir string, args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v failed: %v: %s", args, err, output)
+	}
+	return string(output)
+}
+
+// commitFile writes, stages and commits the given file with the given backend
+func commitFile(t testing.TB, b Backend, repo, path, content string, author *Author) {
+	file := writeFile(t, repo, path, content)
+	if _, err := b.Change(file); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Add(file); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Commit("Update "+path, author); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestObjectsCloseUpdatesIndex(t *testing.T) {
+	repo := newTestRepository(t, map[string]string{
+		"Namespace/foo/Service/a.yaml": "kind: Service\n",
+		"Namespace/foo/Service/b.yaml": "kind: Service\n",
+	})
+	defer os.RemoveAll(repo)
+
+	b, err := New(Objects, repo, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commitFile(t, b, repo, "Namespace/foo/Service/a.yaml", "kind: Service\nspec: {}\n", nil)
+	commitFile(t, b, repo, "Namespace/foo/Service/c.yaml", "kind: Service\n", nil)
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if status := runGit(t, repo, "status", "--porcelain"); len(status) > 0 {
+		t.Errorf("Expected a clean working tree after Close, but got:\n%s", status)
+	}
+
+	// a commit of the git binary must not revert the commits of the backend
+	cli, err := New(CLI, repo, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commitFile(t, cli, repo, "Namespace/foo/Service/b.yaml", "kind: Service\nspec: {}\n", nil)
+	if changed := runGit(t, repo, "diff", "--name-only", "HEAD~1", "HEAD"); changed != "Namespace/foo/Service/b.yaml\n" {
+		t.Errorf("Expected the last commit to change only b.yaml, but got:\n%s", changed)
+	}
+	if status := runGit(t, repo, "status", "--porcelain"); len(status) > 0 {
+		t.Errorf("Expected a clean working tree, but got:\n%s", status)
+	}
+}
+
+func TestObjectsCommitUpdatesIndex(t *testing.T) {
+	repo := newTestRepository(t, map[string]string{
+		"Namespace/foo/Service/a.yaml": "kind: Service\n",
+		"Namespace/foo/Service/b.yaml": "kind: Service\n",
+	})
+	defer os.RemoveAll(repo)
+
+	b, err := New(Objects, repo, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commitFile(t, b, repo, "Namespace/foo/Service/a.yaml", "kind: Service\nspec: {}\n", nil)
+	commitFile(t, b, repo, "Namespace/foo/Service/c.yaml", "kind: Service\n", nil)
+	if err := os.Remove(filepath.Join(repo, "Namespace", "foo", "Service", "b.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Add(filepath.Join(repo, "Namespace", "foo", "Service", "b.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Commit("Delete b.yaml", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// the git binary can be run between the commits, without closing the backend
+	if status := runGit(t, repo, "status", "--porcelain"); len(status) > 0 {
+		t.Errorf("Expected a clean working tree after the commits, but got:\n%s", status)
+	}
+	if diff := runGit(t, repo, "diff", "--cached", "--name-only"); len(diff) > 0 {
+		t.Errorf("Expected no staged changes after the commits, but got:\n%s", diff)
+	}
+}
+
+func TestResetIndex(t *testing.T) {
+	repo := newTestRepository(t, nil)
+	defer os.RemoveAll(repo)
+
+	// no commit yet
+	if err := ResetIndex(repo); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := New(Objects, repo, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commitFile(t, b, repo, "Namespace/foo/Service/a.yaml", "kind: Service\n", nil)
+
+	// like after a crash, without Close
+	if err := ResetIndex(repo); err != nil {
+		t.Fatal(err)
+	}
+	if status := runGit(t, repo, "status", "--porcelain"); len(status) > 0 {
+		t.Errorf("Expected a clean working tree after ResetIndex, but got:\n%s", status)
+	}
+}
+
+func TestCommitWithMaliciousAuthor(t *testing.T) {
+	for _, name := range []string{CLI, Objects} {
+		repo := newTestRepository(t, map[string]string{"README.md": "# Export\n"})
+		defer os.RemoveAll(repo)
+
+		b, err := New(name, repo, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		author := &Author{
+			Name:  "Mallory\ncommitter Admin <admin@example.com> 0 +0000",
+			Email: "mallory@example.com>\n\nfake message <",
+		}
+		commitFile(t, b, repo, "Namespace/foo/Service/a.yaml", "kind: Service\n", author)
+		if err := b.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		runGit(t, repo, "fsck", "--strict")
+		got := runGit(t, repo, "log", "-1", "--format=%an|%ae|%cn|%s")
+		expected := "Mallorycommitter Admin admin@example.com 0 +0000|mallory@example.comfake message|Test|Update Namespace/foo/Service/a.yaml\n"
+		if got != expected {
+			t.Errorf("Expected the %s backend to commit '%s', but got '%s'", name, strings.TrimSpace(expected), strings.TrimSpace(got))
+		}
+	}
+}
+
+func TestStage(t *testing.T) {
+	for _, name := range []string{CLI, Objects} {
+		repo := newTestRepository(t, map[string]string{
+			"Namespace/foo/Service/a.yaml":            "kind: Service\n",
+			"Namespace/foo/Service/b.yaml":            "kind: Service\n",
+			"Namespace/foo/ConfigMap/c.yaml":          "kind: ConfigMap\n",
+			"Namespace/foo/ConfigMap/c.files/app.txt": "a=b\n",
+		})
+		defer os.RemoveAll(repo)
+
+		b, err := New(name, repo, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		path := func(p string) string {
+			return filepath.Join(repo, filepath.FromSlash(p))
+		}
+		// staged, and then reverted before the batch is committed
+		writeFile(t, repo, "Namespace/foo/Service/b.yaml", "kind: Service\nspec: {}\n")
+		if _, err := b.Stage(path("Namespace/foo/Service/b.yaml")); err != nil {
+			t.Fatal(err)
+		}
+
+		writeFile(t, repo, "Namespace/foo/Service/a.yaml", "kind: Service\nspec: {}\n")
+		writeFile(t, repo, "Namespace/foo/Service/b.yaml", "kind: Service\n")
+		writeFile(t, repo, "Namespace/foo/Service/d.yaml", "kind: Service\n")
+		writeFile(t, repo, "Namespace/foo/ConfigMap/c.files/app.txt", "a=c\n")
+		if err := os.Remove(path("Namespace/foo/ConfigMap/c.yaml")); err != nil {
+			t.Fatal(err)
+		}
+
+		changes, err := b.Stage(
+			path("Namespace/foo/Service/a.yaml"), path("Namespace/foo/Service/a.files"),
+			path("Namespace/foo/Service/b.yaml"), path("Namespace/foo/Service/b.files"),
+			path("Namespace/foo/ConfigMap/c.yaml"), path("Namespace/foo/ConfigMap/c.files"),
+			path("Namespace/foo/Service/d.yaml"), path("Namespace/foo/Service/d.files"),
+			path("Namespace/foo/Service/e.yaml"), path("Namespace/foo/Service/e.files"),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := map[string]string{
+			path("Namespace/foo/Service/a.yaml"):    ChangeModified,
+			path("Namespace/foo/ConfigMap/c.yaml"):  ChangeDeleted,
+			path("Namespace/foo/ConfigMap/c.files"): ChangeModified,
+			path("Namespace/foo/Service/d.yaml"):    ChangeAdded,
+		}
+		if !reflect.DeepEqual(changes, expected) {
+			t.Errorf("Expected the %s backend to stage the changes %v, but got %v", name, expected, changes)
+		}
+
+		if err := b.Commit("Update", nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if status := runGit(t, repo, "status", "--porcelain"); len(status) > 0 {
+			t.Errorf("Expected the %s backend to commit all the changes, but got:\n%s", name, status)
+		}
+		if files := runGit(t, repo, "diff", "--name-only", "HEAD~1", "HEAD"); strings.Contains(files, "b.yaml") {
+			t.Errorf("Expected the %s backend not to commit the reverted change, but got:\n%s", name, files)
+		}
+	}
+}
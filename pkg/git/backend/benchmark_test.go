@@ -0,0 +1,109 @@
+package backend
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// benchmarkObjects is the number of resources already exported in the repository of the benchmarks
+const benchmarkObjects = 10000
+
+// benchmarkBatchSize is the number of resources committed together by the batch benchmarks
+const benchmarkBatchSize = 100
+
+// newBenchmarkRepository initializes a new repository with benchmarkObjects resources,
+// spread across namespaces and kinds like an export - and returns its path
+func newBenchmarkRepository(b *testing.B) string {
+	files := map[string]string{}
+	for i := 0; i < benchmarkObjects; i++ {
+		files[benchmarkPath(i)] = fmt.Sprintf("kind: ConfigMap\nmetadata:\n  name: res-%d\ndata:\n  key: value-%d\n", i, i)
+	}
+	return newTestRepository(b, files)
+}
+
+// benchmarkPath returns the path of the i-th resource of the benchmark repository
+func benchmarkPath(i int) string {
+	kinds := []string{"ConfigMap", "Service", "DeploymentConfig", "Route", "Secret"}
+	return fmt.Sprintf("Namespace/ns-%d/%s/res-%d.yaml", i%100, kinds[i%len(kinds)], i)
+}
+
+// stageResource writes the i-th resource of the benchmark repository,
+// and stages it like a git.GitResource: with its (missing) sidecar files directory
+func stageResource(b *testing.B, backend Backend, repo string, i, revision int) {
+	path := benchmarkPath(i % benchmarkObjects)
+	file := writeFile(b, repo, path, fmt.Sprintf("kind: ConfigMap\nmetadata:\n  name: res-%d\nrevision: %d\n", i, revision))
+	if _, err := backend.Change(file); err != nil {
+		b.Fatal(err)
+	}
+	if err := backend.Add(file); err != nil {
+		b.Fatal(err)
+	}
+	if _, err := backend.Change(filepath.Join(filepath.Dir(file), fmt.Sprintf("res-%d.files", i%benchmarkObjects))); err != nil {
+		b.Fatal(err)
+	}
+}
+
+// benchmarkCommit commits the resources one by one with the given backend
+func benchmarkCommit(b *testing.B, name string) {
+	repo := newBenchmarkRepository(b)
+	defer os.RemoveAll(repo)
+	backend, err := New(name, repo, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	author := &Author{Name: "Test", Email: "test@example.com"}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		stageResource(b, backend, repo, i, i)
+		if err := backend.Commit(fmt.Sprintf("Update resource %d", i), author); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.StopTimer()
+	if err := backend.Close(); err != nil {
+		b.Fatal(err)
+	}
+}
+
+// benchmarkBatchCommit commits the resources by batches of benchmarkBatchSize with the given backend
+func benchmarkBatchCommit(b *testing.B, name string) {
+	repo := newBenchmarkRepository(b)
+	defer os.RemoveAll(repo)
+	backend, err := New(name, repo, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < benchmarkBatchSize; j++ {
+			stageResource(b, backend, repo, i*benchmarkBatchSize+j, i)
+		}
+		if err := backend.Commit(fmt.Sprintf("Update %d resources", benchmarkBatchSize), nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.StopTimer()
+	if err := backend.Close(); err != nil {
+		b.Fatal(err)
+	}
+}
+
+func BenchmarkCommitCLI(b *testing.B) {
+	benchmarkCommit(b, CLI)
+}
+
+func BenchmarkCommitObjects(b *testing.B) {
+	benchmarkCommit(b, Objects)
+}
+
+func BenchmarkBatchCommitCLI(b *testing.B) {
+	benchmarkBatchCommit(b, CLI)
+}
+
+func BenchmarkBatchCommitObjects(b *testing.B) {
+	benchmarkBatchCommit(b, Objects)
+}
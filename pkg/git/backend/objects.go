@@ -0,0 +1,415 @@
+package backend
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/vbehar/openshift-git/pkg/gitobj"
+
+	git "github.com/gogits/git-module"
+	"github.com/golang/glog"
+)
+
+// objectsBackend is a Backend that writes the objects directly into the object database.
+// It keeps the tree of the last commit in memory, and only runs the git binary
+// to synchronize with the repository (see Sync), and to update the index with the files of each commit
+// - so that the git binary run in the repository between the commits (like git status, diff or rebase)
+// does not see the committed changes as changes of the working tree.
+type objectsBackend struct {
+	repoPath string
+	db       *gitobj.ObjectDB
+
+	// user is the configured user, used as the committer (and the default author)
+	user gitobj.Signature
+
+	// ref is the reference of the current branch, like "refs/heads/master"
+	ref string
+
+	// head is the last commit (or the ZeroHash if there is none yet)
+	head gitobj.Hash
+
+	// tree is the tree of the last commit, with the staged changes
+	tree *gitobj.Tree
+
+	// committed are the entries of the last commit, for the files changed by the staged changes
+	// (nil if the file does not exist in the last commit)
+	committed map[string]*gitobj.Entry
+
+	// stagedPaths are the (relative) paths of the staged files and directories
+	stagedPaths map[string]bool
+
+	// indexStale is true if the index of the git binary could not be updated
+	// with the files of a commit (see Close)
+	indexStale bool
+}
+
+// NewObjects instantiates a new Objects backend for the given repository (see New)
+func NewObjects(repoPath string) (Backend, error) {
+	b := &objectsBackend{
+		repoPath: repoPath,
+		db:       gitobj.NewObjectDB(filepath.Join(repoPath, ".git")),
+	}
+
+	name, err := git.NewCommand("config", "user.name").RunInDir(repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read the user name: %v", err)
+	}
+	email, err := git.NewCommand("config", "user.email").RunInDir(repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read the user email: %v", err)
+	}
+	b.user = gitobj.Signature{Name: strings.TrimSpace(name), Email: strings.TrimSpace(email)}
+
+	if err := b.Sync(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Change returns the type of change of the given file (or directory),
+// by comparing the hashes of the files with the ones of the last commit
+func (b *objectsBackend) Change(path string) (string, error) {
+	rel, err := b.relativePath(path)
+	if err != nil {
+		return "", err
+	}
+
+	committed := b.committedFiles(rel)
+	current, err := b.workingFiles(rel)
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case len(committed) == 0 && len(current) == 0:
+		return "", nil
+	case len(committed) == 0:
+		return ChangeAdded, nil
+	case len(current) == 0:
+		return ChangeDeleted, nil
+	}
+	if len(committed) != len(current) {
+		return ChangeModified, nil
+	}
+	for p, content := range current {
+		if h, ok := committed[p]; !ok || h != gitobj.HashObject(gitobj.TypeBlob, content) {
+			return ChangeModified, nil
+		}
+	}
+	return "", nil
+}
+
+// Add stages the changes of the given file (or directory), by writing the blobs of its files
+func (b *objectsBackend) Add(path string) error {
+	rel, err := b.relativePath(path)
+	if err != nil {
+		return err
+	}
+
+	current, err := b.workingFiles(rel)
+	if err != nil {
+		return err
+	}
+
+	if b.stagedPaths == nil {
+		b.committed = map[string]*gitobj.Entry{}
+		b.stagedPaths = map[string]bool{}
+	}
+	b.stagedPaths[rel] = true
+
+	// keep the mode of the existing files
+	modes := map[string]string{}
+	for _, p := range append(b.tree.Files(rel), rel) {
+		if entry, ok := b.tree.Get(p); ok {
+			modes[p] = entry.Mode
+			b.recordCommitted(p)
+			b.tree.Delete(p)
+		}
+	}
+
+	for p, content := range current {
+		h, err := b.db.Write(gitobj.TypeBlob, content)
+		if err != nil {
+			return err
+		}
+		mode, ok := modes[p]
+		if !ok {
+			mode = gitobj.ModeFile
+		}
+		b.recordCommitted(p)
+		b.tree.Set(p, gitobj.Entry{Mode: mode, Hash: h})
+	}
+	return nil
+}
+
+// Stage stages the changes of the given files (or directories), one by one:
+// the objects backend does not run the git binary to stage them.
+// The unchanged paths are only staged again if they have already been staged,
+// so that their previous changes are reverted.
+func (b *objectsBackend) Stage(paths ...string) (map[string]string, error) {
+	changes := map[string]string{}
+	for _, path := range paths {
+		change, err := b.Change(path)
+		if err != nil {
+			return nil, err
+		}
+		rel, err := b.relativePath(path)
+		if err != nil {
+			return nil, err
+		}
+		if len(change) == 0 && !b.stagedPaths[rel] {
+			continue
+		}
+		if err := b.Add(path); err != nil {
+			return nil, err
+		}
+		if len(change) > 0 {
+			changes[path] = change
+		}
+	}
+	return changes, nil
+}
+
+// Commit writes the tree with the staged changes and a new commit,
+// and updates the current branch
+func (b *objectsBackend) Commit(message string, author *Author) error {
+	if b.stagedPaths == nil {
+		return fmt.Errorf("Nothing to commit")
+	}
+
+	treeHash, err := b.tree.Write(b.db)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	committer := b.user
+	committer.When = now
+	commitAuthor := committer
+	if author != nil {
+		commitAuthor = gitobj.Signature{Name: author.Name, Email: author.Email, When: now}
+	}
+
+	commit := &gitobj.Commit{
+		Tree:      treeHash,
+		Author:    commitAuthor,
+		Committer: committer,
+		Message:   message,
+	}
+	if !b.head.IsZero() {
+		commit.Parents = []gitobj.Hash{b.head}
+	}
+	h, err := b.db.WriteCommit(commit)
+	if err != nil {
+		return err
+	}
+	if err := b.db.UpdateRef(b.ref, h); err != nil {
+		return err
+	}
+
+	// the commit is done: if the index can't be updated, it will be reset by Close (or Sync)
+	if err := updateIndex(b.repoPath, b.tree, sortedKeys(b.committedPaths())); err != nil {
+		glog.Warningf("Failed to update the index of %s with the last commit: %v", b.repoPath, err)
+		b.indexStale = true
+	}
+
+	b.head = h
+	b.committed = nil
+	b.stagedPaths = nil
+	return nil
+}
+
+// Reset drops the staged changes, by restoring the entries of the last commit
+func (b *objectsBackend) Reset() error {
+	for p, entry := range b.committed {
+		if entry == nil {
+			b.tree.Delete(p)
+		} else {
+			b.tree.Set(p, *entry)
+		}
+	}
+	b.committed = nil
+	b.stagedPaths = nil
+	return nil
+}
+
+// Sync updates the index of the git binary with the last commit,
+// and then reads the last commit (which may have been changed by the git binary).
+// The staged changes are staged again on top of it.
+func (b *objectsBackend) Sync() error {
+	if err := ResetIndex(b.repoPath); err != nil {
+		return err
+	}
+	b.indexStale = false
+
+	ref, err := git.NewCommand("symbolic-ref", "HEAD").RunInDir(b.repoPath)
+	if err != nil {
+		return err
+	}
+	b.ref = strings.TrimSpace(ref)
+
+	b.head = gitobj.ZeroHash
+	b.tree = gitobj.NewTree()
+	if head, err := git.NewCommand("rev-parse", "--verify", "-q", "HEAD").RunInDir(b.repoPath); err == nil {
+		if b.head, err = gitobj.ParseHash(head); err != nil {
+			return err
+		}
+		output, err := git.NewCommand("ls-tree", "-r", "-z", "HEAD").RunInDir(b.repoPath)
+		if err != nil {
+			return err
+		}
+		if b.tree, err = gitobj.ParseLsTree(output); err != nil {
+			return err
+		}
+	}
+
+	stagedPaths := b.stagedPaths
+	b.committed = nil
+	b.stagedPaths = nil
+	for _, rel := range sortedKeys(stagedPaths) {
+		if err := b.Add(filepath.Join(b.repoPath, filepath.FromSlash(rel))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close updates the index of the git binary with the last commit (if it could not be updated by a commit),
+// so that the next commits of the git binary don't revert the commits of the backend.
+// The staged changes are unstaged.
+func (b *objectsBackend) Close() error {
+	if !b.indexStale {
+		return nil
+	}
+	if err := ResetIndex(b.repoPath); err != nil {
+		return err
+	}
+	b.indexStale = false
+	return nil
+}
+
+// committedPaths returns the (relative) paths of the files changed by the staged changes
+func (b *objectsBackend) committedPaths() map[string]bool {
+	paths := map[string]bool{}
+	for p := range b.committed {
+		paths[p] = true
+	}
+	return paths
+}
+
+// updateIndex updates the entries of the given files (relative paths) in the index of the given repository,
+// with their entries in the given tree - or removes them if they are not in the tree.
+// Only the given files are written, so that it is much faster than a reset of the index (see ResetIndex).
+func updateIndex(repoPath string, tree *gitobj.Tree, files []string) error {
+	if len(files) == 0 {
+		return nil
+	}
+
+	input := &bytes.Buffer{}
+	for _, p := range files {
+		if entry, ok := tree.Get(p); ok {
+			fmt.Fprintf(input, "%s %s\t%s\x00", entry.Mode, entry.Hash, p)
+		} else {
+			fmt.Fprintf(input, "0 %s\t%s\x00", gitobj.ZeroHash, p)
+		}
+	}
+
+	cmd := exec.Command("git", "update-index", "-z", "--index-info")
+	cmd.Dir = repoPath
+	cmd.Stdin = input
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%v - %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// recordCommitted records the entry of the last commit for the given file,
+// before it is changed by the staged changes
+func (b *objectsBackend) recordCommitted(p string) {
+	if _, ok := b.committed[p]; ok {
+		return
+	}
+	if entry, ok := b.tree.Get(p); ok {
+		b.committed[p] = &entry
+	} else {
+		b.committed[p] = nil
+	}
+}
+
+// committedFiles returns the hashes of the given file - or of the files in the given directory,
+// in the last commit, per (relative) path
+func (b *objectsBackend) committedFiles(rel string) map[string]gitobj.Hash {
+	files := map[string]gitobj.Hash{}
+	for _, p := range append(b.tree.Files(rel), rel) {
+		if _, changed := b.committed[p]; changed {
+			continue
+		}
+		if entry, ok := b.tree.Get(p); ok {
+			files[p] = entry.Hash
+		}
+	}
+	for p, entry := range b.committed {
+		if entry != nil && (p == rel || strings.HasPrefix(p, rel+"/")) {
+			files[p] = entry.Hash
+		}
+	}
+	return files
+}
+
+// relativePath returns the path relative to the root of the repository, with "/" separators
+func (b *objectsBackend) relativePath(path string) (string, error) {
+	rel, err := filepath.Rel(b.repoPath, path)
+	if err != nil {
+		return "", err
+	}
+	if rel == "." || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("%s is not a file of the repository %s", path, b.repoPath)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// workingFiles returns the content of the given file - or of the files in the given directory,
+// from the working tree, per (relative) path
+func (b *objectsBackend) workingFiles(rel string) (map[string][]byte, error) {
+	files := map[string][]byte{}
+	root := filepath.Join(b.repoPath, filepath.FromSlash(rel))
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		p, err := b.relativePath(path)
+		if err != nil {
+			return err
+		}
+		files[p] = content
+		return nil
+	})
+	return files, err
+}
+
+// sortedKeys returns the sorted keys of the given map
+func sortedKeys(m map[string]bool) []string {
+	keys := []string{}
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,245 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/vbehar/openshift-git/pkg/openshift"
+	"github.com/vbehar/openshift-git/pkg/store"
+
+	"github.com/golang/glog"
+)
+
+// CommitBatch represents a set of changes on multiple resources,
+// that will be committed together, in a single commit.
+type CommitBatch struct {
+	// repository is the repository in which the changes are committed
+	repository *Repository
+
+	// changes is the list of the staged changes, in the order they were added
+	changes []*stagedChange
+
+	// changesByPath indexes the staged changes by the path of the resource
+	changesByPath map[string]*stagedChange
+
+	// pending are the resources added to the batch, but not staged yet:
+	// they are staged all together when the changes of the batch are needed (see stage)
+	pending []*GitResource
+}
+
+// stagedChange represents the change of a single resource in a CommitBatch
+type stagedChange struct {
+	// change is the type of change (see GitResource.Change)
+	change string
+
+	// description is a string representation of the changed resource
+	description string
+
+	// author is the author of the change (may be nil if unknown)
+	author *openshift.Author
+
+	// trailers are the trailers with the metadata of the changed resource (see resourceTrailers)
+	trailers []string
+}
+
+// NewCommitBatch instantiates a new (empty) CommitBatch for the repository
+func (r *Repository) NewCommitBatch() *CommitBatch {
+	return &CommitBatch{
+		repository:    r,
+		changesByPath: map[string]*stagedChange{},
+	}
+}
+
+// Add adds the changes of the given resource (a GitResource of the same repository) to the batch,
+// so that they will be committed with the rest of the batch.
+// They are staged later, together with the changes of the other resources added in the meantime,
+// so that staging many resources (like for a snapshot) does not run the git binary for each one.
+func (b *CommitBatch) Add(resource store.Resource) error {
+	gr, ok := resource.(*GitResource)
+	if !ok {
+		return fmt.Errorf("Can't add %T to a batch of a git repository", resource)
+	}
+
+	b.pending = append(b.pending, gr)
+	return nil
+}
+
+// stage stages the changes of the pending resources all together,
+// and records their type of change, compared to the last commit.
+// If the changes can't be staged, the resources stay pending, and their content hashes are forgotten:
+// they will be written (and staged) again the next time they are saved.
+func (b *CommitBatch) stage() error {
+	if len(b.pending) == 0 {
+		return nil
+	}
+
+	paths := []string{}
+	for _, gr := range b.pending {
+		for _, path := range []string{gr.path, gr.previousPath} {
+			if len(path) > 0 {
+				paths = append(paths, path, store.SidecarDir(path))
+			}
+		}
+	}
+	changes, err := b.repository.backend.Stage(paths...)
+	if err != nil {
+		b.forgetHashes()
+		return err
+	}
+
+	for _, gr := range b.pending {
+		// the file itself may not have changed, but its sidecar files may have
+		change := changes[gr.path]
+		if len(change) == 0 && len(changes[store.SidecarDir(gr.path)]) > 0 {
+			change = ChangeModified
+		}
+
+		staged, found := b.changesByPath[gr.path]
+		if !found {
+			if len(change) == 0 {
+				continue
+			}
+			staged = &stagedChange{}
+			b.changes = append(b.changes, staged)
+			b.changesByPath[gr.path] = staged
+		}
+		// if the resource has already been changed in this batch,
+		// the type of change is still compared to the last commit
+		staged.change = change
+		staged.description = gr.resource.String()
+		staged.author = gr.resource.Author
+		staged.trailers = resourceTrailers(gr.resource)
+	}
+	b.pending = nil
+	return nil
+}
+
+// Len returns the number of resources changed in the batch.
+// The pending changes are staged first: if they can't be, they are counted as changes
+// (the error will be returned by Commit).
+func (b *CommitBatch) Len() int {
+	count := 0
+	if err := b.stage(); err != nil {
+		glog.Warningf("Failed to stage %d changes: %v", len(b.pending), err)
+		count = len(b.pending)
+	}
+	for _, staged := range b.changes {
+		if len(staged.change) > 0 {
+			count++
+		}
+	}
+	return count
+}
+
+// Summary returns a short summary of the staged changes in the batch,
+// with the number of added, modified and deleted resources - like "+12 ~30 -4"
+func (b *CommitBatch) Summary() string {
+	var added, modified, deleted int
+	for _, staged := range b.changes {
+		switch staged.change {
+		case ChangeAdded:
+			added++
+		case ChangeModified:
+			modified++
+		case ChangeDeleted:
+			deleted++
+		}
+	}
+	return fmt.Sprintf("+%d ~%d -%d", added, modified, deleted)
+}
+
+// Commit commits all the changes of the batch in a single commit,
+// with the given title followed by the list of changed resources.
+// The batch is then reset, and can be used for new changes.
+func (b *CommitBatch) Commit(title string) error {
+	defer b.reset()
+
+	if err := b.stage(); err != nil {
+		b.repository.backend.Reset()
+		return err
+	}
+	if b.Len() == 0 {
+		return nil
+	}
+
+	commitMsg := &bytes.Buffer{}
+	fmt.Fprintf(commitMsg, "%s: %s\n\n", title, b.Summary())
+	for _, staged := range b.changes {
+		var line string
+		switch staged.change {
+		case ChangeAdded:
+			line = fmt.Sprintf("+ %s", staged.description)
+		case ChangeModified:
+			line = fmt.Sprintf("~ %s", staged.description)
+		case ChangeDeleted:
+			line = fmt.Sprintf("- %s", staged.description)
+		default:
+			continue
+		}
+		if staged.author != nil {
+			line = fmt.Sprintf("%s (by %s)", line, staged.author.Name)
+		}
+		fmt.Fprintln(commitMsg, line)
+	}
+
+	// the trailers of each resource, followed by the trailers of the repository
+	fmt.Fprintln(commitMsg)
+	for _, staged := range b.changes {
+		if len(staged.change) == 0 {
+			continue
+		}
+		for _, trailer := range staged.trailers {
+			fmt.Fprintln(commitMsg, trailer)
+		}
+	}
+	for _, trailer := range b.repository.clusterTrailers() {
+		fmt.Fprintln(commitMsg, trailer)
+	}
+
+	if err := b.repository.backend.Commit(commitMsg.String(), backendAuthor(b.author())); err != nil {
+		b.repository.backend.Reset()
+		b.forgetHashes()
+		return err
+	}
+
+	return nil
+}
+
+// author returns the author of all the changes of the batch,
+// or nil if the changes have been made by different (or unknown) authors
+func (b *CommitBatch) author() *openshift.Author {
+	var author *openshift.Author
+	for _, staged := range b.changes {
+		if len(staged.change) == 0 {
+			continue
+		}
+		if staged.author == nil {
+			return nil
+		}
+		if author != nil && *author != *staged.author {
+			return nil
+		}
+		author = staged.author
+	}
+	return author
+}
+
+// forgetHashes forgets the content hashes of the resources of the batch (staged or pending),
+// so that they will be written (and staged) again the next time they are saved
+func (b *CommitBatch) forgetHashes() {
+	paths := []string{}
+	for path := range b.changesByPath {
+		paths = append(paths, path)
+	}
+	for _, gr := range b.pending {
+		paths = append(paths, gr.path)
+	}
+	b.repository.index.ForgetHashes(paths...)
+}
+
+// reset removes all the changes from the batch
+func (b *CommitBatch) reset() {
+	b.changes = nil
+	b.changesByPath = map[string]*stagedChange{}
+	b.pending = nil
+}
@@ -1,20 +1,172 @@
 package git
 
 import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/vbehar/openshift-git/pkg/git/backend"
+	"github.com/vbehar/openshift-git/pkg/gitobj"
+	"github.com/vbehar/openshift-git/pkg/openshift"
+
 	git "github.com/gogits/git-module"
+	"github.com/golang/glog"
+)
+
+// Change types returned by GitResource.Change
+const (
+	ChangeAdded    = backend.ChangeAdded
+	ChangeModified = backend.ChangeModified
+	ChangeDeleted  = backend.ChangeDeleted
 )
 
-// IsFileNewOrModified checks if the given file is either new or modified
-// in the given git repository.
-func IsFileNewOrModified(repoPath, file string) (bool, error) {
-	output, err := git.NewCommand("ls-files", "-m", "-o", file).RunInDir(repoPath)
-	return len(output) > 0, err
+// CommitChanges commits the staged changes in the given repository, with the given message.
+// If an author is provided, it is used instead of the configured user
+// - its name and email are cleaned (see gitobj.CleanIdent).
+// The commit is signed if ConfigureSigning has been called.
+func CommitChanges(repoPath, message string, author *openshift.Author) error {
+	cmd := newCommand("commit", "-m", message)
+	if author != nil {
+		cmd.AddArguments(fmt.Sprintf("--author=%s <%s>", gitobj.CleanIdent(author.Name), gitobj.CleanIdent(author.Email)))
+	}
+	_, err := cmd.RunInDir(repoPath)
+	return err
 }
 
-// Pull pulls changes from given remote branch.
+// Pull pulls changes from given remote branch:
+// it fetches the remote branch, and then rebases the local commits on top of it (see Rebase).
 func Pull(repoPath, remote, branch string) error {
-	_, err := git.NewCommand("pull", remote, branch).RunInDir(repoPath)
-	return err
+	if _, err := git.NewCommand("fetch", remote, branch).RunInDir(repoPath); err != nil {
+		return err
+	}
+	return Rebase(repoPath, fmt.Sprintf("%s/%s", remote, branch))
+}
+
+// HeadCommit returns the ID of the commit pointed by HEAD,
+// or an empty string if there is none (or if it can't be read)
+func HeadCommit(repoPath string) string {
+	head, err := git.NewCommand("rev-parse", "--verify", "-q", "HEAD").RunInDir(repoPath)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(head)
+}
+
+// Push pushes the given branch to the given remote,
+// with the annotated tags (like the snapshot tags) pointing to its commits.
+// The git command is killed if the given stop channel is closed before it is done
+// (or after the default timeout of the git commands).
+func Push(repoPath, remote, branch string, stop <-chan struct{}) error {
+	cmd := exec.Command("git", "push", "--follow-tags", remote, branch)
+	cmd.Dir = repoPath
+	output := &bytes.Buffer{}
+	cmd.Stdout = output
+	cmd.Stderr = output
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	var reason string
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("%v - %s", err, strings.TrimSpace(output.String()))
+		}
+		return nil
+	case <-stop:
+		reason = "stopped"
+	case <-time.After(git.DEFAULT_TIMEOUT):
+		reason = fmt.Sprintf("timed out after %v", git.DEFAULT_TIMEOUT)
+	}
+
+	if err := cmd.Process.Kill(); err != nil {
+		glog.Warningf("Failed to kill the push to %s: %v", remote, err)
+	}
+	<-done
+	return fmt.Errorf("Push to %s %s", remote, reason)
+}
+
+// ConflictError is returned by Rebase when the conflicts with the upstream
+// can't be resolved automatically - like a file modified on one side and deleted on the other.
+type ConflictError struct {
+	// Upstream is the upstream on which the local commits could not be rebased
+	Upstream string
+
+	// Files are the files in conflict
+	Files []string
+
+	// RebaseErr and MergeErr are the errors of the rebase and of the merge
+	RebaseErr, MergeErr error
+}
+
+// Error returns a description of the conflicts
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("Unresolved conflicts with %s on %v: failed to rebase (%v) and to merge (%v)", e.Upstream, e.Files, e.RebaseErr, e.MergeErr)
+}
+
+// IsConflict returns true if the given error is a ConflictError
+func IsConflict(err error) bool {
+	_, ok := err.(*ConflictError)
+	return ok
+}
+
+// Rebase rebases the local commits on top of the given upstream.
+// The conflicts are resolved in favor of the local commits, which represent the state of the cluster.
+// If the rebase fails, it falls back to a merge (with the same strategy),
+// and if it still fails, everything is aborted, so that the working tree is left clean
+// - and a ConflictError is returned.
+func Rebase(repoPath, upstream string) error {
+	_, rebaseErr := newCommand("rebase", "-X", "theirs", upstream).RunInDir(repoPath)
+	if rebaseErr == nil {
+		return nil
+	}
+	git.NewCommand("rebase", "--abort").RunInDir(repoPath)
+
+	if _, err := newCommand("merge", "-X", "ours", "--no-edit", upstream).RunInDir(repoPath); err != nil {
+		// the strategy option does not resolve the modify/delete conflicts
+		output, _ := git.NewCommand("diff", "--name-only", "--diff-filter=U").RunInDir(repoPath)
+		git.NewCommand("merge", "--abort").RunInDir(repoPath)
+		return &ConflictError{
+			Upstream:  upstream,
+			Files:     strings.Fields(output),
+			RebaseErr: rebaseErr,
+			MergeErr:  err,
+		}
+	}
+	return nil
+}
+
+// AbortRebaseOrMerge aborts the rebase or the merge in progress in the given repository (if any),
+// for example if the process has been stopped in the middle of a pull:
+// the working tree is left as before the pull.
+func AbortRebaseOrMerge(repoPath string) error {
+	gitDir := filepath.Join(repoPath, ".git")
+	for _, dir := range []string{"rebase-merge", "rebase-apply"} {
+		if _, err := os.Stat(filepath.Join(gitDir, dir)); err == nil {
+			glog.Warningf("Aborting the rebase in progress in %s", repoPath)
+			if _, err := git.NewCommand("rebase", "--abort").RunInDir(repoPath); err != nil {
+				return fmt.Errorf("Failed to abort the rebase in progress in %s: %v", repoPath, err)
+			}
+			break
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(gitDir, "MERGE_HEAD")); err == nil {
+		glog.Warningf("Aborting the merge in progress in %s", repoPath)
+		if _, err := git.NewCommand("merge", "--abort").RunInDir(repoPath); err != nil {
+			return fmt.Errorf("Failed to abort the merge in progress in %s: %v", repoPath, err)
+		}
+	}
+	return nil
 }
 
 // SetUserName sets the user's name for the given repository
@@ -0,0 +1,231 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/vbehar/openshift-git/pkg/gitobj"
+	"github.com/vbehar/openshift-git/pkg/openshift"
+	"github.com/vbehar/openshift-git/pkg/sidecar"
+	"github.com/vbehar/openshift-git/pkg/store"
+
+	"k8s.io/kubernetes/pkg/api/unversioned"
+
+	git "github.com/gogits/git-module"
+	"github.com/golang/glog"
+)
+
+// buildIndex builds the index of the resources of the repository, if it has not been built yet
+func (r *Repository) buildIndex() error {
+	return r.index.Build(func(add func(kind, key, path, hash string)) error {
+		// the files not committed yet can't be trusted: their hashes are not indexed,
+		// so that they are written (and committed) again
+		dirty, err := dirtyFiles(r.Path)
+		if err != nil {
+			return err
+		}
+
+		// the hashes of the committed files are the blob OIDs of the last commit,
+		// so that the files don't need to be read
+		head, err := headTree(r.Path)
+		if err != nil {
+			return err
+		}
+
+		count := 0
+		paths := r.paths()
+		err = r.WalkResources(func(path string, resource *openshift.Resource) error {
+			var hash string
+			if !isDirty(dirty, path) {
+				hash = committedHash(r.Path, head, path)
+			}
+			add(paths.IndexKind(resource.GroupKind()), resource.NamespacedName(), path, hash)
+			count++
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		glog.V(1).Infof("Indexed %d resources in %s", count, r.PathWithContextDir())
+		return nil
+	})
+}
+
+// indexedKeys returns the keys of the indexed resources of the given kind
+func (r *Repository) indexedKeys(gk unversioned.GroupKind) ([]string, error) {
+	if err := r.buildIndex(); err != nil {
+		return nil, err
+	}
+	return r.index.Keys(r.paths().IndexKind(gk)), nil
+}
+
+// indexedFile returns the path and the content hash of the indexed file
+// of the resource of the given kind and key, in the given format
+// - or empty strings if there is none.
+func (r *Repository) indexedFile(gk unversioned.GroupKind, key, format string) (string, string, error) {
+	if err := r.buildIndex(); err != nil {
+		return "", "", err
+	}
+	path, hash := r.index.File(r.paths().IndexKind(gk), key, format)
+	return path, hash, nil
+}
+
+// indexFile records the given file of the given resource in the index (if it has been built)
+func (r *Repository) indexFile(resource *openshift.Resource, path, hash string) {
+	r.index.Add(r.paths().IndexKind(resource.GroupKind()), resource.NamespacedName(), path, hash)
+}
+
+// unindexFile removes the given file of the given resource from the index (if it has been built)
+func (r *Repository) unindexFile(resource *openshift.Resource, path string) {
+	r.index.Remove(r.paths().IndexKind(resource.GroupKind()), resource.NamespacedName(), path)
+}
+
+// headTree returns the tree of the last commit of the given repository
+// (an empty tree if there is no commit yet)
+func headTree(repoPath string) (*gitobj.Tree, error) {
+	if _, err := git.NewCommand("rev-parse", "--verify", "-q", "HEAD").RunInDir(repoPath); err != nil {
+		// no commit yet
+		return gitobj.NewTree(), nil
+	}
+	output, err := git.NewCommand("ls-tree", "-r", "-z", "HEAD").RunInDir(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	return gitobj.ParseLsTree(output)
+}
+
+// committedHash returns the content hash (see store.BlobsHash) of the resource stored at the given path
+// in the given tree of the last commit of the repository, with its sidecar files
+// - or an empty string if it has not been committed.
+func committedHash(repoPath string, head *gitobj.Tree, path string) string {
+	rel, err := filepath.Rel(repoPath, path)
+	if err != nil {
+		return ""
+	}
+	rel = filepath.ToSlash(rel)
+	entry, found := head.Get(rel)
+	if !found {
+		return ""
+	}
+
+	files := map[string]string{}
+	for name, hash := range committedSidecarFiles(head, rel) {
+		files[name] = hash.String()
+	}
+	return store.BlobsHash(entry.Hash.String(), files)
+}
+
+// committedSidecarFiles returns the blob OIDs (per name) of the sidecar files
+// of the resource stored at the given path (relative to the repository) in the given tree
+func committedSidecarFiles(head *gitobj.Tree, rel string) map[string]gitobj.Hash {
+	dir := strings.TrimSuffix(rel, filepath.Ext(rel)) + sidecar.DirSuffix
+	files := map[string]gitobj.Hash{}
+	for _, p := range head.Files(dir) {
+		// like the sidecar files read by store.FileHash
+		name := strings.TrimPrefix(p, dir+"/")
+		if file, found := head.Get(p); found && !strings.Contains(name, "/") {
+			files[name] = file.Hash
+		}
+	}
+	return files
+}
+
+// ReadCommittedResourceFile reads the content of the resource stored at the given path,
+// as committed in the last commit of the repository - with the payloads of its committed sidecar files
+// joined back into it (see store.ReadResourceFile), so that the changes not committed yet are ignored.
+// The error satisfies os.IsNotExist if the resource has not been committed.
+func (r *Repository) ReadCommittedResourceFile(path string) ([]byte, error) {
+	head, err := r.committedTree()
+	if err != nil {
+		return nil, err
+	}
+
+	rel, err := filepath.Rel(r.Path, path)
+	if err != nil {
+		return nil, err
+	}
+	rel = filepath.ToSlash(rel)
+	entry, found := head.Get(rel)
+	if !found {
+		return nil, &os.PathError{Op: "read", Path: path, Err: os.ErrNotExist}
+	}
+	content, err := readBlob(r.Path, entry.Hash)
+	if err != nil {
+		return nil, err
+	}
+
+	files := committedSidecarFiles(head, rel)
+	return sidecar.Join(content, strings.TrimPrefix(filepath.Ext(path), "."), func(name string) ([]byte, error) {
+		hash, found := files[name]
+		if !found {
+			return nil, &os.PathError{Op: "read", Path: filepath.Join(store.SidecarDir(path), name), Err: os.ErrNotExist}
+		}
+		return readBlob(r.Path, hash)
+	})
+}
+
+// committedTree returns the tree of the last commit of the repository,
+// read again only if a new commit has been made since the last call
+func (r *Repository) committedTree() (*gitobj.Tree, error) {
+	r.committedLock.Lock()
+	defer r.committedLock.Unlock()
+
+	commit := HeadCommit(r.Path)
+	if r.committed == nil || commit != r.committedCommit {
+		head, err := headTree(r.Path)
+		if err != nil {
+			return nil, err
+		}
+		r.committed = head
+		r.committedCommit = commit
+	}
+	return r.committed, nil
+}
+
+// readBlob returns the content of the blob with the given OID in the given repository
+func readBlob(repoPath string, hash gitobj.Hash) ([]byte, error) {
+	return git.NewCommand("cat-file", "blob", hash.String()).RunInDirBytes(repoPath)
+}
+
+// minNoOptionalLocksVersion is the minimal version of git supporting the "--no-optional-locks" option
+const minNoOptionalLocksVersion = "2.15.0"
+
+// dirtyFiles returns the (absolute) paths of the files of the given repository
+// that are new or modified, compared to the last commit - and the paths of their parent directories
+func dirtyFiles(repoPath string) (map[string]bool, error) {
+	args := []string{"status", "--porcelain", "-z", "--untracked-files=all"}
+	// the index is built from the reflectors, while the changes are staged and committed concurrently:
+	// git status must not take the index.lock to refresh the index, or the commits could fail
+	if checkGitVersion(minNoOptionalLocksVersion, "Reading the status without locking the index") == nil {
+		args = append([]string{"--no-optional-locks"}, args...)
+	}
+	output, err := git.NewCommand(args...).RunInDir(repoPath)
+	if err != nil {
+		return nil, err
+	}
+
+	dirty := map[string]bool{}
+	entries := strings.Split(output, "\x00")
+	for i := 0; i < len(entries); i++ {
+		entry := entries[i]
+		if len(entry) < 4 {
+			continue
+		}
+		file := filepath.Join(repoPath, entry[3:])
+		dirty[file] = true
+		dirty[filepath.Dir(file)] = true
+		if entry[0] == 'R' || entry[0] == 'C' {
+			// followed by the original path
+			i++
+		}
+	}
+	return dirty, nil
+}
+
+// isDirty returns true if the given file of a resource, or one of its sidecar files, is dirty
+// (see dirtyFiles)
+func isDirty(dirty map[string]bool, path string) bool {
+	return dirty[path] || dirty[store.SidecarDir(path)]
+}
@@ -0,0 +1,263 @@
+package git
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/vbehar/openshift-git/pkg/git/backend"
+	"github.com/vbehar/openshift-git/pkg/layout"
+	"github.com/vbehar/openshift-git/pkg/sidecar"
+	"github.com/vbehar/openshift-git/pkg/store"
+
+	"k8s.io/kubernetes/pkg/api/unversioned"
+
+	"github.com/ghodss/yaml"
+	git "github.com/gogits/git-module"
+	"github.com/golang/glog"
+)
+
+// move represents the move of a single file, from a layout to another
+type move struct {
+	from string
+	to   string
+}
+
+// rename represents a rename on the filesystem, that can be undone
+type rename struct {
+	from string
+	to   string
+}
+
+// MigrateLayout moves all the resources stored in the repository from the current layout
+// to the given layout (with their sidecar files), and records the changes in a single commit.
+// The layout of the repository is then set to the given layout.
+// The migration is atomic: if a resource can't be moved (or the commit fails),
+// all the resources are moved back, and the layout is not changed.
+// Returns the number of moved resources.
+func (r *Repository) MigrateLayout(to *layout.Layout) (int, error) {
+	moves := []move{}
+	targets := map[string]string{}
+	sources := map[string]bool{}
+	otherClusters := 0
+	err := filepath.Walk(r.PathWithContextDir(), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if info.Name() == ".git" || sidecar.IsSidecarDir(path) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		fields, ok := r.layoutFieldsFromPath(path)
+		if !ok {
+			return nil
+		}
+		if r.Layout.HasVariable("cluster") && fields.Cluster != layout.Sanitize(r.ClusterName) {
+			otherClusters++
+			return nil
+		}
+		fields.Cluster = r.ClusterName
+
+		target := filepath.Join(r.PathWithContextDir(), filepath.FromSlash(to.Path(fields))+filepath.Ext(path))
+		if other, found := targets[target]; found {
+			return fmt.Errorf("Both %s and %s would be moved to %s", other, path, target)
+		}
+		targets[target] = path
+		sources[path] = true
+
+		if target != path {
+			moves = append(moves, move{from: path, to: target})
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if len(targets) == 0 && otherClusters > 0 {
+		return 0, fmt.Errorf("No resources of the cluster %s found in the layout %s, but %d resources of other clusters", r.ClusterName, r.Layout.Template, otherClusters)
+	}
+
+	// the files that are not moved are not overwritten
+	for _, m := range moves {
+		if _, err := os.Stat(m.to); err == nil && !sources[m.to] {
+			return 0, fmt.Errorf("Can't move %s to %s: the file already exists", m.from, m.to)
+		}
+	}
+
+	renames, err := r.moveFiles(moves)
+	if err != nil {
+		r.undoRenames(renames)
+		return 0, err
+	}
+
+	fromLayout := r.Layout
+	r.Layout = to
+	r.index.Invalidate()
+
+	if len(moves) == 0 {
+		return 0, nil
+	}
+
+	rollback := func() {
+		git.ResetHEAD(r.Path, false, "HEAD")
+		r.undoRenames(renames)
+		r.Layout = fromLayout
+		r.index.Invalidate()
+	}
+
+	// the index may be outdated if the last commits have been written by the objects backend
+	if err := backend.ResetIndex(r.Path); err != nil {
+		rollback()
+		return 0, err
+	}
+	if err := git.AddChanges(r.Path, true, r.PathWithContextDir()); err != nil {
+		rollback()
+		return 0, err
+	}
+
+	commitMsg := fmt.Sprintf("Migrate layout from %s to %s: %d resources moved\n", fromLayout.Template, to.Template, len(moves))
+	if trailers := r.clusterTrailers(); len(trailers) > 0 {
+		commitMsg = fmt.Sprintf("%s\n%s\n", commitMsg, strings.Join(trailers, "\n"))
+	}
+	if err := CommitChanges(r.Path, commitMsg, nil); err != nil {
+		rollback()
+		return 0, err
+	}
+
+	return len(moves), nil
+}
+
+// moveFiles moves the given files (with their sidecar files),
+// through a temporary directory - so that a file can be moved to the previous path of another one.
+// Returns the renames done, to undo them in case of error.
+func (r *Repository) moveFiles(moves []move) ([]rename, error) {
+	renames := []rename{}
+	if len(moves) == 0 {
+		return renames, nil
+	}
+
+	tmpDir, err := ioutil.TempDir(filepath.Join(r.Path, ".git"), "migrate-")
+	if err != nil {
+		return renames, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	doRename := func(from, to string) error {
+		if err := os.MkdirAll(filepath.Dir(to), os.ModePerm); err != nil {
+			return err
+		}
+		if err := os.Rename(from, to); err != nil {
+			return err
+		}
+		renames = append(renames, rename{from: from, to: to})
+		return nil
+	}
+
+	tmpFiles := make([]string, len(moves))
+	for i, m := range moves {
+		tmpFiles[i] = filepath.Join(tmpDir, fmt.Sprintf("%d", i))
+		if err := doRename(m.from, tmpFiles[i]); err != nil {
+			return renames, err
+		}
+		if _, err := os.Stat(store.SidecarDir(m.from)); err == nil {
+			if err := doRename(store.SidecarDir(m.from), store.SidecarDir(tmpFiles[i])); err != nil {
+				return renames, err
+			}
+		}
+	}
+
+	for i, m := range moves {
+		glog.V(2).Infof("Moving %s to %s", m.from, m.to)
+		if err := doRename(tmpFiles[i], m.to); err != nil {
+			return renames, err
+		}
+		if _, err := os.Stat(store.SidecarDir(tmpFiles[i])); err == nil {
+			if err := doRename(store.SidecarDir(tmpFiles[i]), store.SidecarDir(m.to)); err != nil {
+				return renames, err
+			}
+		}
+	}
+
+	for _, m := range moves {
+		removeEmptyDirs(filepath.Dir(m.from), r.PathWithContextDir())
+	}
+	return renames, nil
+}
+
+// undoRenames undoes the given renames, in the reverse order
+func (r *Repository) undoRenames(renames []rename) {
+	for i := len(renames) - 1; i >= 0; i-- {
+		rn := renames[i]
+		if err := os.MkdirAll(filepath.Dir(rn.from), os.ModePerm); err != nil {
+			glog.Errorf("Failed to move %s back to %s: %v", rn.to, rn.from, err)
+			continue
+		}
+		if err := os.Rename(rn.to, rn.from); err != nil {
+			glog.Errorf("Failed to move %s back to %s: %v", rn.to, rn.from, err)
+			continue
+		}
+		removeEmptyDirs(filepath.Dir(rn.to), r.PathWithContextDir())
+	}
+}
+
+// layoutFieldsFromPath returns all the fields that may be used in a layout,
+// for the resource stored at the given path: from the path itself,
+// and from the content of the file (labels and API group).
+// The cluster is the (sanitized) one from the path.
+func (r *Repository) layoutFieldsFromPath(path string) (layout.Fields, bool) {
+	if !strings.HasPrefix(path, r.PathWithContextDir()+"/") {
+		return layout.Fields{}, false
+	}
+
+	relPath := strings.TrimPrefix(path, r.PathWithContextDir()+"/")
+	relPath = strings.TrimSuffix(relPath, filepath.Ext(relPath))
+	fields, ok := r.Layout.Parse(filepath.ToSlash(relPath))
+	if !ok {
+		return layout.Fields{}, false
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		glog.Warningf("Failed to read %s: %v", path, err)
+		return fields, true
+	}
+
+	var object struct {
+		APIVersion string `json:"apiVersion"`
+		Metadata   struct {
+			Labels map[string]string `json:"labels"`
+		} `json:"metadata"`
+	}
+	if err := yaml.Unmarshal(content, &object); err != nil {
+		glog.Warningf("Failed to read %s: %v", path, err)
+		return fields, true
+	}
+
+	fields.Labels = object.Metadata.Labels
+	if len(fields.Group) == 0 {
+		if gv, err := unversioned.ParseGroupVersion(object.APIVersion); err == nil {
+			fields.Group = gv.Group
+		}
+	}
+	return fields, true
+}
+
+// removeEmptyDirs removes the given directory if it is empty,
+// and then its parents - until the given root directory (excluded)
+func removeEmptyDirs(dir, root string) {
+	for strings.HasPrefix(dir, root+"/") {
+		files, err := ioutil.ReadDir(dir)
+		if err != nil || len(files) > 0 {
+			return
+		}
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
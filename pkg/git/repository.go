@@ -5,15 +5,36 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
-	"strings"
+	"sync"
+	"time"
 
+	"github.com/vbehar/openshift-git/pkg/git/backend"
+	"github.com/vbehar/openshift-git/pkg/gitobj"
+	"github.com/vbehar/openshift-git/pkg/layout"
 	"github.com/vbehar/openshift-git/pkg/openshift"
+	"github.com/vbehar/openshift-git/pkg/store"
+
+	"k8s.io/kubernetes/pkg/api/unversioned"
 
 	git "github.com/gogits/git-module"
 	"github.com/golang/glog"
 )
 
-// Repository represents a Git repository
+// Repository implements the store.Store interface
+var _ store.Store = &Repository{}
+
+// defaultLayout is the default layout of the resources in a repository
+var defaultLayout, _ = layout.New(layout.DefaultTemplate)
+
+const (
+	// DefaultPushRetries is the default number of times a failed push is retried
+	DefaultPushRetries = 5
+
+	// DefaultPushBackoff is the default delay before retrying a failed push
+	DefaultPushBackoff = 1 * time.Second
+)
+
+// Repository represents a Git repository, used as a store.Store
 type Repository struct {
 	// The underlying git repository
 	*git.Repository
@@ -31,6 +52,51 @@ type Repository struct {
 	// ContextDir is the (optional) path (relative to `Path`)
 	// which will be used inside the repository.
 	ContextDir string
+
+	// ClusterName is the (optional) name of the cluster
+	// from which the resources are exported. It is recorded in the commits.
+	ClusterName string
+
+	// Layout is the layout of the resources in the repository
+	// (see SetLayout)
+	Layout *layout.Layout
+
+	// PushRetries is the number of times a failed push is retried
+	PushRetries int
+
+	// PushBackoff is the delay before retrying a failed push.
+	// It is doubled after each retry.
+	PushBackoff time.Duration
+
+	// index is the in-memory index of the resources stored in the repository
+	index *store.Index
+
+	// backend is used to stage and commit the changes of the resources (see SetBackend)
+	backend backend.Backend
+
+	// conflictLock protects conflict
+	conflictLock sync.Mutex
+
+	// conflict is the ConflictError of the last pull (if any), reported by CheckWritable
+	conflict error
+
+	// pushLock protects pushStop
+	pushLock sync.Mutex
+
+	// pushStop is closed by StopPush, to kill the running push and stop retrying the failed pushes
+	pushStop chan struct{}
+
+	// pushing is used by Close to wait for the push in progress (if any)
+	pushing sync.WaitGroup
+
+	// committedLock protects committed and committedCommit
+	committedLock sync.Mutex
+
+	// committed is the tree of the last commit, read by ReadCommittedResourceFile
+	committed *gitobj.Tree
+
+	// committedCommit is the ID of the commit of the committed tree
+	committedCommit string
 }
 
 // NewRepository instantiates a new Git repository at the given path.
@@ -66,6 +132,16 @@ func NewRepository(path, branch, remoteURL, contextDir, userName, userEmail stri
 		return nil, err
 	}
 
+	// a pull may have been interrupted (by a timeout on shutdown for example)
+	if err := AbortRebaseOrMerge(path); err != nil {
+		return nil, err
+	}
+
+	// the index may be outdated if the objects backend has been stopped abruptly
+	if err := backend.ResetIndex(path); err != nil {
+		return nil, err
+	}
+
 	if err := setRepositoryAuthor(path, userName, userEmail); err != nil {
 		return nil, err
 	}
@@ -78,11 +154,16 @@ func NewRepository(path, branch, remoteURL, contextDir, userName, userEmail stri
 	}
 
 	repository := &Repository{
-		Repository: repo,
-		Path:       path,
-		Branch:     branch,
-		RemoteURL:  remoteURL,
-		ContextDir: contextDir,
+		Repository:  repo,
+		Path:        path,
+		Branch:      branch,
+		RemoteURL:   remoteURL,
+		ContextDir:  contextDir,
+		Layout:      defaultLayout,
+		PushRetries: DefaultPushRetries,
+		PushBackoff: DefaultPushBackoff,
+		index:       store.NewIndex(),
+		backend:     backend.NewCLI(path, newCommand),
 	}
 
 	if err := repo.SetDefaultBranch(branch); err != nil {
@@ -119,7 +200,7 @@ func NewRepository(path, branch, remoteURL, contextDir, userName, userEmail stri
 		if err := git.AddChanges(path, true); err != nil {
 			return nil, err
 		}
-		if err := git.CommitChanges(path, "Initial commit", nil); err != nil {
+		if err := CommitChanges(path, "Initial commit", nil); err != nil {
 			return nil, err
 		}
 		if err := repository.Push(); err != nil {
@@ -130,67 +211,257 @@ func NewRepository(path, branch, remoteURL, contextDir, userName, userEmail stri
 	return repository, nil
 }
 
+// OpenExistingRepository opens the existing Git repository at the given path,
+// without creating or cloning anything.
+// It returns an error if there is no valid repository at the given path.
+func OpenExistingRepository(path, contextDir string) (*Repository, error) {
+	if valid, err := isValidGitRepository(path); !valid {
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%s is not a valid git repository", path)
+	}
+
+	repo, err := git.OpenRepository(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Repository{
+		Repository:  repo,
+		Path:        path,
+		ContextDir:  contextDir,
+		Layout:      defaultLayout,
+		PushRetries: DefaultPushRetries,
+		PushBackoff: DefaultPushBackoff,
+		index:       store.NewIndex(),
+		backend:     backend.NewCLI(path, newCommand),
+	}, nil
+}
+
+// SetLayout sets the layout of the resources in the repository, from the given template
+// (see layout.Layout for the syntax).
+// If the template is empty, the default layout is used - with the kinds qualified
+// by their API group (like "Deployment.extensions") if groupLayout is true,
+// so that kinds with the same name in different API groups don't collide.
+func (r *Repository) SetLayout(template string, groupLayout bool) error {
+	l, err := layout.ForTemplate(template, groupLayout)
+	if err != nil {
+		return err
+	}
+	r.Layout = l
+
+	// the kinds and paths of the resources depend on the layout
+	r.index.Invalidate()
+	return nil
+}
+
+// SetBackend sets the backend used to stage and commit the changes of the resources:
+// backend.CLI or backend.Objects.
+// The commits can't be signed by the objects backend, so the CLI backend
+// is used instead if ConfigureSigning has been called.
+func (r *Repository) SetBackend(name string) error {
+	if name == backend.Objects && len(signingKey) > 0 {
+		glog.Warningf("The %s backend can't sign the commits, using the %s backend instead", backend.Objects, backend.CLI)
+		name = backend.CLI
+	}
+
+	b, err := backend.New(name, r.Path, newCommand)
+	if err != nil {
+		return err
+	}
+	if err := r.backend.Close(); err != nil {
+		return err
+	}
+	r.backend = b
+	glog.V(1).Infof("Using the %s backend", name)
+	return nil
+}
+
+// Close closes the backend of the repository,
+// so that the repository can be used by the git binary (see backend.Backend).
+// The push in progress (if any) is stopped first (see StopPush).
+func (r *Repository) Close() error {
+	r.StopPush()
+	r.pushing.Wait()
+	return r.backend.Close()
+}
+
 // Pull pulls from the configured remote
-// (if a remote as been configured)
+// (if a remote as been configured).
+// The index is rebuilt only if the pull has brought new commits.
 func (r *Repository) Pull() error {
 	if len(r.RemoteURL) > 0 {
-		if err := Pull(r.Path, "origin", r.Branch); err != nil {
+		if err := r.backend.Sync(); err != nil {
 			return err
 		}
+		head := HeadCommit(r.Path)
+		err := Pull(r.Path, "origin", r.Branch)
+		r.recordConflict(err)
+		if HeadCommit(r.Path) != head {
+			// the remote commits may change any file
+			r.index.Invalidate()
+		}
+		if syncErr := r.backend.Sync(); err == nil {
+			err = syncErr
+		}
+		return err
 	}
 	return nil
 }
 
 // Push pushes to the configured remote
-// (if a remote as been configured)
+// (if a remote as been configured), with the snapshot tags
+// If the push fails (for example if someone else pushed to the same branch),
+// it pulls (rebasing the local commits on top of the remote ones) and retries,
+// up to PushRetries times, with an exponential backoff - or until StopPush is called.
 func (r *Repository) Push() error {
-	if len(r.RemoteURL) > 0 {
-		if err := git.Push(r.Path, "origin", r.Branch); err != nil {
-			return err
+	if len(r.RemoteURL) == 0 {
+		return nil
+	}
+
+	r.pushing.Add(1)
+	defer r.pushing.Done()
+
+	stop := r.pushStopChan()
+	backoff := r.PushBackoff
+	for attempt := 0; ; attempt++ {
+		err := Push(r.Path, "origin", r.Branch, stop)
+		if err == nil {
+			return nil
+		}
+		if attempt >= r.PushRetries {
+			return fmt.Errorf("Failed to push after %d attempts: %v", attempt+1, err)
+		}
+
+		glog.Warningf("Failed to push to %s (attempt %d/%d), retrying in %v: %v", r.RemoteURL, attempt+1, r.PushRetries+1, backoff, err)
+		select {
+		case <-stop:
+			return fmt.Errorf("Push stopped after %d attempts: %v", attempt+1, err)
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+
+		// the remote branch may have new commits
+		if err := r.Pull(); err != nil {
+			glog.Warningf("Failed to pull from %s: %v", r.RemoteURL, err)
+		}
+
+		select {
+		case <-stop:
+			return fmt.Errorf("Push stopped after %d attempts: %v", attempt+1, err)
+		default:
 		}
 	}
-	return nil
 }
 
-// PathForResource returns the full absolute path of the given resource, for the given format
-func (r *Repository) PathForResource(resource *openshift.Resource, format string) string {
-	filename := fmt.Sprintf("%s.%s", resource.Name, format)
-	path := r.PathWithContextDir()
-	if resource.IsNamespaced() {
-		path = filepath.Join(path, "Namespace", resource.Namespace)
+// StopPush stops the pushes: the running git push (if any) is killed,
+// and the failed pushes are not retried anymore.
+// It is safe to call it concurrently with Push.
+func (r *Repository) StopPush() {
+	stop := r.pushStopChan()
+	r.pushLock.Lock()
+	defer r.pushLock.Unlock()
+	select {
+	case <-stop:
+	default:
+		close(stop)
+	}
+}
+
+// pushStopChan returns the channel closed by StopPush
+func (r *Repository) pushStopChan() chan struct{} {
+	r.pushLock.Lock()
+	defer r.pushLock.Unlock()
+	if r.pushStop == nil {
+		r.pushStop = make(chan struct{})
+	}
+	return r.pushStop
+}
+
+// CheckWritable returns an error if the repository can't be written to,
+// or if the last pull failed because of conflicts that can't be resolved automatically
+// (the local commits can't be pushed until they are resolved by hand).
+func (r *Repository) CheckWritable() error {
+	file, err := ioutil.TempFile(filepath.Join(r.Path, ".git"), "openshift-git-check-")
+	if err != nil {
+		return fmt.Errorf("Repository %s is not writable: %v", r.Path, err)
+	}
+	file.Close()
+	if err := os.Remove(file.Name()); err != nil {
+		return err
 	}
-	path = filepath.Join(path, resource.Kind, filename)
 
-	return path
+	r.conflictLock.Lock()
+	defer r.conflictLock.Unlock()
+	return r.conflict
+}
+
+// recordConflict records the result of a pull:
+// the conflicts are reported by CheckWritable, until the next successful pull
+func (r *Repository) recordConflict(err error) {
+	r.conflictLock.Lock()
+	defer r.conflictLock.Unlock()
+	switch {
+	case err == nil:
+		r.conflict = nil
+	case IsConflict(err):
+		r.conflict = err
+	}
+}
+
+// String returns the URL of the remote repository,
+// or the path of the repository if there is no remote
+func (r *Repository) String() string {
+	if len(r.RemoteURL) > 0 {
+		return r.RemoteURL
+	}
+	return r.Path
+}
+
+// Resource returns the given resource, stored in the given format (see NewGitResource)
+func (r *Repository) Resource(resource *openshift.Resource, format string) store.Resource {
+	return NewGitResource(r, resource, format)
+}
+
+// NewBatch returns a new (empty) CommitBatch
+func (r *Repository) NewBatch() store.Batch {
+	return r.NewCommitBatch()
+}
+
+// paths returns the mapping of the resources to the paths of their files in the repository
+func (r *Repository) paths() store.Paths {
+	return store.Paths{
+		Dir:         r.PathWithContextDir(),
+		Layout:      r.Layout,
+		ClusterName: r.ClusterName,
+	}
+}
+
+// PathForResource returns the full absolute path of the given resource, for the given format
+func (r *Repository) PathForResource(resource *openshift.Resource, format string) string {
+	return r.paths().PathForResource(resource, format)
 }
 
 // ResourceFromPath returns a (minimalist) representation of the resource
-// stored at the given path.
-// Returns nil if no resource could be found at that path.
-// Note that the returned resource contains only a reference
-// (with kind, namespace and name), not the resource (content) itself.
+// stored at the given path - see store.Paths.ResourceFromPath
 func (r *Repository) ResourceFromPath(path string) *openshift.Resource {
-	if strings.HasPrefix(path, r.PathWithContextDir()+"/") {
-		path = strings.TrimPrefix(path, r.PathWithContextDir()+"/")
-		elems := strings.Split(path, "/")
-		switch len(elems) {
-		case 4:
-			namespace := elems[1]
-			kind := elems[2]
-			nameWithExtension := elems[3]
-			extension := filepath.Ext(nameWithExtension)
-			name := strings.TrimSuffix(nameWithExtension, extension)
-			return openshift.NewResource(kind, fmt.Sprintf("%s/%s", namespace, name))
-		case 2:
-			kind := elems[0]
-			nameWithExtension := elems[1]
-			extension := filepath.Ext(nameWithExtension)
-			name := strings.TrimSuffix(nameWithExtension, extension)
-			return openshift.NewResource(kind, name)
-		}
-	}
+	return r.paths().ResourceFromPath(path)
+}
 
-	return nil
+// IsResourceOfKind returns true if the given resource is of the given (API group and) kind.
+// The API group is ignored if the layout of the repository does not use it.
+func (r *Repository) IsResourceOfKind(resource *openshift.Resource, gk unversioned.GroupKind) bool {
+	return r.paths().IsResourceOfKind(resource, gk)
+}
+
+// findResourcePath returns the path of the existing file of the resource
+// of the given kind and key ("namespace/name" format), in the given format
+// - or an empty string if it does not exist.
+// It is used when the path can't be computed (if the layout uses labels).
+func (r *Repository) findResourcePath(gk unversioned.GroupKind, key, format string) (string, error) {
+	path, _, err := r.indexedFile(gk, key, format)
+	return path, err
 }
 
 // PathWithContextDir returns the full path of the directory
@@ -202,67 +473,54 @@ func (r *Repository) PathWithContextDir() string {
 	return r.Path
 }
 
-// KeyListFuncForKind returns a ListKeys function, that implements the cache.KeyLister interface
+// KeyListFuncForGroupKind returns a ListKeys function, that implements the cache.KeyLister interface
 // It is a function that returns the list of keys ("namespace/name" format)
 // that we "know about" (to get a 2-way sync) for the given kind of resources.
-// It simply walks the FS to list all the resources matching the given kind.
-func (r *Repository) KeyListFuncForKind(kind string) func() []string {
+// The keys are read from the in-memory index of the resources,
+// which is built by walking the FS the first time.
+func (r *Repository) KeyListFuncForGroupKind(gk unversioned.GroupKind) func() []string {
 	return func() []string {
-		keys := []string{}
-
-		err := filepath.Walk(r.PathWithContextDir(), func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				return err
-			}
-
-			if info.IsDir() && info.Name() == ".git" {
-				return filepath.SkipDir
-			}
-
-			resource := r.ResourceFromPath(path)
-			if resource == nil {
-				return nil
-			}
-			if resource.Kind == kind {
-				key := resource.NamespacedName()
-				glog.V(4).Infof("Found %s for %s at %s for %s", key, resource, path, kind)
-				keys = append(keys, key)
-			}
-			return nil
-		})
+		keys, err := r.indexedKeys(gk)
 		if err != nil {
-			glog.Errorf("Failed to walk FS %s for kind %s: %v", r.PathWithContextDir(), kind, err)
+			glog.Errorf("Failed to walk FS %s for kind %s: %v", r.PathWithContextDir(), gk.String(), err)
 			return []string{}
 		}
 
-		glog.V(2).Infof("Found %d local keys for %s", len(keys), kind)
+		glog.V(2).Infof("Found %d local keys for %s", len(keys), gk.String())
 		return keys
 	}
 }
 
-// KeyGetFuncForKindAndFormat returns a GetByKey function, implements the cache.KeyGetter interface
+// WalkResources walks the FS and calls the given function
+// for each resource stored in the repository, with the path of the file
+// and a (minimalist) representation of the resource - see ResourceFromPath.
+// The sidecar files of the resources are ignored.
+func (r *Repository) WalkResources(walkFn func(path string, resource *openshift.Resource) error) error {
+	return r.paths().WalkResources(walkFn)
+}
+
+// KeyGetFuncForGroupKindAndFormat returns a GetByKey function, implements the cache.KeyGetter interface
 // It is a function that returns the object that we "know about"
 // for the given key ("namespace/name" format) - and a boolean if it exists
 // for the given kind and format.
-func (r *Repository) KeyGetFuncForKindAndFormat(kind, format string) func(key string) (interface{}, bool, error) {
+// The object is looked up in the in-memory index of the resources.
+func (r *Repository) KeyGetFuncForGroupKindAndFormat(gk unversioned.GroupKind, format string) func(key string) (interface{}, bool, error) {
 	return func(key string) (interface{}, bool, error) {
-		resource := openshift.NewResource(kind, key)
-		path := r.PathForResource(resource, format)
-
-		if _, err := os.Stat(path); err != nil {
-			if os.IsNotExist(err) {
-				glog.V(3).Infof("key %s for kind %s does not exists at %s ! %v", key, kind, path, err)
-				return "", false, nil
-			}
+		path, _, err := r.indexedFile(gk, key, format)
+		if err != nil {
 			return "", false, err
 		}
+		if len(path) == 0 {
+			glog.V(3).Infof("key %s for kind %s does not exists", key, gk.String())
+			return "", false, nil
+		}
 
-		glog.V(4).Infof("Found %v for %s %s at %s", resource, kind, key, path)
+		resource := openshift.NewResourceForGroupKind(gk, key)
+		glog.V(4).Infof("Found %v for %s %s at %s", resource, gk.String(), key, path)
 		return *resource, true, nil
 	}
 }
 
-// isValidGitRepository checks if the repository at the given path is valid
 // To be valid, it needs to have an existing ".git" sub-directory
 func isValidGitRepository(path string) (bool, error) {
 	// check main repository directory
@@ -1,13 +1,19 @@
 package git
 
 import (
+	"bytes"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"github.com/vbehar/openshift-git/pkg/git/backend"
 	"github.com/vbehar/openshift-git/pkg/openshift"
+	"github.com/vbehar/openshift-git/pkg/sidecar"
+	"github.com/vbehar/openshift-git/pkg/store"
 
-	git "github.com/gogits/git-module"
+	"github.com/golang/glog"
 )
 
 // GitResource represents an OpenShift resource in a Git repository
@@ -24,8 +30,15 @@ type GitResource struct {
 	// path is the full absolute path on the filesystem where the resource is stored
 	path string
 
+	// previousPath is the path where the resource was previously stored,
+	// if it has moved (when the layout uses labels) - or an empty string
+	previousPath string
+
 	// file is the resource's file on the filesystem
 	file *os.File
+
+	// content is the content written to the file
+	content bytes.Buffer
 }
 
 // NewGitResource instantiates a new GitResource in the given repository, for the given resource, in the given format
@@ -38,17 +51,60 @@ func NewGitResource(repository *Repository, resource *openshift.Resource, format
 		format:     format,
 		path:       path,
 	}
+
+	if repository.Layout.UsesLabels() {
+		// the labels may have changed since the resource was stored
+		previousPath, err := repository.findResourcePath(resource.GroupKind(), resource.NamespacedName(), format)
+		if err != nil {
+			glog.Warningf("Failed to find the previous path of %s: %v", resource, err)
+		} else if len(previousPath) > 0 && previousPath != path {
+			gitResource.previousPath = previousPath
+		}
+	}
+
 	return gitResource
 }
 
+// IsUnchanged returns true if the resource is already stored at its path,
+// with the given content hash (see store.ContentHash) - so that it does not need to be written again.
+func (gr *GitResource) IsUnchanged(hash string) bool {
+	if len(gr.previousPath) > 0 {
+		// it needs to be moved
+		return false
+	}
+	path, indexedHash, err := gr.repository.indexedFile(gr.resource.GroupKind(), gr.resource.NamespacedName(), gr.format)
+	if err != nil {
+		glog.Warningf("Failed to find %s in the index: %v", gr.resource, err)
+		return false
+	}
+	return path == gr.path && len(indexedHash) > 0 && indexedHash == hash
+}
+
 // Open opens the resource so that it could then be used as an io.Writer
 // It then needs to be closed at the end.
+// The existing sidecar files of the resource are removed.
 func (gr *GitResource) Open() error {
+	if len(gr.previousPath) > 0 {
+		if err := os.Remove(gr.previousPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err := os.RemoveAll(store.SidecarDir(gr.previousPath)); err != nil {
+			return err
+		}
+		gr.repository.unindexFile(gr.resource, gr.previousPath)
+	}
+
+	if err := os.RemoveAll(store.SidecarDir(gr.path)); err != nil {
+		return err
+	}
+
 	dir := filepath.Dir(gr.path)
 	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
 		return err
 	}
 
+	gr.content.Reset()
+
 	var err error
 	gr.file, err = os.OpenFile(gr.path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
 	return err
@@ -57,19 +113,58 @@ func (gr *GitResource) Open() error {
 // Write writes some data to the resource
 // implements the io.Writer interface
 func (gr *GitResource) Write(p []byte) (n int, err error) {
-	return gr.file.Write(p)
+	n, err = gr.file.Write(p)
+	gr.content.Write(p[:n])
+	return n, err
 }
 
-// Close closes the underlying file
+// Close closes the underlying file, and records it in the index of the repository
 // Needs to be called after writing
 // implements the io.Closer interface
 func (gr *GitResource) Close() error {
-	return gr.file.Close()
+	if err := gr.file.Close(); err != nil {
+		return err
+	}
+	gr.repository.indexFile(gr.resource, gr.path, store.ContentHash(gr.content.Bytes(), nil))
+	return nil
+}
+
+// WriteSidecarFiles writes the given sidecar files of the resource,
+// in the sidecar directory next to the resource's file
+func (gr *GitResource) WriteSidecarFiles(files []sidecar.File) error {
+	if len(files) == 0 {
+		return nil
+	}
+
+	dir := store.SidecarDir(gr.path)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, file.Name), file.Content, 0644); err != nil {
+			gr.repository.index.ForgetHashes(gr.path)
+			return err
+		}
+	}
+
+	gr.repository.indexFile(gr.resource, gr.path, store.ContentHash(gr.content.Bytes(), files))
+	return nil
 }
 
-// Delete deletes the resource from the filesystem
+// Delete deletes the resource (and its sidecar files) from the filesystem
 // does not complains if the file does not exists
 func (gr *GitResource) Delete() error {
+	if len(gr.previousPath) > 0 {
+		// the resource is still stored at its previous path
+		gr.path = gr.previousPath
+		gr.previousPath = ""
+	}
+
+	if err := os.RemoveAll(store.SidecarDir(gr.path)); err != nil {
+		return err
+	}
+	gr.repository.unindexFile(gr.resource, gr.path)
+
 	err := os.Remove(gr.path)
 	if os.IsNotExist(err) {
 		// already deleted
@@ -80,23 +175,94 @@ func (gr *GitResource) Delete() error {
 
 // Commit commits the resource to the git repository
 func (gr *GitResource) Commit() error {
-	needCommit, err := IsFileNewOrModified(gr.repository.Path, gr.path)
+	change, err := gr.Stage()
 	if err != nil {
 		return err
 	}
-	if !needCommit {
+	if len(change) == 0 {
 		return nil
 	}
 
-	if err := git.AddChanges(gr.repository.Path, false, gr.path); err != nil {
+	trailers := append(resourceTrailers(gr.resource), gr.repository.clusterTrailers()...)
+	commitMsg := fmt.Sprintf("%s %s\n\n%s\n", gr.resource.Status, gr.resource, strings.Join(trailers, "\n"))
+	if err := gr.repository.backend.Commit(commitMsg, backendAuthor(gr.resource.Author)); err != nil {
+		gr.repository.backend.Reset()
+		gr.repository.index.ForgetHashes(gr.path)
 		return err
 	}
 
-	commitMsg := fmt.Sprintf("%s %s", gr.resource.Status, gr.resource)
-	if err := git.CommitChanges(gr.repository.Path, commitMsg, nil); err != nil {
-		git.ResetHEAD(gr.repository.Path, false, "HEAD")
-		return err
+	return nil
+}
+
+// Stage adds the changes of the resource to the git index,
+// so that they can be committed later.
+// Returns the type of change (see Change),
+// or an empty string if there was nothing to stage (the resource has not been modified).
+// If the changes can't be staged, the content hash of the resource is forgotten:
+// it will be written (and staged) again the next time it is saved.
+func (gr *GitResource) Stage() (string, error) {
+	change, err := gr.stage()
+	if err != nil {
+		gr.repository.index.ForgetHashes(gr.path)
 	}
+	return change, err
+}
 
-	return nil
+// stage adds the changes of the resource to the git index (see Stage)
+func (gr *GitResource) stage() (string, error) {
+	change, err := gr.Change()
+	if err != nil {
+		return "", err
+	}
+	if len(change) == 0 {
+		return "", nil
+	}
+
+	paths := []string{gr.path}
+	if len(gr.previousPath) > 0 {
+		paths = append(paths, gr.previousPath)
+	}
+	for _, path := range paths {
+		if err := gr.repository.backend.Add(path); err != nil {
+			return "", err
+		}
+		if dir := store.SidecarDir(path); gr.repository.isFileChanged(dir) {
+			if err := gr.repository.backend.Add(dir); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	return change, nil
+}
+
+// Change returns the type of change of the resource (ChangeAdded, ChangeModified or ChangeDeleted),
+// compared to the last commit - including the changes of its sidecar files.
+// Returns an empty string if the resource has not been changed.
+func (gr *GitResource) Change() (string, error) {
+	change, err := gr.repository.backend.Change(gr.path)
+	if err != nil || len(change) > 0 {
+		return change, err
+	}
+
+	// the file itself may not have changed, but its sidecar files may have
+	if gr.repository.isFileChanged(store.SidecarDir(gr.path)) {
+		return ChangeModified, nil
+	}
+	return "", nil
+}
+
+// isFileChanged returns true if the given file (or directory)
+// has been changed in the repository, compared to the last commit
+func (r *Repository) isFileChanged(file string) bool {
+	change, err := r.backend.Change(file)
+	return err == nil && len(change) > 0
+}
+
+// backendAuthor returns the given author, for the backend (or nil if unknown)
+func backendAuthor(author *openshift.Author) *backend.Author {
+	if author == nil {
+		return nil
+	}
+	return &backend.Author{Name: author.Name, Email: author.Email}
 }
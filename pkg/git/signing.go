@@ -0,0 +1,258 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	git "github.com/gogits/git-module"
+	"github.com/golang/glog"
+	"github.com/mcuadros/go-version"
+)
+
+// Signing formats supported by SigningConfig
+const (
+	SigningFormatGPG = "gpg"
+	SigningFormatSSH = "ssh"
+)
+
+// SigningConfig is the configuration used to sign the commits
+type SigningConfig struct {
+	// KeyFile is the path of the signing key:
+	// an (armored) GPG private key, or an SSH private key.
+	// For the verification, it can also be the public key.
+	KeyFile string
+
+	// Format is the format of the key: SigningFormatGPG or SigningFormatSSH
+	Format string
+}
+
+// IsEmpty returns true if no signing key has been provided
+func (c SigningConfig) IsEmpty() bool {
+	return len(c.KeyFile) == 0
+}
+
+// Validate returns an error if the format is not supported
+func (c SigningConfig) Validate() error {
+	switch c.Format {
+	case SigningFormatGPG, SigningFormatSSH:
+		return nil
+	default:
+		return fmt.Errorf("Invalid signing format '%s': should be '%s' or '%s'", c.Format, SigningFormatGPG, SigningFormatSSH)
+	}
+}
+
+// gitFormats are the values of the git "gpg.format" setting for the signing formats
+var gitFormats = map[string]string{
+	SigningFormatGPG: "openpgp",
+	SigningFormatSSH: "ssh",
+}
+
+var (
+	// minSigningVersions are the minimal versions of git required to sign
+	// the commits and the tags (with "commit.gpgsign" and "tag.gpgsign") for the signing formats
+	minSigningVersions = map[string]string{
+		SigningFormatGPG: "2.23.0",
+		SigningFormatSSH: "2.34.0",
+	}
+
+	// minVerifyVersions are the minimal versions of git required to verify
+	// the signatures of the commits (with "verify-commit") for the signing formats
+	minVerifyVersions = map[string]string{
+		SigningFormatGPG: "2.1.0",
+		SigningFormatSSH: "2.34.0",
+	}
+)
+
+var (
+	// signingFormat is the git format of the key used to sign the commits (see ConfigureSigning)
+	signingFormat string
+
+	// signingKey is the key used to sign the commits (see ConfigureSigning):
+	// the fingerprint of a GPG key, or the path of an SSH key
+	signingKey string
+)
+
+// ConfigureSigning configures all the commits created by this process
+// (by CommitChanges, or when pulling) and the snapshot tags to be signed with the given key.
+// It does nothing if the configuration is empty.
+func ConfigureSigning(config SigningConfig) error {
+	if config.IsEmpty() {
+		return nil
+	}
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	if err := checkGitVersion(minSigningVersions[config.Format], fmt.Sprintf("Signing with a %s key", config.Format)); err != nil {
+		return err
+	}
+
+	switch config.Format {
+	case SigningFormatGPG:
+		fingerprint, err := importGPGKey(config.KeyFile)
+		if err != nil {
+			return err
+		}
+		signingKey = fingerprint
+	case SigningFormatSSH:
+		key, err := ioutil.ReadFile(config.KeyFile)
+		if err != nil {
+			return err
+		}
+		keyFile, err := writePrivateFile("signing-key", key)
+		if err != nil {
+			return err
+		}
+		signingKey = keyFile
+	}
+	signingFormat = gitFormats[config.Format]
+
+	glog.V(1).Infof("Signing the commits with the %s key %s", config.Format, config.KeyFile)
+	return nil
+}
+
+// newCommand returns a new git command with the given arguments,
+// configured to sign the commits and the annotated tags if ConfigureSigning has been called.
+func newCommand(args ...string) *git.Command {
+	if len(signingKey) == 0 {
+		return git.NewCommand(args...)
+	}
+	return git.NewCommand(append([]string{
+		"-c", "gpg.format=" + signingFormat,
+		"-c", "user.signingkey=" + signingKey,
+		"-c", "commit.gpgsign=true",
+		"-c", "tag.gpgsign=true",
+	}, args...)...)
+}
+
+// VerifyCommits checks that all the commits in the given revision range
+// (like "master" or "abc123..master") of the given repository are signed with the given key.
+// Returns the commits that are not signed (or not signed with the given key).
+func VerifyCommits(repoPath, revisionRange string, config SigningConfig) ([]string, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	if err := checkGitVersion(minVerifyVersions[config.Format], fmt.Sprintf("Verifying the signatures of a %s key", config.Format)); err != nil {
+		return nil, err
+	}
+
+	var verifyArgs []string
+	switch config.Format {
+	case SigningFormatGPG:
+		// the temporary keyring only contains the given key,
+		// so a good signature can only be made with it
+		if _, err := importGPGKey(config.KeyFile); err != nil {
+			return nil, err
+		}
+		verifyArgs = []string{"-c", "gpg.format=" + gitFormats[config.Format]}
+	case SigningFormatSSH:
+		publicKey, err := sshPublicKey(config.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		allowedSigners, err := writePrivateFile("allowed-signers", []byte("* "+publicKey+"\n"))
+		if err != nil {
+			return nil, err
+		}
+		verifyArgs = []string{"-c", "gpg.format=" + gitFormats[config.Format], "-c", "gpg.ssh.allowedSignersFile=" + allowedSigners}
+	}
+
+	output, err := git.NewCommand("rev-list", revisionRange).RunInDir(repoPath)
+	if err != nil {
+		return nil, err
+	}
+
+	unsigned := []string{}
+	for _, commit := range strings.Fields(output) {
+		args := append(append([]string{}, verifyArgs...), "verify-commit", commit)
+		if _, err := git.NewCommand(args...).RunInDir(repoPath); err != nil {
+			glog.V(2).Infof("Commit %s is not signed with %s: %v", commit, config.KeyFile, err)
+			unsigned = append(unsigned, commit)
+		}
+	}
+	return unsigned, nil
+}
+
+// checkGitVersion returns an error if the version of the git binary
+// is older than the given minimal version required for the given feature
+func checkGitVersion(minVersion, feature string) error {
+	gitVersion, err := git.BinVersion()
+	if err != nil {
+		return fmt.Errorf("Failed to read the version of git: %v", err)
+	}
+	if version.Compare(gitVersion, minVersion, "<") {
+		return fmt.Errorf("%s requires git %s or later, but git %s is installed", feature, minVersion, gitVersion)
+	}
+	return nil
+}
+
+// importGPGKey imports the given GPG key into a new temporary keyring,
+// used by this process (and the git commands it runs) through GNUPGHOME.
+// Returns the fingerprint of the key.
+func importGPGKey(keyFile string) (string, error) {
+	home, err := ioutil.TempDir("", "openshift-git-gnupg-")
+	if err != nil {
+		return "", err
+	}
+	if err := os.Setenv("GNUPGHOME", home); err != nil {
+		return "", err
+	}
+
+	if output, err := exec.Command("gpg", "--batch", "--import", keyFile).CombinedOutput(); err != nil {
+		return "", fmt.Errorf("Failed to import the GPG key %s: %v: %s", keyFile, err, string(output))
+	}
+
+	output, err := exec.Command("gpg", "--batch", "--with-colons", "--fingerprint").Output()
+	if err != nil {
+		return "", fmt.Errorf("Failed to read the fingerprint of the GPG key %s: %v", keyFile, err)
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Split(line, ":")
+		if len(fields) > 9 && fields[0] == "fpr" {
+			return fields[9], nil
+		}
+	}
+	return "", fmt.Errorf("No GPG key found in %s", keyFile)
+}
+
+// sshPublicKey returns the SSH public key of the given key file,
+// which can contain either a private or a public key
+func sshPublicKey(keyFile string) (string, error) {
+	key, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return "", err
+	}
+	if !bytes.Contains(key, []byte("PRIVATE KEY")) {
+		return strings.TrimSpace(string(key)), nil
+	}
+
+	// ssh-keygen refuses to read a private key readable by others
+	privateKeyFile, err := writePrivateFile("key", key)
+	if err != nil {
+		return "", err
+	}
+	output, err := exec.Command("ssh-keygen", "-y", "-f", privateKeyFile).Output()
+	if err != nil {
+		return "", fmt.Errorf("Failed to read the public key of %s: %v", keyFile, err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// writePrivateFile writes the given content to a new file with the given name,
+// that can only be read by the current user, in a new temporary directory.
+// Returns the path of the file.
+func writePrivateFile(name string, content []byte) (string, error) {
+	dir, err := ioutil.TempDir("", "openshift-git-")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, content, 0600); err != nil {
+		return "", err
+	}
+	return path, nil
+}
@@ -0,0 +1,79 @@
+package git
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vbehar/openshift-git/pkg/store"
+
+	git "github.com/gogits/git-module"
+	"github.com/golang/glog"
+)
+
+// SnapshotTagPrefix is the prefix of the names of the snapshot tags
+const SnapshotTagPrefix = "snapshot/"
+
+// SnapshotTagName returns the name of the snapshot tag created at the given time,
+// for the given period (see store.SnapshotName):
+// "snapshot/2016-06-01" for a daily period, or "snapshot/2016-06-01T10-00Z" for a shorter period.
+func SnapshotTagName(t time.Time, period time.Duration) string {
+	return SnapshotTagPrefix + store.SnapshotName(t, period)
+}
+
+// CreateSnapshot creates an annotated snapshot tag on the HEAD of the repository,
+// with the name returned by SnapshotTagName.
+// Returns the name of the tag, or an empty string if the tag already exists.
+func (r *Repository) CreateSnapshot(t time.Time, period time.Duration) (string, error) {
+	name := SnapshotTagName(t, period)
+	if r.IsTagExist(name) {
+		glog.V(2).Infof("Snapshot tag %s already exists", name)
+		return "", nil
+	}
+
+	message := fmt.Sprintf("Snapshot at %s\n", t.UTC().Format(time.RFC3339))
+	if trailers := r.clusterTrailers(); len(trailers) > 0 {
+		message = fmt.Sprintf("%s\n%s\n", message, strings.Join(trailers, "\n"))
+	}
+	if _, err := newCommand("tag", "-a", name, "-m", message).RunInDir(r.Path); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// PruneSnapshots deletes the snapshot tags created before the given time,
+// locally and from the remote (if a remote as been configured).
+// Returns the names of the deleted tags.
+func (r *Repository) PruneSnapshots(before time.Time) ([]string, error) {
+	output, err := git.NewCommand("for-each-ref", "--format=%(refname:short) %(taggerdate:raw)", "refs/tags/"+SnapshotTagPrefix).RunInDir(r.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	deleted := []string{}
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			// not an annotated tag
+			continue
+		}
+		timestamp, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil || !time.Unix(timestamp, 0).Before(before) {
+			continue
+		}
+
+		name := fields[0]
+		if _, err := git.NewCommand("tag", "-d", name).RunInDir(r.Path); err != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, name)
+
+		if len(r.RemoteURL) > 0 {
+			if _, err := git.NewCommand("push", "origin", ":refs/tags/"+name).RunInDir(r.Path); err != nil {
+				glog.Warningf("Failed to delete the tag %s from %s: %v", name, r.RemoteURL, err)
+			}
+		}
+	}
+	return deleted, nil
+}
@@ -0,0 +1,65 @@
+package git
+
+import (
+	"fmt"
+
+	"github.com/vbehar/openshift-git/pkg/openshift"
+)
+
+// Keys of the trailers added at the end of the commit messages
+const (
+	TrailerKind            = "Kind"
+	TrailerNamespace       = "Namespace"
+	TrailerName            = "Name"
+	TrailerUID             = "UID"
+	TrailerResourceVersion = "Resource-Version"
+	TrailerEvent           = "Event"
+	TrailerCluster         = "Cluster"
+)
+
+// trailerField is a single field of the metadata of a resource
+type trailerField struct {
+	key   string
+	value string
+}
+
+// resourceFields returns the fields with the metadata of the given resource
+func resourceFields(resource *openshift.Resource) []trailerField {
+	return []trailerField{
+		{key: TrailerKind, value: resource.Kind},
+		{key: TrailerNamespace, value: resource.Namespace},
+		{key: TrailerName, value: resource.Name},
+		{key: TrailerUID, value: string(resource.UID)},
+		{key: TrailerResourceVersion, value: resource.ResourceVersion},
+		{key: TrailerEvent, value: resource.Status},
+	}
+}
+
+// resourceTrailers returns the trailers ("Key: value" lines) with the metadata
+// of the given resource, so that the commits can be queried with
+// `git log --grep` or `git interpret-trailers`.
+// In the commits of a batch, these trailers are repeated for each changed resource,
+// always starting with the Kind trailer.
+// The trailers with an empty value are omitted.
+func resourceTrailers(resource *openshift.Resource) []string {
+	trailers := []string{}
+	for _, field := range resourceFields(resource) {
+		trailers = appendTrailer(trailers, field.key, field.value)
+	}
+	return trailers
+}
+
+// clusterTrailers returns the trailers with the name of the cluster
+// from which the resources of the repository are exported
+func (r *Repository) clusterTrailers() []string {
+	return appendTrailer([]string{}, TrailerCluster, r.ClusterName)
+}
+
+// appendTrailer appends a "Key: value" trailer to the given trailers,
+// if the given value is not empty
+func appendTrailer(trailers []string, key, value string) []string {
+	if len(value) == 0 {
+		return trailers
+	}
+	return append(trailers, fmt.Sprintf("%s: %s", key, value))
+}
@@ -0,0 +1,25 @@
+package git
+
+import (
+	"path/filepath"
+
+	"github.com/vbehar/openshift-git/pkg/store"
+)
+
+// LoadResourceVersions returns the last resource versions (per kind)
+// persisted with SaveResourceVersions for the given scope.
+// Returns an empty map if there are none, or if they were saved for another scope.
+func (r *Repository) LoadResourceVersions(scope string) (map[string]string, error) {
+	return store.LoadResourceVersions(r.resourceVersionsPath(), scope)
+}
+
+// SaveResourceVersions persists the given resource versions (per kind) for the given scope,
+// in the .git directory, so that they are not committed.
+func (r *Repository) SaveResourceVersions(scope string, versions map[string]string) error {
+	return store.SaveResourceVersions(r.resourceVersionsPath(), scope, versions)
+}
+
+// resourceVersionsPath returns the path of the file in which the resource versions are persisted
+func (r *Repository) resourceVersionsPath() string {
+	return filepath.Join(r.Path, ".git", "openshift-git", store.ResourceVersionsFile)
+}
@@ -0,0 +1,215 @@
+package gitobj
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Object types
+const (
+	TypeBlob   = "blob"
+	TypeTree   = "tree"
+	TypeCommit = "commit"
+)
+
+// Hash is the (SHA-1) hash of a git object
+type Hash [20]byte
+
+// ZeroHash is the hash of no object
+var ZeroHash Hash
+
+// ParseHash parses the given hex representation of a hash
+func ParseHash(s string) (Hash, error) {
+	var h Hash
+	b, err := hex.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return h, err
+	}
+	if len(b) != len(h) {
+		return h, fmt.Errorf("Invalid hash '%s'", s)
+	}
+	copy(h[:], b)
+	return h, nil
+}
+
+// String returns the hex representation of the hash
+func (h Hash) String() string {
+	return hex.EncodeToString(h[:])
+}
+
+// IsZero returns true if the hash is the ZeroHash
+func (h Hash) IsZero() bool {
+	return h == ZeroHash
+}
+
+// HashObject returns the hash of the object of the given type and content,
+// as computed by "git hash-object"
+func HashObject(objectType string, content []byte) Hash {
+	hash := sha1.New()
+	fmt.Fprintf(hash, "%s %d\x00", objectType, len(content))
+	hash.Write(content)
+
+	var h Hash
+	copy(h[:], hash.Sum(nil))
+	return h
+}
+
+// ObjectDB writes objects directly into the object database of a git repository,
+// as loose objects - without running the git binary.
+type ObjectDB struct {
+	// gitDir is the path of the .git directory of the repository
+	gitDir string
+}
+
+// NewObjectDB instantiates a new ObjectDB for the repository with the given .git directory
+func NewObjectDB(gitDir string) *ObjectDB {
+	return &ObjectDB{
+		gitDir: gitDir,
+	}
+}
+
+// Write writes an object of the given type and content,
+// unless it already exists as a loose object. Returns its hash.
+func (db *ObjectDB) Write(objectType string, content []byte) (Hash, error) {
+	h := HashObject(objectType, content)
+	name := h.String()
+	path := filepath.Join(db.gitDir, "objects", name[:2], name[2:])
+	if _, err := os.Stat(path); err == nil {
+		return h, nil
+	}
+
+	compressed := &bytes.Buffer{}
+	w := zlib.NewWriter(compressed)
+	fmt.Fprintf(w, "%s %d\x00", objectType, len(content))
+	w.Write(content)
+	if err := w.Close(); err != nil {
+		return h, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return h, err
+	}
+	// write to a temp file first, so that the object is never left half-written
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "tmp_obj_")
+	if err != nil {
+		return h, err
+	}
+	if _, err := tmp.Write(compressed.Bytes()); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return h, err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return h, err
+	}
+	if err := os.Chmod(tmp.Name(), 0444); err != nil {
+		os.Remove(tmp.Name())
+		return h, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return h, err
+	}
+	return h, nil
+}
+
+// Signature is the identity of the author or committer of a commit, with a date
+type Signature struct {
+	Name  string
+	Email string
+	When  time.Time
+}
+
+// String returns the representation of the signature in a commit object,
+// like "John Doe <john@example.com> 1464775200 +0200".
+// The name and email are cleaned (see CleanIdent), so that they can't inject other header lines.
+func (s Signature) String() string {
+	return fmt.Sprintf("%s <%s> %d %s", CleanIdent(s.Name), CleanIdent(s.Email), s.When.Unix(), s.When.Format("-0700"))
+}
+
+// CleanIdent cleans the given name or email of an author or committer, like git does:
+// the angle brackets and line breaks are removed, and the surrounding spaces are trimmed.
+func CleanIdent(value string) string {
+	value = strings.Map(func(r rune) rune {
+		switch r {
+		case '<', '>', '\n', '\r':
+			return -1
+		}
+		return r
+	}, value)
+	return strings.TrimSpace(value)
+}
+
+// Commit is a commit object
+type Commit struct {
+	Tree      Hash
+	Parents   []Hash
+	Author    Signature
+	Committer Signature
+	Message   string
+}
+
+// Bytes returns the content of the commit object.
+// The message is cleaned up like "git commit" does:
+// the trailing spaces and blank lines are removed.
+func (c *Commit) Bytes() []byte {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "tree %s\n", c.Tree)
+	for _, parent := range c.Parents {
+		fmt.Fprintf(buf, "parent %s\n", parent)
+	}
+	fmt.Fprintf(buf, "author %s\n", c.Author)
+	fmt.Fprintf(buf, "committer %s\n", c.Committer)
+	buf.WriteString("\n")
+
+	lines := strings.Split(c.Message, "\n")
+	for i := range lines {
+		lines[i] = strings.TrimRight(lines[i], " \t\r")
+	}
+	buf.WriteString(strings.Trim(strings.Join(lines, "\n"), "\n"))
+	buf.WriteString("\n")
+	return buf.Bytes()
+}
+
+// WriteCommit writes the given commit object, and returns its hash
+func (db *ObjectDB) WriteCommit(c *Commit) (Hash, error) {
+	return db.Write(TypeCommit, c.Bytes())
+}
+
+// UpdateRef points the given reference (like "refs/heads/master") to the given hash.
+// The reference is locked while it is updated, like git does.
+func (db *ObjectDB) UpdateRef(ref string, h Hash) error {
+	path := filepath.Join(db.gitDir, filepath.FromSlash(ref))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	lockPath := path + ".lock"
+	lock, err := os.OpenFile(lockPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return fmt.Errorf("Failed to lock the reference %s: %v", ref, err)
+	}
+	if _, err := lock.WriteString(h.String() + "\n"); err != nil {
+		lock.Close()
+		os.Remove(lockPath)
+		return err
+	}
+	if err := lock.Close(); err != nil {
+		os.Remove(lockPath)
+		return err
+	}
+	if err := os.Rename(lockPath, path); err != nil {
+		os.Remove(lockPath)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+package gitobj
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestRepository initializes a new git repository in a temp dir,
+// and returns its path
+func newTestRepository(t testing.TB) string {
+	dir, err := ioutil.TempDir("", "gitobj-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, dir, "init", "-q")
+	runGit(t, dir, "config", "user.name", "Test")
+	runGit(t, dir, "config", "user.email", "test@example.com")
+	return dir
+}
+
+// runGit runs the git binary in the given directory, and returns its output
+func runGit(t testing.TB, dir string, args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v failed: %v: %s", args, err, output)
+	}
+	return string(output)
+}
+
+func TestHashObject(t *testing.T) {
+	repo := newTestRepository(t)
+	defer os.RemoveAll(repo)
+
+	for _, content := range []string{"", "hello\n", "kind: ConfigMap\nmetadata:\n  name: foo\n"} {
+		file := filepath.Join(repo, "file")
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		expected := strings.TrimSpace(runGit(t, repo, "hash-object", "file"))
+		if h := HashObject(TypeBlob, []byte(content)); h.String() != expected {
+			t.Errorf("Expected hash %s for '%s', but got %s", expected, content, h)
+		}
+	}
+}
+
+func TestCommit(t *testing.T) {
+	repo := newTestRepository(t)
+	defer os.RemoveAll(repo)
+	db := NewObjectDB(filepath.Join(repo, ".git"))
+
+	files := map[string]string{
+		"README.md":                                      "# Export\n",
+		"Namespace/foo/Service/bar.yaml":                 "kind: Service\n",
+		"Namespace/foo/Service/bar-1.yaml":               "kind: Service\n",
+		"Namespace/foo/ConfigMap/a.yaml":                 "kind: ConfigMap\n",
+		"Namespace/foo/ConfigMap/a.files/app.properties": "key=value\n",
+		"Namespace/foo-bar/Service/baz.yaml":             "kind: Service\n",
+	}
+	tree := NewTree()
+	for path, content := range files {
+		h, err := db.Write(TypeBlob, []byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree.Set(path, Entry{Mode: ModeFile, Hash: h})
+	}
+
+	when := time.Date(2016, 6, 1, 10, 0, 0, 0, time.FixedZone("", 2*60*60))
+	commit := func(message string, parents ...Hash) Hash {
+		treeHash, err := tree.Write(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h, err := db.WriteCommit(&Commit{
+			Tree:      treeHash,
+			Parents:   parents,
+			Author:    Signature{Name: "John Doe", Email: "john@example.com", When: when},
+			Committer: Signature{Name: "Test", Email: "test@example.com", When: when},
+			Message:   message,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := db.UpdateRef("refs/heads/master", h); err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+
+	first := commit("Initial commit\n\n")
+	runGit(t, repo, "fsck", "--strict", "--no-dangling")
+
+	if log := runGit(t, repo, "log", "--format=%an <%ae> %ai|%s"); log != "John Doe <john@example.com> 2016-06-01 10:00:00 +0200|Initial commit\n" {
+		t.Errorf("Unexpected log: %s", log)
+	}
+	for path, content := range files {
+		if actual := runGit(t, repo, "cat-file", "-p", "HEAD:"+path); actual != content {
+			t.Errorf("Expected content '%s' for %s, but got '%s'", content, path, actual)
+		}
+	}
+
+	// the same tree as the one written by git, from the same files
+	runGit(t, repo, "reset", "-q", "--hard")
+	runGit(t, repo, "rm", "-r", "-q", "--cached", ".")
+	runGit(t, repo, "add", "--all")
+	if expected, actual := strings.TrimSpace(runGit(t, repo, "write-tree")), strings.TrimSpace(runGit(t, repo, "rev-parse", "HEAD^{tree}")); expected != actual {
+		t.Errorf("Expected tree %s, but got %s", expected, actual)
+	}
+
+	// update and delete some files
+	h, _ := db.Write(TypeBlob, []byte("kind: Service\nspec: {}\n"))
+	tree.Set("Namespace/foo/Service/bar.yaml", Entry{Mode: ModeFile, Hash: h})
+	tree.DeleteDir("Namespace/foo/ConfigMap/a.files")
+	tree.Delete("Namespace/foo-bar/Service/baz.yaml")
+	second := commit("Update", first)
+	runGit(t, repo, "fsck", "--strict", "--no-dangling")
+
+	expected := "M\tNamespace/foo/Service/bar.yaml\nD\tNamespace/foo-bar/Service/baz.yaml\nD\tNamespace/foo/ConfigMap/a.files/app.properties\n"
+	if actual := runGit(t, repo, "diff", "--name-status", first.String(), second.String()); !sameLines(actual, expected) {
+		t.Errorf("Expected changes:\n%s\nbut got:\n%s", expected, actual)
+	}
+	if files := tree.Files("Namespace/foo-bar"); len(files) != 0 {
+		t.Errorf("Expected no files in the deleted directory, but got %v", files)
+	}
+	if tree.Len() != len(files)-2 {
+		t.Errorf("Expected %d files, but got %d", len(files)-2, tree.Len())
+	}
+}
+
+func TestCommitWithMaliciousAuthor(t *testing.T) {
+	repo := newTestRepository(t)
+	defer os.RemoveAll(repo)
+	db := NewObjectDB(filepath.Join(repo, ".git"))
+
+	h, err := db.Write(TypeBlob, []byte("kind: Service\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := NewTree()
+	tree.Set("Service/foo.yaml", Entry{Mode: ModeFile, Hash: h})
+	treeHash, err := tree.Write(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// like a requester annotation set by someone who can edit the resource
+	when := time.Date(2016, 6, 1, 10, 0, 0, 0, time.UTC)
+	commit, err := db.WriteCommit(&Commit{
+		Tree:      treeHash,
+		Author:    Signature{Name: "Eve> 0 +0000\ncommitter Mallory <mallory@example.com", Email: "eve@example.com>\r\nauthor Admin <admin@example.com", When: when},
+		Committer: Signature{Name: "Test", Email: "test@example.com", When: when},
+		Message:   "Update",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.UpdateRef("refs/heads/master", commit); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, repo, "fsck", "--strict", "--no-dangling")
+
+	content := runGit(t, repo, "cat-file", "commit", "HEAD")
+	header := content[:strings.Index(content, "\n\n")]
+	if lines := strings.Split(header, "\n"); len(lines) != 3 {
+		t.Errorf("Expected 3 header lines (tree, author, committer), but got:\n%s", header)
+	}
+	if log := runGit(t, repo, "log", "--format=%an|%ae|%cn"); log != "Eve 0 +0000committer Mallory mallory@example.com|eve@example.comauthor Admin admin@example.com|Test\n" {
+		t.Errorf("Unexpected log: %s", log)
+	}
+}
+
+func TestParseLsTree(t *testing.T) {
+	repo := newTestRepository(t)
+	defer os.RemoveAll(repo)
+
+	for path, content := range map[string]string{"a/b.yaml": "b\n", "a/c/d.yaml": "d\n", "e.yaml": "e\n"} {
+		file := filepath.Join(repo, filepath.FromSlash(path))
+		os.MkdirAll(filepath.Dir(file), 0755)
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runGit(t, repo, "add", "--all")
+	runGit(t, repo, "commit", "-q", "-m", "test")
+
+	tree, err := ParseLsTree(runGit(t, repo, "ls-tree", "-r", "-z", "HEAD"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files := fmt.Sprint(tree.Files("")); files != "[a/b.yaml a/c/d.yaml e.yaml]" {
+		t.Errorf("Unexpected files %s", files)
+	}
+
+	h, err := tree.Write(NewObjectDB(filepath.Join(repo, ".git")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := strings.TrimSpace(runGit(t, repo, "rev-parse", "HEAD^{tree}")); h.String() != expected {
+		t.Errorf("Expected tree %s, but got %s", expected, h)
+	}
+}
+
+// sameLines returns true if the given strings have the same lines, in any order
+func sameLines(a, b string) bool {
+	linesA, linesB := strings.Split(strings.TrimSpace(a), "\n"), strings.Split(strings.TrimSpace(b), "\n")
+	if len(linesA) != len(linesB) {
+		return false
+	}
+	count := map[string]int{}
+	for _, line := range linesA {
+		count[line]++
+	}
+	for _, line := range linesB {
+		count[line]--
+	}
+	for _, c := range count {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,246 @@
+package gitobj
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// File modes of the entries of a tree
+const (
+	ModeFile = "100644"
+	ModeDir  = "40000"
+)
+
+// Entry is a file in a tree
+type Entry struct {
+	Mode string
+	Hash Hash
+}
+
+// Tree is an in-memory representation of the (recursive) tree of a commit:
+// the files, per path (relative to the root of the repository, with "/" separators).
+// The hashes of the (sub-)trees are cached, so that only the trees
+// containing changed files are written again.
+type Tree struct {
+	// files are the files of the tree, per path
+	files map[string]Entry
+
+	// children are the names of the files and sub-directories, per directory
+	// (the root directory is "")
+	children map[string]map[string]bool
+
+	// hashes are the hashes of the (already written) trees, per directory
+	hashes map[string]Hash
+}
+
+// NewTree instantiates a new empty tree
+func NewTree() *Tree {
+	return &Tree{
+		files:    map[string]Entry{},
+		children: map[string]map[string]bool{"": {}},
+		hashes:   map[string]Hash{},
+	}
+}
+
+// ParseLsTree parses the output of "git ls-tree -r -z <commit>"
+// - the hashes of the trees are not known, so they will all be written.
+func ParseLsTree(output string) (*Tree, error) {
+	t := NewTree()
+	for _, line := range strings.Split(output, "\x00") {
+		if len(line) == 0 {
+			continue
+		}
+		// <mode> SP <type> SP <hash> TAB <path>
+		tab := strings.Index(line, "\t")
+		if tab < 0 {
+			return nil, fmt.Errorf("Invalid ls-tree line '%s'", line)
+		}
+		fields := strings.Fields(line[:tab])
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("Invalid ls-tree line '%s'", line)
+		}
+		h, err := ParseHash(fields[2])
+		if err != nil {
+			return nil, err
+		}
+		t.Set(line[tab+1:], Entry{Mode: fields[0], Hash: h})
+	}
+	return t, nil
+}
+
+// Copy returns a copy of the tree
+func (t *Tree) Copy() *Tree {
+	c := &Tree{
+		files:    make(map[string]Entry, len(t.files)),
+		children: make(map[string]map[string]bool, len(t.children)),
+		hashes:   make(map[string]Hash, len(t.hashes)),
+	}
+	for p, entry := range t.files {
+		c.files[p] = entry
+	}
+	for dir, names := range t.children {
+		c.children[dir] = make(map[string]bool, len(names))
+		for name := range names {
+			c.children[dir][name] = true
+		}
+	}
+	for dir, h := range t.hashes {
+		c.hashes[dir] = h
+	}
+	return c
+}
+
+// Len returns the number of files in the tree
+func (t *Tree) Len() int {
+	return len(t.files)
+}
+
+// Get returns the file at the given path - and a boolean if it exists
+func (t *Tree) Get(p string) (Entry, bool) {
+	entry, ok := t.files[p]
+	return entry, ok
+}
+
+// Set sets the file at the given path
+func (t *Tree) Set(p string, entry Entry) {
+	t.files[p] = entry
+	for {
+		dir, name := splitPath(p)
+		delete(t.hashes, dir)
+		if _, ok := t.children[dir]; !ok {
+			t.children[dir] = map[string]bool{}
+		}
+		t.children[dir][name] = true
+		if len(dir) == 0 {
+			return
+		}
+		p = dir
+	}
+}
+
+// Delete deletes the file at the given path (if it exists)
+func (t *Tree) Delete(p string) {
+	if _, ok := t.files[p]; !ok {
+		return
+	}
+	delete(t.files, p)
+	t.removeChild(p)
+}
+
+// DeleteDir deletes all the files in the given directory (if any)
+func (t *Tree) DeleteDir(dir string) {
+	for _, p := range t.Files(dir) {
+		t.Delete(p)
+	}
+}
+
+// Files returns the paths of all the files in the given directory (recursively)
+func (t *Tree) Files(dir string) []string {
+	files := []string{}
+	for name := range t.children[dir] {
+		p := joinPath(dir, name)
+		if _, ok := t.files[p]; ok {
+			files = append(files, p)
+		} else {
+			files = append(files, t.Files(p)...)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// Write writes the (sub-)trees that changed since the last write,
+// and returns the hash of the root tree
+func (t *Tree) Write(db *ObjectDB) (Hash, error) {
+	return t.writeDir(db, "")
+}
+
+// writeDir writes the tree of the given directory (if it changed), and returns its hash
+func (t *Tree) writeDir(db *ObjectDB, dir string) (Hash, error) {
+	if h, ok := t.hashes[dir]; ok {
+		return h, nil
+	}
+
+	entries := treeEntries{}
+	for name := range t.children[dir] {
+		p := joinPath(dir, name)
+		if entry, ok := t.files[p]; ok {
+			entries = append(entries, treeEntry{name: name, sortKey: name, mode: entry.Mode, hash: entry.Hash})
+			continue
+		}
+		h, err := t.writeDir(db, p)
+		if err != nil {
+			return h, err
+		}
+		// git sorts the directories as if their names ended with a "/"
+		entries = append(entries, treeEntry{name: name, sortKey: name + "/", mode: ModeDir, hash: h})
+	}
+	sort.Sort(entries)
+
+	content := &bytes.Buffer{}
+	for _, entry := range entries {
+		fmt.Fprintf(content, "%s %s\x00", entry.mode, entry.name)
+		content.Write(entry.hash[:])
+	}
+	h, err := db.Write(TypeTree, content.Bytes())
+	if err != nil {
+		return h, err
+	}
+	t.hashes[dir] = h
+	return h, nil
+}
+
+// treeEntry is an entry of a tree object
+type treeEntry struct {
+	name    string
+	sortKey string
+	mode    string
+	hash    Hash
+}
+
+// treeEntries sorts the entries of a tree object, in the git order
+type treeEntries []treeEntry
+
+func (e treeEntries) Len() int           { return len(e) }
+func (e treeEntries) Swap(i, j int)      { e[i], e[j] = e[j], e[i] }
+func (e treeEntries) Less(i, j int) bool { return e[i].sortKey < e[j].sortKey }
+
+// removeChild removes the given path from its parent directory,
+// and the parent directories that become empty
+func (t *Tree) removeChild(p string) {
+	for {
+		dir, name := splitPath(p)
+		delete(t.hashes, dir)
+		delete(t.children[dir], name)
+		if len(dir) == 0 {
+			return
+		}
+		if len(t.children[dir]) > 0 {
+			// still not empty, but its hash and the hashes of its parents changed
+			for len(dir) > 0 {
+				dir, _ = splitPath(dir)
+				delete(t.hashes, dir)
+			}
+			return
+		}
+		delete(t.children, dir)
+		p = dir
+	}
+}
+
+// splitPath splits the given path into its directory and its name
+func splitPath(p string) (string, string) {
+	dir, name := path.Split(p)
+	return strings.TrimSuffix(dir, "/"), name
+}
+
+// joinPath joins the given directory and name
+func joinPath(dir, name string) string {
+	if len(dir) == 0 {
+		return name
+	}
+	return dir + "/" + name
+}
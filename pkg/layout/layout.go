@@ -0,0 +1,300 @@
+package layout
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// DefaultTemplate is the default layout of the repository:
+	// the namespaced resources are stored in "Namespace/<namespace>/<Kind>/<name>",
+	// and the root-scoped resources in "<Kind>/<name>"
+	DefaultTemplate = "[Namespace/{namespace}/]{kind}/{name}"
+
+	// GroupTemplate is the default layout of the repository,
+	// with the kinds qualified by their API group (if any), like "Deployment.extensions"
+	GroupTemplate = "[Namespace/{namespace}/]{kind}[.{group}]/{name}"
+
+	// emptyValue is used in paths for the empty values of the mandatory variables.
+	// It can't be a valid namespace, name or label value.
+	emptyValue = "_"
+)
+
+// Fields represents the fields of a resource that can be used in a layout
+type Fields struct {
+	Cluster   string
+	Namespace string
+	Kind      string
+	Group     string
+	Name      string
+	Labels    map[string]string
+}
+
+// Layout represents the layout of the resources in a repository,
+// defined by a template such as "clusters/{cluster}/{namespace}/{kind}/{name}".
+// The supported variables are {cluster}, {namespace}, {kind}, {group}, {name} and {label:KEY}
+// - {namespace}, {kind} and {name} are mandatory.
+// The parts between brackets are optional: they are omitted if any of their variables is empty.
+// The same layout is used to build the path of a resource, and to parse it back.
+type Layout struct {
+	// Template is the template of the layout
+	Template string
+
+	// parts are the parsed parts of the template
+	parts []part
+
+	// regexp is the regular expression used to parse a path
+	regexp *regexp.Regexp
+
+	// variables are the names of the variables, in the order of the regexp groups
+	variables []string
+}
+
+// part is either a literal string, a variable, or an optional list of parts
+type part struct {
+	literal  string
+	variable string
+	optional []part
+}
+
+// variablePattern matches a variable in a template
+var variablePattern = regexp.MustCompile(`^\{(cluster|namespace|kind|group|name|label:[^}]+)\}`)
+
+// mandatoryVariables are the variables that every layout must use,
+// so that the paths of different resources don't collide.
+// The {namespace} may be in an optional part, for the root-scoped kinds.
+var mandatoryVariables = []string{"namespace", "kind", "name"}
+
+// New parses the given template and returns a new Layout
+func New(template string) (*Layout, error) {
+	parts, rest, err := parseParts(template, false)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid layout '%s': %v", template, err)
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("Invalid layout '%s': unexpected ']'", template)
+	}
+
+	l := &Layout{
+		Template: template,
+		parts:    parts,
+	}
+	for _, variable := range mandatoryVariables {
+		if !l.HasVariable(variable) {
+			return nil, fmt.Errorf("Invalid layout '%s': missing {%s}", template, variable)
+		}
+	}
+
+	pattern := "^" + l.pattern(parts) + "$"
+	if l.regexp, err = regexp.Compile(pattern); err != nil {
+		return nil, fmt.Errorf("Invalid layout '%s': %v", template, err)
+	}
+	return l, nil
+}
+
+// ForTemplate returns the layout for the given template,
+// or the default layout if the template is empty - with the kinds qualified
+// by their API group (like "Deployment.extensions") if groupLayout is true,
+// so that kinds with the same name in different API groups don't collide.
+func ForTemplate(template string, groupLayout bool) (*Layout, error) {
+	if len(template) == 0 {
+		template = DefaultTemplate
+		if groupLayout {
+			template = GroupTemplate
+		}
+	}
+	return New(template)
+}
+
+// Path returns the path (relative to the repository, and without extension)
+// of the resource with the given fields
+func (l *Layout) Path(fields Fields) string {
+	path, _ := format(l.parts, fields, false)
+	return path
+}
+
+// Parse parses the given path (relative to the repository, and without extension),
+// and returns the fields of the resource - or false if the path does not match the layout
+func (l *Layout) Parse(path string) (Fields, bool) {
+	matches := l.regexp.FindStringSubmatch(path)
+	if matches == nil {
+		return Fields{}, false
+	}
+
+	fields := Fields{}
+	for i, variable := range l.variables {
+		value := matches[i+1]
+		if value == emptyValue {
+			value = ""
+		}
+		switch {
+		case variable == "cluster":
+			fields.Cluster = value
+		case variable == "namespace":
+			fields.Namespace = value
+		case variable == "kind":
+			fields.Kind = value
+		case variable == "group":
+			fields.Group = value
+		case variable == "name":
+			fields.Name = value
+		case strings.HasPrefix(variable, "label:"):
+			if fields.Labels == nil {
+				fields.Labels = map[string]string{}
+			}
+			fields.Labels[strings.TrimPrefix(variable, "label:")] = value
+		}
+	}
+
+	if len(fields.Name) == 0 {
+		return Fields{}, false
+	}
+	return fields, true
+}
+
+// UsesLabels returns true if the layout uses at least one label,
+// in which case the path of a resource can't be computed from its key only
+func (l *Layout) UsesLabels() bool {
+	for _, variable := range l.variables {
+		if strings.HasPrefix(variable, "label:") {
+			return true
+		}
+	}
+	return false
+}
+
+// HasVariable returns true if the layout uses the given variable (like "cluster")
+func (l *Layout) HasVariable(variable string) bool {
+	var has func(parts []part) bool
+	has = func(parts []part) bool {
+		for _, p := range parts {
+			if p.variable == variable || has(p.optional) {
+				return true
+			}
+		}
+		return false
+	}
+	return has(l.parts)
+}
+
+// pattern returns the regexp pattern for the given parts,
+// and records the variables in the order of the regexp groups
+func (l *Layout) pattern(parts []part) string {
+	pattern := ""
+	for _, p := range parts {
+		switch {
+		case len(p.variable) > 0:
+			l.variables = append(l.variables, p.variable)
+			pattern += `([^/]+?)`
+		case p.optional != nil:
+			pattern += "(?:" + l.pattern(p.optional) + ")?"
+		default:
+			pattern += regexp.QuoteMeta(p.literal)
+		}
+	}
+	return pattern
+}
+
+// parseParts parses the given template, until the end of the template
+// or the end of the current optional part.
+// Returns the parts and the rest of the template.
+func parseParts(template string, optional bool) ([]part, string, error) {
+	parts := []part{}
+	rest := template
+	for len(rest) > 0 {
+		switch rest[0] {
+		case '[':
+			optionalParts, r, err := parseParts(rest[1:], true)
+			if err != nil {
+				return nil, "", err
+			}
+			if len(r) == 0 || r[0] != ']' {
+				return nil, "", fmt.Errorf("missing ']'")
+			}
+			parts = append(parts, part{optional: optionalParts})
+			rest = r[1:]
+
+		case ']':
+			if !optional {
+				return nil, "", fmt.Errorf("unexpected ']'")
+			}
+			return parts, rest, nil
+
+		case '{':
+			match := variablePattern.FindStringSubmatch(rest)
+			if match == nil {
+				return nil, "", fmt.Errorf("invalid variable at '%s'", rest)
+			}
+			parts = append(parts, part{variable: match[1]})
+			rest = rest[len(match[0]):]
+
+		default:
+			end := strings.IndexAny(rest, "[]{")
+			if end < 0 {
+				end = len(rest)
+			}
+			parts = append(parts, part{literal: rest[:end]})
+			rest = rest[end:]
+		}
+	}
+	return parts, rest, nil
+}
+
+// format formats the given parts with the given fields.
+// Returns false if the parts are optional and one of the variables is empty.
+func format(parts []part, fields Fields, optional bool) (string, bool) {
+	result := ""
+	for _, p := range parts {
+		switch {
+		case len(p.variable) > 0:
+			value := valueOf(p.variable, fields)
+			if len(value) == 0 {
+				if optional {
+					return "", false
+				}
+				value = emptyValue
+			}
+			result += value
+		case p.optional != nil:
+			if value, ok := format(p.optional, fields, true); ok {
+				result += value
+			}
+		default:
+			result += p.literal
+		}
+	}
+	return result, true
+}
+
+// valueOf returns the value of the given variable in the given fields
+func valueOf(variable string, fields Fields) string {
+	switch {
+	case variable == "cluster":
+		return Sanitize(fields.Cluster)
+	case variable == "namespace":
+		return fields.Namespace
+	case variable == "kind":
+		return fields.Kind
+	case variable == "group":
+		return fields.Group
+	case variable == "name":
+		return fields.Name
+	case strings.HasPrefix(variable, "label:"):
+		return fields.Labels[strings.TrimPrefix(variable, "label:")]
+	}
+	return ""
+}
+
+// Sanitize replaces the characters that can't be used safely in a path element
+// (like the '/' and ':' of a cluster URL) by a '_'.
+// It is applied to the name of the cluster.
+func Sanitize(value string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, value)
+}
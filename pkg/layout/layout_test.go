@@ -0,0 +1,129 @@
+package layout
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPathAndParse(t *testing.T) {
+	tests := []struct {
+		template     string
+		fields       Fields
+		expectedPath string
+	}{
+		{
+			template:     DefaultTemplate,
+			fields:       Fields{Namespace: "my-ns", Kind: "DeploymentConfig", Name: "my-app"},
+			expectedPath: "Namespace/my-ns/DeploymentConfig/my-app",
+		},
+		{
+			template:     DefaultTemplate,
+			fields:       Fields{Kind: "Namespace", Name: "my-ns"},
+			expectedPath: "Namespace/my-ns",
+		},
+		{
+			template:     GroupTemplate,
+			fields:       Fields{Namespace: "my-ns", Kind: "Deployment", Group: "extensions", Name: "my-app"},
+			expectedPath: "Namespace/my-ns/Deployment.extensions/my-app",
+		},
+		{
+			template:     GroupTemplate,
+			fields:       Fields{Kind: "User", Name: "system:admin"},
+			expectedPath: "User/system:admin",
+		},
+		{
+			template:     "clusters/{cluster}/{namespace}/{kind}/{name}",
+			fields:       Fields{Cluster: "prod", Namespace: "my-ns", Kind: "Service", Name: "my-svc"},
+			expectedPath: "clusters/prod/my-ns/Service/my-svc",
+		},
+		{
+			template:     "{namespace}/{kind}/{name}",
+			fields:       Fields{Kind: "Namespace", Name: "my-ns"},
+			expectedPath: "_/Namespace/my-ns",
+		},
+		{
+			template:     "[{namespace}/]apps/{label:app}/{kind}/{name}",
+			fields:       Fields{Namespace: "my-ns", Kind: "Service", Name: "my-svc", Labels: map[string]string{"app": "frontend"}},
+			expectedPath: "my-ns/apps/frontend/Service/my-svc",
+		},
+		{
+			template:     "[{namespace}/]apps/{label:app}/{kind}/{name}",
+			fields:       Fields{Namespace: "my-ns", Kind: "Secret", Name: "my-secret"},
+			expectedPath: "my-ns/apps/_/Secret/my-secret",
+		},
+	}
+
+	for count, test := range tests {
+		layout, err := New(test.template)
+		if err != nil {
+			t.Errorf("Test[%d] Failed: %v", count, err)
+			continue
+		}
+
+		path := layout.Path(test.fields)
+		if path != test.expectedPath {
+			t.Errorf("Test[%d] Failed: Expected path '%s' but got '%s'", count, test.expectedPath, path)
+			continue
+		}
+
+		fields, ok := layout.Parse(path)
+		if !ok {
+			t.Errorf("Test[%d] Failed: Could not parse '%s'", count, path)
+			continue
+		}
+		if layout.UsesLabels() && test.fields.Labels == nil {
+			test.fields.Labels = map[string]string{"app": ""}
+		}
+		if !reflect.DeepEqual(fields, test.fields) {
+			t.Errorf("Test[%d] Failed: Expected fields %+v but got %+v", count, test.fields, fields)
+		}
+	}
+}
+
+func TestParseInvalidPath(t *testing.T) {
+	layout, err := New(DefaultTemplate)
+	if err != nil {
+		t.Fatalf("Failed: %v", err)
+	}
+
+	for _, path := range []string{"README", "Namespace/my-ns/Service/my-svc/extra"} {
+		if fields, ok := layout.Parse(path); ok {
+			t.Errorf("Expected '%s' not to be parsed, but got %+v", path, fields)
+		}
+	}
+}
+
+func TestNewInvalidTemplate(t *testing.T) {
+	for _, template := range []string{"{kind}", "{namespace}/{name}", "{kind}/{name}", "[{namespace}/{kind}/{name}", "{namespace}]/{kind}/{name}", "{unknown}/{namespace}/{kind}/{name}"} {
+		if _, err := New(template); err == nil {
+			t.Errorf("Expected an error for template '%s'", template)
+		}
+	}
+}
+
+func TestForTemplate(t *testing.T) {
+	tests := []struct {
+		template    string
+		groupLayout bool
+		expected    string
+	}{
+		{"", false, DefaultTemplate},
+		{"", true, GroupTemplate},
+		{"{namespace}/{kind}/{name}", true, "{namespace}/{kind}/{name}"},
+	}
+	for _, test := range tests {
+		layout, err := ForTemplate(test.template, test.groupLayout)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if layout.Template != test.expected {
+			t.Errorf("Expected template '%s' for '%s' (group layout %v), but got '%s'", test.expected, test.template, test.groupLayout, layout.Template)
+		}
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	if result := Sanitize("https://master.example.com:8443"); result != "https___master.example.com_8443" {
+		t.Errorf("Expected 'https___master.example.com_8443' but got '%s'", result)
+	}
+}
@@ -0,0 +1,113 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// namespace is the namespace of all the metrics
+	namespace = "openshift_git"
+)
+
+var (
+	// ResourcesSaved counts the resources saved to the repository, per kind
+	ResourcesSaved = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "resources_saved_total",
+		Help:      "Number of resources saved to the repository.",
+	}, []string{"kind"})
+
+	// ResourcesDeleted counts the resources deleted from the repository, per kind
+	ResourcesDeleted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "resources_deleted_total",
+		Help:      "Number of resources deleted from the repository.",
+	}, []string{"kind"})
+
+	// ResourcesUnchanged counts the resources that were not written to the repository,
+	// because they were already stored with the same content, per kind
+	ResourcesUnchanged = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "resources_unchanged_total",
+		Help:      "Number of resources not written to the repository because they were unchanged.",
+	}, []string{"kind"})
+
+	// CommitFailures counts the failed commits
+	CommitFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "commit_failures_total",
+		Help:      "Number of failed commits.",
+	})
+
+	// PushFailures counts the failed pushes to the remote repository
+	PushFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "push_failures_total",
+		Help:      "Number of failed pushes to the remote repository.",
+	})
+
+	// PullFailures counts the failed pulls from the remote repository
+	PullFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "pull_failures_total",
+		Help:      "Number of failed pulls from the remote repository.",
+	})
+
+	// PushDuration observes the duration of the pushes to the remote repository
+	PushDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "push_duration_seconds",
+		Help:      "Duration of the pushes to the remote repository.",
+	})
+
+	// PullDuration observes the duration of the pulls from the remote repository
+	PullDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "pull_duration_seconds",
+		Help:      "Duration of the pulls from the remote repository.",
+	})
+
+	// CommitLag observes the time between the reception of a change from the cluster,
+	// and its commit to the repository
+	CommitLag = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "event_to_commit_lag_seconds",
+		Help:      "Time between the reception of a change from the cluster and its commit to the repository.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 16),
+	})
+)
+
+func init() {
+	prometheus.MustRegister(ResourcesSaved)
+	prometheus.MustRegister(ResourcesDeleted)
+	prometheus.MustRegister(ResourcesUnchanged)
+	prometheus.MustRegister(CommitFailures)
+	prometheus.MustRegister(PushFailures)
+	prometheus.MustRegister(PullFailures)
+	prometheus.MustRegister(PushDuration)
+	prometheus.MustRegister(PullDuration)
+	prometheus.MustRegister(CommitLag)
+}
+
+// RegisterBacklog registers a gauge reporting the number of resources
+// waiting to be saved, as returned by the given function
+func RegisterBacklog(backlog func() int) {
+	prometheus.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "resources_backlog",
+		Help:      "Number of resources received from the cluster and waiting to be saved.",
+	}, func() float64 {
+		return float64(backlog())
+	}))
+}
+
+// ObserveCommitLag records the lag of a change received at the given time,
+// that has just been committed. Zero times are ignored.
+func ObserveCommitLag(receivedAt time.Time) {
+	if receivedAt.IsZero() {
+		return
+	}
+	CommitLag.Observe(time.Since(receivedAt).Seconds())
+}
@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/golang/glog"
+)
+
+// Check is a readiness check, that returns an error if the application is not ready
+type Check func() error
+
+// NewServeMux returns a new ServeMux, that serves:
+// - /healthz, which always returns a 200 (the application is alive if it can answer)
+// - /readyz, which returns a 200 if all the given checks pass, or a 503 otherwise
+// - /metrics, which exposes the Prometheus metrics
+func NewServeMux(checks ...Check) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		for _, check := range checks {
+			if err := check(); err != nil {
+				glog.V(2).Infof("Not ready: %v", err)
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+				return
+			}
+		}
+		fmt.Fprintln(w, "ok")
+	})
+	mux.Handle("/metrics", prometheus.Handler())
+	return mux
+}
+
+// ListenAndServe starts (in a new goroutine) an HTTP server listening on the given address,
+// serving the health, readiness (with the given checks) and metrics endpoints.
+func ListenAndServe(address string, checks ...Check) {
+	mux := NewServeMux(checks...)
+	go func() {
+		glog.Infof("Listening on %s", address)
+		if err := http.ListenAndServe(address, mux); err != nil {
+			glog.Errorf("Failed to listen on %s: %v", address, err)
+		}
+	}()
+}
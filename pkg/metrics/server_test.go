@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServeMux(t *testing.T) {
+	ready := false
+	mux := NewServeMux(func() error {
+		if !ready {
+			return fmt.Errorf("not synced yet")
+		}
+		return nil
+	})
+
+	ResourcesSaved.WithLabelValues("ConfigMap").Inc()
+
+	tests := []struct {
+		path             string
+		ready            bool
+		expectedCode     int
+		expectedContains string
+	}{
+		{
+			path:             "/healthz",
+			expectedCode:     http.StatusOK,
+			expectedContains: "ok",
+		},
+		{
+			path:             "/readyz",
+			ready:            false,
+			expectedCode:     http.StatusServiceUnavailable,
+			expectedContains: "not synced yet",
+		},
+		{
+			path:             "/readyz",
+			ready:            true,
+			expectedCode:     http.StatusOK,
+			expectedContains: "ok",
+		},
+		{
+			path:             "/metrics",
+			expectedCode:     http.StatusOK,
+			expectedContains: `openshift_git_resources_saved_total{kind="ConfigMap"} 1`,
+		},
+	}
+
+	for count, test := range tests {
+		ready = test.ready
+		recorder := httptest.NewRecorder()
+		request, _ := http.NewRequest("GET", test.path, nil)
+		mux.ServeHTTP(recorder, request)
+
+		if recorder.Code != test.expectedCode {
+			t.Errorf("Test[%d] Failed: Expected code %d but got %d", count, test.expectedCode, recorder.Code)
+		}
+		if !strings.Contains(recorder.Body.String(), test.expectedContains) {
+			t.Errorf("Test[%d] Failed: Expected body to contain '%s' but got '%s'", count, test.expectedContains, recorder.Body.String())
+		}
+	}
+}
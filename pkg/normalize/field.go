@@ -0,0 +1,30 @@
+package normalize
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Field represents a field of the resources of the given kind
+type Field struct {
+	// Kind is the kind of the resources ("*" for all kinds)
+	Kind string
+
+	// Path is the path of the field (see Rule for the syntax)
+	Path string
+}
+
+// ParseField parses a field in the "Kind:path" format,
+// like "ConfigMap:data[password]"
+func ParseField(field string) (Field, error) {
+	parts := strings.SplitN(field, ":", 2)
+	if len(parts) != 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+		return Field{}, fmt.Errorf("Invalid field '%s': should be in the 'Kind:path' format", field)
+	}
+	return Field{Kind: parts[0], Path: parts[1]}, nil
+}
+
+// AppliesTo returns true if the field applies to the resources of the given kind
+func (f Field) AppliesTo(kind string) bool {
+	return f.Kind == "*" || f.Kind == kind
+}
@@ -0,0 +1,37 @@
+package normalize
+
+import "testing"
+
+func TestParseField(t *testing.T) {
+	tests := []struct {
+		field          string
+		expectedResult Field
+		expectedError  bool
+	}{
+		{
+			field:          "ConfigMap:data[password]",
+			expectedResult: Field{Kind: "ConfigMap", Path: "data[password]"},
+		},
+		{
+			field:         "data[password]",
+			expectedError: true,
+		},
+		{
+			field:         "ConfigMap:",
+			expectedError: true,
+		},
+	}
+
+	for count, test := range tests {
+		result, err := ParseField(test.field)
+		if test.expectedError {
+			if err == nil {
+				t.Errorf("Test[%d] Failed: Expected an error but got %v", count, result)
+			}
+			continue
+		}
+		if err != nil || result != test.expectedResult {
+			t.Errorf("Test[%d] Failed: Expected %v but got %v (%v)", count, test.expectedResult, result, err)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package normalize
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// segment is a single segment of a field path
+type segment struct {
+	// key is the key of the field in a map
+	key string
+
+	// index is the index of the element in a list (or -1 for a map key)
+	index int
+
+	// wildcard is true if the segment matches all the elements of a list or map
+	wildcard bool
+}
+
+// parsePath parses a field path, such as
+// "spec.triggers[*].imageChangeParams.lastTriggeredImage" or
+// "metadata.annotations[kubectl.kubernetes.io/last-applied-configuration]".
+// Keys containing dots can be written between brackets, and "[*]" matches all the elements.
+func parsePath(path string) ([]segment, error) {
+	segments := []segment{}
+	rest := path
+	for len(rest) > 0 {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			if len(rest) == 0 || rest[0] == '.' || rest[0] == '[' {
+				return nil, fmt.Errorf("invalid path %s: empty field name", path)
+			}
+
+		case '[':
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("invalid path %s: missing ']'", path)
+			}
+			value := rest[1:end]
+			rest = rest[end+1:]
+			switch {
+			case len(value) == 0:
+				return nil, fmt.Errorf("invalid path %s: empty brackets", path)
+			case value == "*":
+				segments = append(segments, segment{index: -1, wildcard: true})
+			default:
+				if index, err := strconv.Atoi(value); err == nil {
+					segments = append(segments, segment{index: index})
+				} else {
+					segments = append(segments, segment{key: strings.Trim(value, `'"`), index: -1})
+				}
+			}
+
+		default:
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			key := rest[:end]
+			rest = rest[end:]
+			if key == "*" {
+				segments = append(segments, segment{index: -1, wildcard: true})
+			} else {
+				segments = append(segments, segment{key: key, index: -1})
+			}
+		}
+	}
+
+	if len(segments) == 0 {
+		return nil, fmt.Errorf("invalid path %s: empty path", path)
+	}
+	return segments, nil
+}
+
+// ValidatePath returns an error if the given field path is not valid
+func ValidatePath(path string) error {
+	_, err := parsePath(path)
+	return err
+}
+
+// FieldPath returns the path of the field with the given key in the map at the given path,
+// like "data.password" or "metadata.annotations[kubectl.kubernetes.io/last-applied-configuration]"
+func FieldPath(path, key string) string {
+	switch {
+	case strings.ContainsAny(key, ".[]"):
+		return fmt.Sprintf("%s[%s]", path, key)
+	case len(path) == 0:
+		return key
+	default:
+		return path + "." + key
+	}
+}
+
+// ElementPath returns the path of the element with the given index in the list at the given path,
+// like "spec.containers[0]"
+func ElementPath(path string, index int) string {
+	return fmt.Sprintf("%s[%d]", path, index)
+}
+
+// visit calls the given function for each parent (map or list) of the fields
+// matching the given path in the given value (at the given field path),
+// with the field path of the parent and the last segment of the path
+func visit(value interface{}, path string, segments []segment, fn func(parent interface{}, path string, last segment)) {
+	if len(segments) == 1 {
+		fn(value, path, segments[0])
+		return
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if segments[0].wildcard || (segments[0].index < 0 && key == segments[0].key) {
+				visit(child, FieldPath(path, key), segments[1:], fn)
+			}
+		}
+	case []interface{}:
+		for i, child := range v {
+			if segments[0].wildcard || i == segments[0].index {
+				visit(child, ElementPath(path, i), segments[1:], fn)
+			}
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package normalize
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+
+	"github.com/ghodss/yaml"
+)
+
+// Rule represents a normalization rule, that strips or normalizes
+// some fields of the resources of the given kinds
+type Rule struct {
+	// Kinds are the kinds of resources to which the rule applies.
+	// The rule applies to all kinds if it is empty, or if it contains "*".
+	Kinds []string `json:"kinds,omitempty"`
+
+	// Remove are the paths of the fields to remove
+	Remove []string `json:"remove,omitempty"`
+
+	// Set are the paths of the fields to normalize, with the value to use.
+	// Only existing fields are modified.
+	Set map[string]interface{} `json:"set,omitempty"`
+}
+
+// Rules represents a set of normalization rules
+type Rules []Rule
+
+// DefaultRules returns the built-in normalization rules,
+// which remove the fields that change often without any meaningful change
+// from the user point of view.
+func DefaultRules() Rules {
+	return Rules{
+		{
+			Remove: []string{
+				"status",
+				"metadata.generation",
+				"metadata.annotations[kubectl.kubernetes.io/last-applied-configuration]",
+			},
+		},
+		{
+			Kinds: []string{"DeploymentConfig"},
+			Remove: []string{
+				"spec.triggers[*].imageChangeParams.lastTriggeredImage",
+			},
+		},
+		{
+			Kinds: []string{"ImageStream"},
+			Remove: []string{
+				"metadata.annotations[openshift.io/image.dockerRepositoryCheck]",
+			},
+		},
+	}
+}
+
+// LoadRules loads the normalization rules from the given file (in YAML or JSON),
+// which should contain a list of rules, each with the "kinds" it applies to,
+// and the paths of the fields to "remove" or to "set".
+func LoadRules(path string) (Rules, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := Rules{}
+	if err := yaml.Unmarshal(content, &rules); err != nil {
+		return nil, fmt.Errorf("Failed to read rules from %s: %v", path, err)
+	}
+
+	if err := rules.Validate(); err != nil {
+		return nil, fmt.Errorf("Invalid rules in %s: %v", path, err)
+	}
+
+	return rules, nil
+}
+
+// Validate checks that all the paths of the rules are valid
+func (rules Rules) Validate() error {
+	for _, rule := range rules {
+		for _, path := range rule.Remove {
+			if _, err := parsePath(path); err != nil {
+				return err
+			}
+		}
+		for path := range rule.Set {
+			if _, err := parsePath(path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ForKind returns the rules that apply to the given kind
+func (rules Rules) ForKind(kind string) Rules {
+	result := Rules{}
+	for _, rule := range rules {
+		if len(rule.Kinds) == 0 {
+			result = append(result, rule)
+			continue
+		}
+		for _, k := range rule.Kinds {
+			if k == "*" || k == kind {
+				result = append(result, rule)
+				break
+			}
+		}
+	}
+	return result
+}
+
+// Apply applies the rules to the given (generic) object
+func (rules Rules) Apply(obj map[string]interface{}) error {
+	for _, rule := range rules {
+		for _, path := range rule.Remove {
+			segments, err := parsePath(path)
+			if err != nil {
+				return err
+			}
+			remove(obj, segments)
+		}
+
+		for path, value := range rule.Set {
+			segments, err := parsePath(path)
+			if err != nil {
+				return err
+			}
+			visit(obj, "", segments, func(parent interface{}, path string, last segment) {
+				set(parent, last, value)
+			})
+		}
+	}
+	return nil
+}
+
+// Normalize applies the rules for the given kind to the given content,
+// in the given format ("json" or "yaml"), and returns the normalized content.
+// The content is returned as-is if there is no rule for the given kind.
+func (rules Rules) Normalize(kind string, content []byte, format string) ([]byte, error) {
+	rules = rules.ForKind(kind)
+	if len(rules) == 0 {
+		return content, nil
+	}
+
+	obj := map[string]interface{}{}
+	if err := yaml.Unmarshal(content, &obj); err != nil {
+		return nil, err
+	}
+
+	if err := rules.Apply(obj); err != nil {
+		return nil, err
+	}
+
+	return Encode(obj, format)
+}
+
+// Encode encodes the given (generic) object in the given format ("json" or "yaml"),
+// the same way the kubectl printers do
+func Encode(obj map[string]interface{}, format string) ([]byte, error) {
+	switch format {
+	case "json":
+		data, err := json.Marshal(obj)
+		if err != nil {
+			return nil, err
+		}
+		dst := bytes.Buffer{}
+		if err := json.Indent(&dst, data, "", "    "); err != nil {
+			return nil, err
+		}
+		dst.WriteByte('\n')
+		return dst.Bytes(), nil
+	default:
+		return yaml.Marshal(obj)
+	}
+}
+
+// Transform replaces the values of the existing fields matching the given path
+// in the given (generic) object, with the result of the given function
+func Transform(obj map[string]interface{}, path string, fn func(value interface{}) (interface{}, error)) error {
+	return TransformWithKey(obj, path, func(key string, value interface{}) (interface{}, error) {
+		return fn(value)
+	})
+}
+
+// TransformWithKey is like Transform, but the given function also receives the key
+// of each matching field (the key in its parent map, or the index in its parent list)
+func TransformWithKey(obj map[string]interface{}, path string, fn func(key string, value interface{}) (interface{}, error)) error {
+	return transform(obj, path, func(key, fieldPath string, value interface{}) (interface{}, error) {
+		return fn(key, value)
+	})
+}
+
+// TransformWithPath is like Transform, but the given function also receives the path
+// of each matching field, like "data.password" (see FieldPath and ElementPath)
+func TransformWithPath(obj map[string]interface{}, path string, fn func(fieldPath string, value interface{}) (interface{}, error)) error {
+	return transform(obj, path, func(key, fieldPath string, value interface{}) (interface{}, error) {
+		return fn(fieldPath, value)
+	})
+}
+
+// transform replaces the values of the existing fields matching the given path
+// in the given (generic) object, with the result of the given function
+// - which receives the key and the path of each matching field
+func transform(obj map[string]interface{}, path string, fn func(key, fieldPath string, value interface{}) (interface{}, error)) error {
+	segments, err := parsePath(path)
+	if err != nil {
+		return err
+	}
+
+	var transformErr error
+	apply := func(key, fieldPath string, value interface{}) interface{} {
+		result, err := fn(key, fieldPath, value)
+		if err != nil {
+			transformErr = err
+			return value
+		}
+		return result
+	}
+
+	visit(obj, "", segments, func(parent interface{}, parentPath string, last segment) {
+		switch p := parent.(type) {
+		case map[string]interface{}:
+			for key, value := range p {
+				if last.wildcard || (last.index < 0 && key == last.key) {
+					p[key] = apply(key, FieldPath(parentPath, key), value)
+				}
+			}
+		case []interface{}:
+			for i, value := range p {
+				if last.wildcard || i == last.index {
+					p[i] = apply(strconv.Itoa(i), ElementPath(parentPath, i), value)
+				}
+			}
+		}
+	})
+	return transformErr
+}
+
+// remove removes the fields matching the given path from the given value (map or list),
+// and returns the resulting value: the elements removed from a list are spliced out of it,
+// so the caller must replace the list with the result.
+func remove(value interface{}, segments []segment) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if segments[0].wildcard || (segments[0].index < 0 && key == segments[0].key) {
+				if len(segments) == 1 {
+					delete(v, key)
+				} else {
+					v[key] = remove(child, segments[1:])
+				}
+			}
+		}
+		return v
+	case []interface{}:
+		if len(segments) > 1 {
+			for i, child := range v {
+				if segments[0].wildcard || i == segments[0].index {
+					v[i] = remove(child, segments[1:])
+				}
+			}
+			return v
+		}
+		result := []interface{}{}
+		for i, child := range v {
+			if !segments[0].wildcard && i != segments[0].index {
+				result = append(result, child)
+			}
+		}
+		return result
+	}
+	return value
+}
+
+// set sets the given value to the existing field matching the given last segment of a path
+// in the given parent (map or list)
+func set(parent interface{}, last segment, value interface{}) {
+	switch p := parent.(type) {
+	case map[string]interface{}:
+		for key := range p {
+			if last.wildcard || (last.index < 0 && key == last.key) {
+				p[key] = value
+			}
+		}
+	case []interface{}:
+		for i := range p {
+			if last.wildcard || i == last.index {
+				p[i] = value
+			}
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package normalize
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		rules          Rules
+		kind           string
+		format         string
+		content        string
+		expectedResult string
+	}{
+		{
+			rules:          DefaultRules(),
+			kind:           "Service",
+			format:         "yaml",
+			content:        "kind: Service\nmetadata:\n  generation: 3\n  name: svc\nstatus:\n  loadBalancer: {}\n",
+			expectedResult: "kind: Service\nmetadata:\n  name: svc\n",
+		},
+		{
+			rules:          DefaultRules(),
+			kind:           "Service",
+			format:         "yaml",
+			content:        "kind: Service\nmetadata:\n  annotations:\n    kubectl.kubernetes.io/last-applied-configuration: '{}'\n    other: value\n",
+			expectedResult: "kind: Service\nmetadata:\n  annotations:\n    other: value\n",
+		},
+		{
+			rules:          DefaultRules(),
+			kind:           "DeploymentConfig",
+			format:         "json",
+			content:        `{"spec":{"triggers":[{"imageChangeParams":{"from":"is:latest","lastTriggeredImage":"sha"}},{"type":"ConfigChange"}]}}`,
+			expectedResult: "{\n    \"spec\": {\n        \"triggers\": [\n            {\n                \"imageChangeParams\": {\n                    \"from\": \"is:latest\"\n                }\n            },\n            {\n                \"type\": \"ConfigChange\"\n            }\n        ]\n    }\n}\n",
+		},
+		{
+			rules: Rules{
+				{
+					Remove: []string{"spec.ports[0]", "spec.rules[*]", "spec.containers[*].env[1]"},
+				},
+			},
+			kind:           "Pod",
+			format:         "json",
+			content:        `{"spec":{"containers":[{"env":[{"name":"A"},{"name":"B"},{"name":"C"}]}],"ports":[80,443],"rules":[1,2]}}`,
+			expectedResult: "{\n    \"spec\": {\n        \"containers\": [\n            {\n                \"env\": [\n                    {\n                        \"name\": \"A\"\n                    },\n                    {\n                        \"name\": \"C\"\n                    }\n                ]\n            }\n        ],\n        \"ports\": [\n            443\n        ],\n        \"rules\": []\n    }\n}\n",
+		},
+		{
+			rules: Rules{
+				{
+					Kinds: []string{"Route"},
+					Set:   map[string]interface{}{"spec.host": "normalized", "spec.missing": "x"},
+				},
+			},
+			kind:           "Route",
+			format:         "yaml",
+			content:        "spec:\n  host: route-ns.example.com\n",
+			expectedResult: "spec:\n  host: normalized\n",
+		},
+		{
+			rules: Rules{
+				{
+					Kinds:  []string{"Route"},
+					Remove: []string{"spec.host"},
+				},
+			},
+			kind:           "Service",
+			format:         "yaml",
+			content:        "spec:\n    host: unchanged\n",
+			expectedResult: "spec:\n    host: unchanged\n",
+		},
+	}
+
+	for count, test := range tests {
+		result, err := test.rules.Normalize(test.kind, []byte(test.content), test.format)
+		if err != nil {
+			t.Errorf("Test[%d] Failed: %v", count, err)
+			continue
+		}
+		if string(result) != test.expectedResult {
+			t.Errorf("Test[%d] Failed: Expected '%s' but got '%s'", count, test.expectedResult, string(result))
+		}
+	}
+}
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		path           string
+		expectedResult []segment
+		expectedError  bool
+	}{
+		{
+			path:           "metadata.name",
+			expectedResult: []segment{{key: "metadata", index: -1}, {key: "name", index: -1}},
+		},
+		{
+			path:           "metadata.annotations[openshift.io/generated-by]",
+			expectedResult: []segment{{key: "metadata", index: -1}, {key: "annotations", index: -1}, {key: "openshift.io/generated-by", index: -1}},
+		},
+		{
+			path:           "spec.ports[0].port",
+			expectedResult: []segment{{key: "spec", index: -1}, {key: "ports", index: -1}, {index: 0}, {key: "port", index: -1}},
+		},
+		{
+			path:           "spec.triggers[*]",
+			expectedResult: []segment{{key: "spec", index: -1}, {key: "triggers", index: -1}, {index: -1, wildcard: true}},
+		},
+		{
+			path:          "spec..host",
+			expectedError: true,
+		},
+		{
+			path:          "spec[0",
+			expectedError: true,
+		},
+		{
+			path:          "",
+			expectedError: true,
+		},
+	}
+
+	for count, test := range tests {
+		result, err := parsePath(test.path)
+		if test.expectedError {
+			if err == nil {
+				t.Errorf("Test[%d] Failed: Expected an error but got %v", count, result)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test[%d] Failed: %v", count, err)
+			continue
+		}
+		if len(result) != len(test.expectedResult) {
+			t.Errorf("Test[%d] Failed: Expected %v but got %v", count, test.expectedResult, result)
+			continue
+		}
+		for i := range result {
+			if result[i] != test.expectedResult[i] {
+				t.Errorf("Test[%d] Failed: Expected %v but got %v", count, test.expectedResult, result)
+				break
+			}
+		}
+	}
+}
+
+func TestTransformWithPath(t *testing.T) {
+	obj := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{"openshift.io/generated-by": "x"},
+		},
+		"spec": map[string]interface{}{
+			"ports": []interface{}{map[string]interface{}{"port": 80}, map[string]interface{}{"port": 443}},
+		},
+	}
+
+	tests := []struct {
+		path          string
+		expectedPaths []string
+	}{
+		{
+			path:          "metadata.annotations[*]",
+			expectedPaths: []string{"metadata.annotations[openshift.io/generated-by]"},
+		},
+		{
+			path:          "spec.ports[*].port",
+			expectedPaths: []string{"spec.ports[0].port", "spec.ports[1].port"},
+		},
+	}
+
+	for count, test := range tests {
+		paths := []string{}
+		err := TransformWithPath(obj, test.path, func(fieldPath string, value interface{}) (interface{}, error) {
+			paths = append(paths, fieldPath)
+			return value, nil
+		})
+		if err != nil {
+			t.Errorf("Test[%d] Failed: %v", count, err)
+			continue
+		}
+		sort.Strings(paths)
+		if !reflect.DeepEqual(paths, test.expectedPaths) {
+			t.Errorf("Test[%d] Failed: Expected %v but got %v", count, test.expectedPaths, paths)
+		}
+	}
+}
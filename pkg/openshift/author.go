@@ -0,0 +1,325 @@
+package openshift
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/vbehar/openshift-git/pkg/audit"
+
+	buildapi "github.com/openshift/origin/pkg/build/api"
+	deployapi "github.com/openshift/origin/pkg/deploy/api"
+
+	kapi "k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/meta"
+	"k8s.io/kubernetes/pkg/api/unversioned"
+	"k8s.io/kubernetes/pkg/client/cache"
+	"k8s.io/kubernetes/pkg/kubectl"
+	"k8s.io/kubernetes/pkg/runtime"
+
+	"github.com/golang/glog"
+)
+
+// Author represents the author of a change on a resource
+type Author struct {
+	// Name is the name of the author (usually the OpenShift user name)
+	Name string
+
+	// Email is the email of the author (optional)
+	Email string
+}
+
+// String returns a string representation of the author
+func (a *Author) String() string {
+	if len(a.Email) > 0 {
+		return a.Name + " <" + a.Email + ">"
+	}
+	return a.Name
+}
+
+// AuthorResolver resolves the author of the last change of a resource
+type AuthorResolver interface {
+	// AuthorFor returns the author of the last change of the given resource,
+	// or nil if it is unknown
+	AuthorFor(resource *Resource) *Author
+}
+
+// AuthorResolvers is an AuthorResolver that returns
+// the author found by the first resolver that knows it
+type AuthorResolvers []AuthorResolver
+
+// AuthorFor implements the AuthorResolver interface
+func (resolvers AuthorResolvers) AuthorFor(resource *Resource) *Author {
+	for _, resolver := range resolvers {
+		if author := resolver.AuthorFor(resource); author != nil {
+			return author
+		}
+	}
+	return nil
+}
+
+// AnnotationsAuthorResolver is an AuthorResolver that uses
+// the annotations of the resources - such as "openshift.io/requester"
+type AnnotationsAuthorResolver struct {
+	// Annotations are the keys of the annotations that may contain the name of the author,
+	// in order of preference
+	Annotations []string
+}
+
+// AuthorFor implements the AuthorResolver interface
+func (r *AnnotationsAuthorResolver) AuthorFor(resource *Resource) *Author {
+	if resource.Object == nil {
+		return nil
+	}
+
+	accessor, err := meta.Accessor(resource.Object)
+	if err != nil {
+		return nil
+	}
+
+	annotations := accessor.GetAnnotations()
+	for _, annotation := range r.Annotations {
+		if name := annotations[annotation]; len(name) > 0 {
+			return &Author{Name: name}
+		}
+	}
+	return nil
+}
+
+// Cause represents the cause of the latest version of a resource versioned by the cluster
+type Cause struct {
+	// Version is the latest version of the resource
+	Version int
+
+	// Trigger is the name of the trigger which caused the latest version
+	// (like "system:image-change-trigger"), or empty if it has not been triggered automatically
+	Trigger string
+}
+
+// causeFor returns the cause of the latest version of the given object,
+// or nil if it is not versioned by the cluster.
+// It must be called before the object is exported, because the export clears its status.
+func causeFor(obj runtime.Object) *Cause {
+	dc, ok := obj.(*deployapi.DeploymentConfig)
+	if !ok {
+		return nil
+	}
+
+	cause := &Cause{Version: dc.Status.LatestVersion}
+	if dc.Status.Details == nil {
+		return cause
+	}
+	for _, c := range dc.Status.Details.Causes {
+		if c != nil && c.Type == deployapi.DeploymentTriggerOnImageChange {
+			cause.Trigger = "system:image-change-trigger"
+			break
+		}
+	}
+	return cause
+}
+
+// DeploymentCauseAuthorResolver is an AuthorResolver that uses
+// the causes of the deployments of the DeploymentConfigs (see Resource.Cause):
+// the new deployments caused by an image change trigger are attributed to the trigger itself.
+// Only the changes of the latest version are attributed, not the later edits
+// of the same deployment config (which keeps the causes of its latest deployment).
+// It is safe for concurrent use.
+type DeploymentCauseAuthorResolver struct {
+	lock sync.Mutex
+
+	// latestVersions are the latest versions of the deployment configs, per key ("namespace/name" format)
+	latestVersions map[string]int
+}
+
+// AuthorFor implements the AuthorResolver interface
+func (r *DeploymentCauseAuthorResolver) AuthorFor(resource *Resource) *Author {
+	if resource.Cause == nil {
+		return nil
+	}
+
+	r.lock.Lock()
+	if r.latestVersions == nil {
+		r.latestVersions = map[string]int{}
+	}
+	key := resource.NamespacedName()
+	if !resource.Exists {
+		delete(r.latestVersions, key)
+		r.lock.Unlock()
+		return nil
+	}
+	previousVersion, seen := r.latestVersions[key]
+	r.latestVersions[key] = resource.Cause.Version
+	r.lock.Unlock()
+
+	// on first sight, we don't know if the latest version is new
+	if !seen || previousVersion == resource.Cause.Version || len(resource.Cause.Trigger) == 0 {
+		return nil
+	}
+	return &Author{Name: resource.Cause.Trigger}
+}
+
+// BuildCauseAnnotation is the annotation of the builds with the cause of the build,
+// such as "Image change" or "GitHub WebHook"
+const BuildCauseAnnotation = "openshift.io/build.cause"
+
+// BuildCauseAuthorResolver is an AuthorResolver that uses
+// the causes of the builds: the builds triggered automatically
+// are attributed to the trigger itself (the manual builds are not attributed).
+// Note that the builds are not exported by default: they need to be requested explicitly.
+type BuildCauseAuthorResolver struct{}
+
+// buildCauseAuthors are the authors of the builds, per (lower case) keyword of their cause
+var buildCauseAuthors = []struct {
+	keyword string
+	author  string
+}{
+	{keyword: "image", author: "system:image-change-trigger"},
+	{keyword: "config", author: "system:config-change-trigger"},
+	{keyword: "github", author: "system:github-webhook"},
+	{keyword: "generic", author: "system:generic-webhook"},
+}
+
+// AuthorFor implements the AuthorResolver interface
+func (r *BuildCauseAuthorResolver) AuthorFor(resource *Resource) *Author {
+	build, ok := resource.Object.(*buildapi.Build)
+	if !ok {
+		return nil
+	}
+
+	cause := strings.ToLower(build.Annotations[BuildCauseAnnotation])
+	if len(cause) == 0 {
+		return nil
+	}
+	for _, buildCause := range buildCauseAuthors {
+		if strings.Contains(cause, buildCause.keyword) {
+			return &Author{Name: buildCause.author}
+		}
+	}
+	return nil
+}
+
+// LastAppliedAuthorResolver is an AuthorResolver that uses
+// the last configuration applied with "kubectl apply" (or "oc apply"), stored in an annotation:
+// if the resource still contains all the applied fields, its last change is attributed
+// to the (configured) user who applies the configurations.
+type LastAppliedAuthorResolver struct {
+	// Name is the name of the user who applies the configurations
+	Name string
+}
+
+// AuthorFor implements the AuthorResolver interface
+func (r *LastAppliedAuthorResolver) AuthorFor(resource *Resource) *Author {
+	if resource.Object == nil {
+		return nil
+	}
+
+	accessor, err := meta.Accessor(resource.Object)
+	if err != nil {
+		return nil
+	}
+	lastApplied := accessor.GetAnnotations()[kubectl.LastAppliedConfigAnnotation]
+	if len(lastApplied) == 0 {
+		return nil
+	}
+
+	var applied map[string]interface{}
+	if err := json.Unmarshal([]byte(lastApplied), &applied); err != nil {
+		glog.V(3).Infof("Invalid last applied configuration for %s: %v", resource, err)
+		return nil
+	}
+	apiVersion, _ := applied["apiVersion"].(string)
+	if len(apiVersion) == 0 {
+		return nil
+	}
+
+	// the last applied configuration is versioned, while the resource is not
+	versioned, err := kapi.Scheme.ConvertToVersion(resource.Object, apiVersion)
+	if err != nil {
+		glog.V(3).Infof("Failed to convert %s to %s: %v", resource, apiVersion, err)
+		return nil
+	}
+	data, err := json.Marshal(versioned)
+	if err != nil {
+		return nil
+	}
+	var current map[string]interface{}
+	if err := json.Unmarshal(data, &current); err != nil {
+		return nil
+	}
+
+	// the version and kind are not always set on the converted object
+	delete(applied, "apiVersion")
+	delete(applied, "kind")
+	if !containsAll(current, applied) {
+		return nil
+	}
+	return &Author{Name: r.Name}
+}
+
+// containsAll returns true if the given (JSON) value contains all the fields of the given subset,
+// with the same values
+func containsAll(value, subset interface{}) bool {
+	switch subset := subset.(type) {
+	case map[string]interface{}:
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for key, subValue := range subset {
+			if !containsAll(m[key], subValue) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		list, ok := value.([]interface{})
+		if !ok || len(list) != len(subset) {
+			return false
+		}
+		for i := range subset {
+			if !containsAll(list[i], subset[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.DeepEqual(value, subset)
+	}
+}
+
+// AuditLogAuthorResolver is an AuthorResolver that uses
+// an OpenShift audit log, to find the last user who modified (or created) a resource
+type AuditLogAuthorResolver struct {
+	// Log is the (tailed) audit log
+	Log *audit.Log
+
+	// ResourceForGroupKind returns the type of resource (in its plural form, like "buildconfigs")
+	// for the given API group and kind
+	ResourceForGroupKind func(gk unversioned.GroupKind) (string, error)
+}
+
+// AuthorFor implements the AuthorResolver interface
+func (r *AuditLogAuthorResolver) AuthorFor(resource *Resource) *Author {
+	resourceType, err := r.ResourceForGroupKind(resource.GroupKind())
+	if err != nil {
+		return nil
+	}
+
+	// the request may have been logged after the last poll of the audit log
+	r.Log.CatchUp(resource.ReceivedAt)
+
+	if resource.Status == string(cache.Added) && resource.Object != nil {
+		// the name of a created resource is not logged, only its type and namespace
+		if objectMeta, err := kapi.ObjectMetaFor(resource.Object); err == nil {
+			if name, found := r.Log.CreatorFor(resourceType, resource.Namespace, objectMeta.CreationTimestamp.Time); found {
+				return &Author{Name: name}
+			}
+		}
+	}
+
+	if name, found := r.Log.UserFor(resourceType, resource.Namespace, resource.Name); found {
+		return &Author{Name: name}
+	}
+	return nil
+}
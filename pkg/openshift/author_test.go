@@ -0,0 +1,119 @@
+package openshift
+
+import (
+	"testing"
+
+	buildapi "github.com/openshift/origin/pkg/build/api"
+	deployapi "github.com/openshift/origin/pkg/deploy/api"
+
+	kapi "k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/client/cache"
+	"k8s.io/kubernetes/pkg/runtime"
+)
+
+// exportedResource returns the resource pushed by a controller for the given change of the given object,
+// so that it goes through the same export as the real changes
+func exportedResource(t *testing.T, deltaType cache.DeltaType, obj runtime.Object) *Resource {
+	resourcesChan := make(chan Resource, 1)
+	c := &ExportController{
+		Kind:          obj,
+		ResourcesChan: resourcesChan,
+	}
+	if err := c.handle(cache.Deltas{{Type: deltaType, Object: obj}}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case resource := <-resourcesChan:
+		return &resource
+	default:
+		t.Fatalf("Expected a resource to be exported for %T", obj)
+		return nil
+	}
+}
+
+// deploymentConfig returns a deployment config with the given latest version and causes
+func deploymentConfig(latestVersion int, causes ...deployapi.DeploymentTriggerType) *deployapi.DeploymentConfig {
+	dc := &deployapi.DeploymentConfig{
+		ObjectMeta: kapi.ObjectMeta{
+			Namespace: "foo",
+			Name:      "app",
+			SelfLink:  "/oapi/v1/namespaces/foo/deploymentconfigs/app",
+		},
+		Status: deployapi.DeploymentConfigStatus{
+			LatestVersion: latestVersion,
+			Details:       &deployapi.DeploymentDetails{},
+		},
+	}
+	for _, cause := range causes {
+		dc.Status.Details.Causes = append(dc.Status.Details.Causes, &deployapi.DeploymentCause{Type: cause})
+	}
+	return dc
+}
+
+func TestDeploymentCauseAuthorResolver(t *testing.T) {
+	resolver := &DeploymentCauseAuthorResolver{}
+
+	tests := []struct {
+		name           string
+		deltaType      cache.DeltaType
+		dc             *deployapi.DeploymentConfig
+		expectedAuthor string
+	}{
+		{
+			name:      "first sight",
+			deltaType: cache.Sync,
+			dc:        deploymentConfig(1, deployapi.DeploymentTriggerOnImageChange),
+		},
+		{
+			name:           "new version caused by an image change",
+			deltaType:      cache.Updated,
+			dc:             deploymentConfig(2, deployapi.DeploymentTriggerOnImageChange),
+			expectedAuthor: "system:image-change-trigger",
+		},
+		{
+			name:      "edit of the same version",
+			deltaType: cache.Updated,
+			dc:        deploymentConfig(2, deployapi.DeploymentTriggerOnImageChange),
+		},
+		{
+			name:      "new version caused by a config change",
+			deltaType: cache.Updated,
+			dc:        deploymentConfig(3, deployapi.DeploymentTriggerOnConfigChange),
+		},
+	}
+
+	for _, test := range tests {
+		resource := exportedResource(t, test.deltaType, test.dc)
+		if dc := resource.Object.(*deployapi.DeploymentConfig); dc.Status.Details != nil {
+			t.Fatalf("%s: expected the status of the deployment config to be cleared by the export", test.name)
+		}
+
+		author := resolver.AuthorFor(resource)
+		switch {
+		case len(test.expectedAuthor) == 0 && author != nil:
+			t.Errorf("%s: expected no author, but got %s", test.name, author)
+		case len(test.expectedAuthor) > 0 && (author == nil || author.Name != test.expectedAuthor):
+			t.Errorf("%s: expected the author %s, but got %v", test.name, test.expectedAuthor, author)
+		}
+	}
+}
+
+func TestBuildCauseAuthorResolver(t *testing.T) {
+	build := &buildapi.Build{
+		ObjectMeta: kapi.ObjectMeta{
+			Namespace: "foo",
+			Name:      "app-1",
+			SelfLink:  "/oapi/v1/namespaces/foo/builds/app-1",
+			Annotations: map[string]string{
+				BuildCauseAnnotation: "Image change",
+			},
+		},
+	}
+
+	resource := exportedResource(t, cache.Added, build)
+	author := (&BuildCauseAuthorResolver{}).AuthorFor(resource)
+	if author == nil || author.Name != "system:image-change-trigger" {
+		t.Errorf("Expected the author system:image-change-trigger, but got %v", author)
+	}
+}
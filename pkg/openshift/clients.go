@@ -0,0 +1,24 @@
+package openshift
+
+import (
+	"k8s.io/kubernetes/pkg/api/meta"
+	"k8s.io/kubernetes/pkg/kubectl/resource"
+)
+
+// RESTClientFor returns the REST client that should be used for the given mapping,
+// based on its API group and version: the OpenShift client for the OpenShift kinds,
+// or the Kubernetes client for the right API group otherwise.
+func RESTClientFor(mapping *meta.RESTMapping) (resource.RESTClient, error) {
+	return Factory.ClientForMapping(mapping)
+}
+
+// ClusterName returns the given name of the cluster,
+// or the URL of the OpenShift API server if the given name is empty
+func ClusterName(name string) string {
+	if len(name) == 0 {
+		if config, err := Factory.ClientConfig(); err == nil {
+			return config.Host
+		}
+	}
+	return name
+}
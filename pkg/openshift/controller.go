@@ -1,12 +1,14 @@
 package openshift
 
 import (
+	"sync"
 	"time"
 
 	"github.com/openshift/origin/pkg/cmd/cli/cmd"
 	"github.com/openshift/origin/pkg/controller"
 
 	kapi "k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/unversioned"
 	"k8s.io/kubernetes/pkg/client/cache"
 	"k8s.io/kubernetes/pkg/labels"
 	"k8s.io/kubernetes/pkg/runtime"
@@ -50,12 +52,39 @@ type ExportController struct {
 	// LabelSelector is a user-provided labelSelector as a string
 	// used to restrict the resources for the provided kind
 	LabelSelector string
+
+	// ResourceVersion is the (optional) resource version from which the watch is resumed:
+	// the initial list is skipped, and only the changes since this version are handled.
+	// If the server answers that it is too old (410 Gone), the reflector falls back to a full list.
+	ResourceVersion string
+
+	// FailureFunc is an (optional) function called with the key ("namespace/name" format)
+	// of a resource whose change could not be handled - it is then retried, or dropped after too many retries.
+	FailureFunc func(key string)
+
+	// queue is the queue of the changes, set when the controller runs
+	queue *cache.DeltaFIFO
+
+	// lock protects stopped, resuming and ResourceVersion
+	lock sync.Mutex
+
+	// resuming is true once the watch is resumed from ResourceVersion,
+	// until the (empty) initial list has replaced the content of the queue
+	resuming bool
+
+	// stopped is true once the controller has been stopped:
+	// the changes are not handled anymore
+	stopped bool
+
+	// inFlight tracks the changes being handled
+	inFlight sync.WaitGroup
 }
 
 // RunUntil runs the controller in a goroutine
 // until stopChan is closed
 func (c *ExportController) RunUntil(stopChan <-chan struct{}) {
 	queue := cache.NewDeltaFIFO(cache.MetaNamespaceKeyFunc, nil, c)
+	c.queue = queue
 	cache.NewReflector(c, nil, queue, c.ResyncPeriod).RunUntil(stopChan)
 
 	retryController := &controller.RetryController{
@@ -71,10 +100,39 @@ func (c *ExportController) RunUntil(stopChan <-chan struct{}) {
 	retryController.RunUntil(stopChan)
 }
 
+// HasSynced returns true if the controller is running,
+// and the initial list of the resources has been handled
+func (c *ExportController) HasSynced() bool {
+	return c.queue != nil && c.queue.HasSynced()
+}
+
+// Stop stops handling the changes, and waits until the changes being handled
+// have been pushed to the output resources channel - so that it can then be closed.
+// The changes still in the queue are dropped: they will be handled again
+// by the next run, thanks to the initial list.
+// Note that the stopChan given to RunUntil should be closed first.
+func (c *ExportController) Stop() {
+	c.lock.Lock()
+	c.stopped = true
+	c.lock.Unlock()
+
+	c.inFlight.Wait()
+}
+
 // handle handles an event change
 // by converting it to a known resource
 // and pushing it to the output resources channel
 func (c *ExportController) handle(obj interface{}) error {
+	c.lock.Lock()
+	if c.stopped {
+		c.lock.Unlock()
+		glog.V(5).Infof("Dropping %T because the controller for %T is stopped", obj, c.Kind)
+		return nil
+	}
+	c.inFlight.Add(1)
+	c.lock.Unlock()
+	defer c.inFlight.Done()
+
 	exporter := cmd.NewExporter()
 	deltas := obj.(cache.Deltas)
 	for _, delta := range deltas {
@@ -82,12 +140,13 @@ func (c *ExportController) handle(obj interface{}) error {
 		if object, ok := delta.Object.(runtime.Object); ok {
 			glog.V(5).Infof("Handling %v for %T", delta.Type, delta.Object)
 
-			// get the reference before exporting
-			// (after it will be too late to get a reference)
-			ref, err := kapi.GetReference(object)
+			// get the reference and the cause before exporting
+			// (after it will be too late to get them)
+			ref, err := referenceFor(object)
 			if err != nil {
 				return err
 			}
+			cause := causeFor(object)
 
 			if err := exporter.Export(object, false); err != nil {
 				if err == cmd.ErrExportOmit {
@@ -111,6 +170,8 @@ func (c *ExportController) handle(obj interface{}) error {
 				Object:          object,
 				Exists:          exists,
 				Status:          string(delta.Type),
+				Cause:           cause,
+				ReceivedAt:      time.Now(),
 			}
 
 			glog.V(4).Infof("Processing %s", r)
@@ -123,6 +184,7 @@ func (c *ExportController) handle(obj interface{}) error {
 			glog.V(5).Infof("Handling %v DeletedFinalStateUnknown for %s: %+v", delta.Type, deletedObject.Key, deletedObject.Obj)
 
 			if resource, ok := deletedObject.Obj.(Resource); ok {
+				resource.ReceivedAt = time.Now()
 				glog.V(4).Infof("Processing %s", resource)
 				c.ResourcesChan <- resource
 				continue
@@ -141,6 +203,12 @@ func (c *ExportController) handle(obj interface{}) error {
 // retry is a controller.RetryFunc that should return true if the given object and error
 // should be retried after the provided number of times.
 func (c *ExportController) retry(obj interface{}, err error, retries controller.Retry) bool {
+	if c.FailureFunc != nil {
+		if key, keyErr := c.queue.KeyOf(obj); keyErr == nil {
+			c.FailureFunc(key)
+		}
+	}
+
 	// let's retry a few times...
 	return retries.Count < 5
 }
@@ -149,6 +217,20 @@ func (c *ExportController) retry(obj interface{}, err error, retries controller.
 // List should return a list type object; the Items field will be extracted, and the
 // ResourceVersion field will be used to start the watch in the right place.
 func (c *ExportController) List(options kapi.ListOptions) (runtime.Object, error) {
+	c.lock.Lock()
+	resourceVersion := c.ResourceVersion
+	c.ResourceVersion = ""
+	c.resuming = len(resourceVersion) > 0
+	c.lock.Unlock()
+
+	if len(resourceVersion) > 0 {
+		// an empty list, so that the reflector starts watching from the given version
+		glog.V(1).Infof("Resuming the watch of %T from resource version %s", c.Kind, resourceVersion)
+		return &kapi.List{
+			ListMeta: unversioned.ListMeta{ResourceVersion: resourceVersion},
+		}, nil
+	}
+
 	var err error
 	options.LabelSelector, err = c.extendSelector(options.LabelSelector)
 	if err != nil {
@@ -175,7 +257,17 @@ func (c *ExportController) Watch(options kapi.ListOptions) (watch.Interface, err
 // ListKeys implements the cache.KeyLister interface
 // It is a function that returns the list of keys ("namespace/name" format)
 // that we "know about" (to get a 2-way sync)
+// When the watch is resumed, no keys are returned to the replace of the (empty) initial list,
+// so that the resources we know about are not considered as deleted.
+// The keys are returned again after it, so that the resyncs still handle all the resources.
 func (c *ExportController) ListKeys() []string {
+	c.lock.Lock()
+	resuming := c.resuming
+	c.resuming = false
+	c.lock.Unlock()
+	if resuming {
+		return []string{}
+	}
 	return c.KeyListFunc()
 }
 
@@ -189,19 +281,5 @@ func (c *ExportController) GetByKey(key string) (interface{}, bool, error) {
 // extendSelector extends the given labelSelector with the controller's
 // requirements and user-provided labelSelector
 func (c *ExportController) extendSelector(selector labels.Selector) (labels.Selector, error) {
-	requirementFuncs := []func() (*labels.Requirement, error){}
-	requirementFuncs = append(requirementFuncs, c.Requirements...)
-
-	if len(c.LabelSelector) > 0 {
-		requirements, err := labels.ParseToRequirements(c.LabelSelector)
-		if err != nil {
-			return nil, err
-		}
-		for i := range requirements {
-			requirementFuncs = append(requirementFuncs, func() (*labels.Requirement, error) {
-				return &requirements[i], nil
-			})
-		}
-	}
-	return extendSelector(selector, requirementFuncs...)
+	return SelectorFor(selector, c.LabelSelector, c.Requirements...)
 }
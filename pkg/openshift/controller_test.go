@@ -0,0 +1,53 @@
+package openshift
+
+import (
+	"reflect"
+	"testing"
+
+	kapi "k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/meta"
+	"k8s.io/kubernetes/pkg/runtime"
+)
+
+func TestListKeysWhenResuming(t *testing.T) {
+	listed := false
+	c := &ExportController{
+		Kind:            &kapi.Service{},
+		ResourceVersion: "42",
+		KeyListFunc: func() []string {
+			return []string{"foo/a", "foo/b"}
+		},
+		ListFunc: func(options kapi.ListOptions) (runtime.Object, error) {
+			listed = true
+			return &kapi.ServiceList{}, nil
+		},
+	}
+
+	list, err := c.List(kapi.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if listed {
+		t.Errorf("Expected the list to be skipped when resuming")
+	}
+	if accessor, err := meta.Accessor(list); err != nil || accessor.GetResourceVersion() != "42" {
+		t.Errorf("Expected an empty list with the resource version 42, but got %+v (%v)", list, err)
+	}
+
+	// the replace of the empty initial list must not delete the known resources
+	if keys := c.ListKeys(); len(keys) != 0 {
+		t.Errorf("Expected no keys for the replace of the resumed list, but got %v", keys)
+	}
+
+	// but the resyncs must still handle them
+	if keys := c.ListKeys(); !reflect.DeepEqual(keys, []string{"foo/a", "foo/b"}) {
+		t.Errorf("Expected the known keys after the resumed list, but got %v", keys)
+	}
+
+	if _, err := c.List(kapi.ListOptions{}); err != nil || !listed {
+		t.Errorf("Expected a full list after the resumed list, but got %v", err)
+	}
+	if keys := c.ListKeys(); !reflect.DeepEqual(keys, []string{"foo/a", "foo/b"}) {
+		t.Errorf("Expected the known keys after a full list, but got %v", keys)
+	}
+}
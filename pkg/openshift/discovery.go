@@ -0,0 +1,136 @@
+package openshift
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/openshift/origin/pkg/client"
+
+	"k8s.io/kubernetes/pkg/api/errors"
+	"k8s.io/kubernetes/pkg/api/meta"
+	"k8s.io/kubernetes/pkg/api/unversioned"
+	"k8s.io/kubernetes/pkg/util/sets"
+
+	"github.com/golang/glog"
+)
+
+var (
+	// DiscoverKinds defines if the "everything" alias should be expanded
+	// by discovering the kinds supported by the server, instead of using AllKinds
+	DiscoverKinds bool
+
+	// ExcludedResources is the list of resources that are excluded
+	// from the discovered kinds of the "everything" alias.
+	// A resource can be qualified by its API group, like "jobs.extensions".
+	// By default, the resources served by multiple API groups are only kept in their "real" group,
+	// and the OAuth tokens are excluded: they are credentials, not configuration.
+	ExcludedResources = []string{"events", "builds", "pods", "endpoints", "componentstatuses", "nodes",
+		"horizontalpodautoscalers.extensions", "jobs.extensions",
+		"oauthaccesstokens", "oauthauthorizetokens", "oauthclientauthorizations"}
+)
+
+func init() {
+	Flags.BoolVar(&DiscoverKinds, "discover-kinds", false, "If present, the 'everything' alias will be expanded to all the kinds supported by the server (using API discovery: only the resources that can be listed and watched), instead of a static list of kinds. Requires a server reporting the verbs of its resources (Kubernetes 1.5 or OpenShift 3.5 and later).")
+	Flags.StringSliceVar(&ExcludedResources, "exclude-resources", ExcludedResources, "Resources excluded from the 'everything' alias, when the kinds are discovered (with '--discover-kinds'). A resource can be qualified by its API group, like 'jobs.extensions'.")
+}
+
+// DiscoveredResources returns the resources supported by the server
+// (for the preferred version of each API group),
+// that can be listed and watched (according to their verbs), and that are not excluded (see ExcludedResources)
+func DiscoveredResources(mapper meta.RESTMapper) ([]unversioned.GroupVersionResource, error) {
+	oclient, _, err := Factory.Clients()
+	if err != nil {
+		return nil, err
+	}
+
+	discoveryClient := client.NewDiscoveryClient(oclient.RESTClient)
+	groups, err := discoveryClient.ServerGroups()
+	if err != nil {
+		return nil, err
+	}
+
+	excluded := sets.NewString()
+	for _, r := range ExcludedResources {
+		excluded.Insert(aliasesForResource(mapper, r)...)
+	}
+
+	resources := []unversioned.GroupVersionResource{}
+	for _, group := range groups.Groups {
+		if len(group.PreferredVersion.GroupVersion) == 0 {
+			continue
+		}
+
+		gv, err := unversioned.ParseGroupVersion(group.PreferredVersion.GroupVersion)
+		if err != nil {
+			return nil, err
+		}
+
+		// the legacy resources of OpenShift are served by a different path than the ones of Kubernetes
+		paths := []string{"/apis/" + gv.String()}
+		if len(gv.Group) == 0 {
+			paths = []string{"/api/" + gv.Version, "/oapi/" + gv.Version}
+		}
+
+		for _, path := range paths {
+			data, err := oclient.RESTClient.Get().AbsPath(path).Do().Raw()
+			if err != nil {
+				if path != paths[0] && (errors.IsNotFound(err) || errors.IsForbidden(err)) {
+					// not an OpenShift server
+					continue
+				}
+				return nil, err
+			}
+
+			names, err := listableResources(data)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid resources for %s: %v", path, err)
+			}
+			for _, name := range names {
+				if excluded.Has(name) || excluded.Has(name+"."+gv.Group) {
+					glog.V(3).Infof("Excluding discovered resource %s", name)
+					continue
+				}
+				resources = append(resources, gv.WithResource(name))
+			}
+		}
+	}
+
+	return resources, nil
+}
+
+// discoveredResourceList is the list of resources of an API group version, returned by the API discovery.
+// The vendored unversioned.APIResourceList does not have the verbs of the resources.
+type discoveredResourceList struct {
+	Resources []struct {
+		Name  string   `json:"name"`
+		Verbs []string `json:"verbs"`
+	} `json:"resources"`
+}
+
+// listableResources returns the names of the resources of the given (JSON) list of the API discovery
+// that can be listed and watched - ignoring the sub-resources (like pods/log or buildconfigs/instantiate).
+// Returns an error if the verbs of the resources are not reported (by the servers older than Kubernetes 1.5),
+// because the virtual resources (like the subject access reviews) could not be told apart.
+func listableResources(data []byte) ([]string, error) {
+	list := discoveredResourceList{}
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, r := range list.Resources {
+		if len(r.Verbs) == 0 {
+			return nil, fmt.Errorf("the server does not report the verbs of the resource %s: the kinds can't be discovered", r.Name)
+		}
+		verbs := sets.NewString(r.Verbs...)
+		switch {
+		case strings.Contains(r.Name, "/"):
+		case !verbs.HasAll("list", "watch"):
+			glog.V(3).Infof("Ignoring discovered resource %s, which can't be listed and watched", r.Name)
+		default:
+			names = append(names, r.Name)
+		}
+	}
+	return names, nil
+}
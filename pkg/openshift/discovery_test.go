@@ -0,0 +1,34 @@
+package openshift
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestListableResources(t *testing.T) {
+	data := []byte(`{
+		"kind": "APIResourceList",
+		"groupVersion": "v1",
+		"resources": [
+			{"name": "configmaps", "namespaced": true, "kind": "ConfigMap", "verbs": ["create", "delete", "get", "list", "patch", "update", "watch"]},
+			{"name": "bindings", "namespaced": true, "kind": "Binding", "verbs": ["create"]},
+			{"name": "imagestreamimages", "namespaced": true, "kind": "ImageStreamImage", "verbs": ["get"]},
+			{"name": "componentstatuses", "namespaced": false, "kind": "ComponentStatus", "verbs": ["get", "list"]},
+			{"name": "pods", "namespaced": true, "kind": "Pod", "verbs": ["get", "list", "watch"]},
+			{"name": "pods/log", "namespaced": true, "kind": "Pod", "verbs": ["get", "list", "watch"]}
+		]
+	}`)
+
+	names, err := listableResources(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"configmaps", "pods"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected the listable resources %v, but got %v", expected, names)
+	}
+
+	// without the verbs, the virtual resources can't be told apart
+	if _, err := listableResources([]byte(`{"resources": [{"name": "bindings", "kind": "Binding"}]}`)); err == nil {
+		t.Errorf("Expected an error for the resources without verbs")
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"k8s.io/kubernetes/pkg/api/meta"
 	"k8s.io/kubernetes/pkg/api/unversioned"
 	"k8s.io/kubernetes/pkg/util/sets"
+
+	"github.com/golang/glog"
 )
 
 var (
@@ -21,11 +23,21 @@ var (
 
 // KindsFor parse the given list of kinds of resources (as string),
 // and return a list of valid kinds (or an error).
-// It supports the standard aliases, and our custom "everything" alias (see AllKinds).
+// It supports the standard aliases, and our custom "everything" alias
+// (see AllKinds, or DiscoverKinds to use the kinds supported by the server).
 func KindsFor(mapper meta.RESTMapper, kindsOrResources []string) ([]unversioned.GroupVersionKind, error) {
 	resources := sets.NewString()
+	discoveredResources := []unversioned.GroupVersionResource{}
 	for _, kindOrResource := range kindsOrResources {
 		if kindOrResource == "everything" {
+			if DiscoverKinds {
+				discovered, err := DiscoveredResources(mapper)
+				if err != nil {
+					return []unversioned.GroupVersionKind{}, err
+				}
+				discoveredResources = append(discoveredResources, discovered...)
+				continue
+			}
 			for _, r := range AllKinds {
 				resources.Insert(aliasesForResource(mapper, r)...)
 			}
@@ -42,8 +54,23 @@ func KindsFor(mapper meta.RESTMapper, kindsOrResources []string) ([]unversioned.
 		if err != nil {
 			return []unversioned.GroupVersionKind{}, err
 		}
-		if !kindNames.Has(gvk.Kind) {
-			kindNames.Insert(gvk.Kind)
+		gk := gvk.GroupKind()
+		if !kindNames.Has(gk.String()) {
+			kindNames.Insert(gk.String())
+			kinds = append(kinds, gvk)
+		}
+	}
+
+	for _, gvr := range discoveredResources {
+		gvk, err := mapper.KindFor(gvr)
+		if err != nil {
+			// the server supports a resource that we don't know about
+			glog.Warningf("Ignoring discovered resource %s/%s: %v", gvr.GroupVersion(), gvr.Resource, err)
+			continue
+		}
+		gk := gvk.GroupKind()
+		if !kindNames.Has(gk.String()) {
+			kindNames.Insert(gk.String())
 			kinds = append(kinds, gvk)
 		}
 	}
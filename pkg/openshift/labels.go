@@ -18,3 +18,24 @@ func extendSelector(selector labels.Selector, requirements ...func() (*labels.Re
 
 	return selector, nil
 }
+
+// SelectorFor returns the given selector (or everything if nil), extended with the given requirements
+// and the user-provided labelSelector: this is the selector used to list and watch the resources.
+func SelectorFor(selector labels.Selector, labelSelector string, requirements ...func() (*labels.Requirement, error)) (labels.Selector, error) {
+	requirementFuncs := []func() (*labels.Requirement, error){}
+	requirementFuncs = append(requirementFuncs, requirements...)
+
+	if len(labelSelector) > 0 {
+		parsed, err := labels.ParseToRequirements(labelSelector)
+		if err != nil {
+			return nil, err
+		}
+		for i := range parsed {
+			requirement := parsed[i]
+			requirementFuncs = append(requirementFuncs, func() (*labels.Requirement, error) {
+				return &requirement, nil
+			})
+		}
+	}
+	return extendSelector(selector, requirementFuncs...)
+}
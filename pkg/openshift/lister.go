@@ -55,13 +55,14 @@ func (l *ExportLister) List() error {
 	for _, obj := range items {
 		glog.V(5).Infof("Handling %T", obj)
 
-		// get the reference before exporting
-		// (after it will be too late to get a reference)
+		// get the reference and the cause before exporting
+		// (after it will be too late to get them)
 		var ref *kapi.ObjectReference
-		ref, err = kapi.GetReference(obj)
+		ref, err = referenceFor(obj)
 		if err != nil {
 			return err
 		}
+		cause := causeFor(obj)
 
 		if err := exporter.Export(obj, false); err != nil {
 			if err == cmd.ErrExportOmit {
@@ -77,6 +78,7 @@ func (l *ExportLister) List() error {
 			Object:          obj,
 			Exists:          true,
 			Status:          string(cache.Sync),
+			Cause:           cause,
 		}
 
 		glog.V(4).Infof("Processing %s", r)
@@ -89,19 +91,5 @@ func (l *ExportLister) List() error {
 // extendSelector extends the given labelSelector with the lister's
 // requirements and user-provided labelSelector
 func (l *ExportLister) extendSelector(selector labels.Selector) (labels.Selector, error) {
-	requirementFuncs := []func() (*labels.Requirement, error){}
-	requirementFuncs = append(requirementFuncs, l.Requirements...)
-
-	if len(l.LabelSelector) > 0 {
-		requirements, err := labels.ParseToRequirements(l.LabelSelector)
-		if err != nil {
-			return nil, err
-		}
-		for i := range requirements {
-			requirementFuncs = append(requirementFuncs, func() (*labels.Requirement, error) {
-				return &requirements[i], nil
-			})
-		}
-	}
-	return extendSelector(selector, requirementFuncs...)
+	return SelectorFor(selector, l.LabelSelector, l.Requirements...)
 }
@@ -0,0 +1,110 @@
+package openshift
+
+import (
+	"sync"
+	"time"
+
+	kerrors "k8s.io/kubernetes/pkg/api/errors"
+	"k8s.io/kubernetes/pkg/api/meta"
+	"k8s.io/kubernetes/pkg/runtime"
+	"k8s.io/kubernetes/pkg/watch"
+
+	"github.com/golang/glog"
+)
+
+// PollWatcher is a watch.Interface for a single object,
+// that periodically gets the object, and sends an event each time its resourceVersion changes.
+// It can be used when the object can't be watched (for example because of missing permissions).
+type PollWatcher struct {
+	// GetFunc is the function used to get the object
+	GetFunc func() (runtime.Object, error)
+
+	// PollPeriod is the interval of time at which the object is retrieved
+	PollPeriod time.Duration
+
+	result   chan watch.Event
+	stopChan chan struct{}
+	stopOnce sync.Once
+}
+
+// NewPollWatcher instantiates a new PollWatcher, and starts polling (in a new goroutine)
+// for changes after the given resourceVersion
+func NewPollWatcher(getFunc func() (runtime.Object, error), resourceVersion string, pollPeriod time.Duration) *PollWatcher {
+	w := &PollWatcher{
+		GetFunc:    getFunc,
+		PollPeriod: pollPeriod,
+		result:     make(chan watch.Event),
+		stopChan:   make(chan struct{}),
+	}
+	go w.run(resourceVersion)
+	return w
+}
+
+// Stop stops polling
+// implements the watch.Interface interface
+func (w *PollWatcher) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.stopChan)
+	})
+}
+
+// ResultChan returns the channel over which the events are sent
+// implements the watch.Interface interface
+func (w *PollWatcher) ResultChan() <-chan watch.Event {
+	return w.result
+}
+
+// run polls the object until the watcher is stopped,
+// or until the object is deleted
+func (w *PollWatcher) run(resourceVersion string) {
+	defer close(w.result)
+
+	ticker := time.NewTicker(w.PollPeriod)
+	defer ticker.Stop()
+
+	var lastObject runtime.Object
+	for {
+		select {
+		case <-w.stopChan:
+			return
+		case <-ticker.C:
+		}
+
+		obj, err := w.GetFunc()
+		if err != nil {
+			if kerrors.IsNotFound(err) && lastObject != nil {
+				w.send(watch.Event{Type: watch.Deleted, Object: lastObject})
+				return
+			}
+			glog.V(3).Infof("Failed to poll for changes: %v", err)
+			continue
+		}
+
+		accessor, err := meta.Accessor(obj)
+		if err != nil {
+			glog.V(3).Infof("Failed to get the metadata of %T: %v", obj, err)
+			continue
+		}
+
+		lastObject = obj
+		if accessor.GetResourceVersion() == resourceVersion {
+			continue
+		}
+		resourceVersion = accessor.GetResourceVersion()
+
+		if !w.send(watch.Event{Type: watch.Modified, Object: obj}) {
+			return
+		}
+	}
+}
+
+// send sends the given event, unless the watcher is stopped.
+// Returns false if the watcher has been stopped.
+func (w *PollWatcher) send(event watch.Event) bool {
+	select {
+	case <-w.stopChan:
+		return false
+	case w.result <- event:
+		return true
+	}
+}
@@ -3,8 +3,10 @@ package openshift
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	kapi "k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/unversioned"
 	"k8s.io/kubernetes/pkg/runtime"
 )
 
@@ -23,6 +25,19 @@ type Resource struct {
 	// Status is a string representation of the current status of the resource
 	// (like "added", "modified", "sync", or "deleted" for example)
 	Status string
+
+	// Author is the author of the last change of the resource
+	// (may be nil if unknown)
+	Author *Author
+
+	// Cause is the cause of the latest version of the resource
+	// (for the resources versioned by the cluster, such as the deployment configs - nil otherwise).
+	// It is captured before the resource is exported, because the export clears its status.
+	Cause *Cause
+
+	// ReceivedAt is the time at which the change of the resource has been received
+	// from the cluster (may be zero if unknown)
+	ReceivedAt time.Time
 }
 
 // NewResource instantiates a new Resource with its reference
@@ -30,6 +45,14 @@ type Resource struct {
 // The namespacedName is in the format "namespace/name" if it has a namespace
 // or just "name" otherwise.
 func NewResource(kind, namespacedName string) *Resource {
+	return NewResourceForGroupKind(unversioned.GroupKind{Kind: kind}, namespacedName)
+}
+
+// NewResourceForGroupKind instantiates a new Resource with its reference
+// set to the given (API group and) kind and namespacedName.
+// The namespacedName is in the format "namespace/name" if it has a namespace
+// or just "name" otherwise.
+func NewResourceForGroupKind(gk unversioned.GroupKind, namespacedName string) *Resource {
 	var namespace, name string
 	elems := strings.Split(namespacedName, "/")
 	switch len(elems) {
@@ -42,13 +65,45 @@ func NewResource(kind, namespacedName string) *Resource {
 
 	return &Resource{
 		ObjectReference: &kapi.ObjectReference{
-			Kind:      kind,
-			Namespace: namespace,
-			Name:      name,
+			Kind:       gk.Kind,
+			APIVersion: unversioned.GroupVersion{Group: gk.Group}.String(),
+			Namespace:  namespace,
+			Name:       name,
 		},
 	}
 }
 
+// GroupKind returns the API group and kind of the resource
+// (the group is empty for the legacy kinds)
+func (r *Resource) GroupKind() unversioned.GroupKind {
+	gv, err := unversioned.ParseGroupVersion(r.APIVersion)
+	if err != nil {
+		return unversioned.GroupKind{Kind: r.Kind}
+	}
+	return gv.WithKind(r.Kind).GroupKind()
+}
+
+// referenceFor returns a reference to the given object,
+// with the right API group - even if it can only be found in the scheme
+// (the reference may have been built from the self link, which does not contain the API group)
+func referenceFor(obj runtime.Object) (*kapi.ObjectReference, error) {
+	ref, err := kapi.GetReference(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	gvk, err := kapi.Scheme.ObjectKind(obj)
+	if err != nil {
+		// not registered, let's trust the reference
+		return ref, nil
+	}
+
+	if gv, err := unversioned.ParseGroupVersion(ref.APIVersion); err != nil || gv.Group != gvk.Group {
+		ref.APIVersion = gvk.GroupVersion().String()
+	}
+	return ref, nil
+}
+
 // IsNamespaced returns true if the resource has a namespace
 func (r *Resource) IsNamespaced() bool {
 	return len(r.Namespace) > 0
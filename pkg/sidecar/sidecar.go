@@ -0,0 +1,309 @@
+package sidecar
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/vbehar/openshift-git/pkg/normalize"
+
+	"github.com/ghodss/yaml"
+)
+
+const (
+	// DirSuffix is the suffix of the directory containing the sidecar files of a resource:
+	// the sidecar files of "ConfigMap/my-config.yaml" are stored in "ConfigMap/my-config.files/"
+	DirSuffix = ".files"
+
+	// referencePrefix is the common prefix of the values referencing a sidecar file
+	referencePrefix = "openshift-git:"
+
+	// rawReferencePrefix is the prefix of the values referencing a sidecar file
+	// that contains a raw string (like a properties file or a Dockerfile)
+	rawReferencePrefix = referencePrefix + "file:"
+
+	// encodedReferencePrefix is the prefix of the values referencing a sidecar file
+	// that contains an encoded (JSON or YAML) value (like the objects of a template)
+	encodedReferencePrefix = referencePrefix + "encoded-file:"
+
+	// escapedPrefix is the prefix of the values that start with referencePrefix
+	// but don't reference a sidecar file: they are escaped by Split, and unescaped by Join
+	escapedPrefix = referencePrefix + "escaped:"
+)
+
+// formats are the formats of the resources (which are also the extensions of their files)
+var formats = []string{"yaml", "json"}
+
+// reference is a value referencing a sidecar file, created by Split
+// (so that it is not escaped, unlike the values of the resource)
+type reference string
+
+// File is a sidecar file, containing the payload of a field of a resource
+type File struct {
+	// Name is the name of the file, relative to the sidecar directory
+	Name string
+
+	// Content is the content of the file
+	Content []byte
+}
+
+// DefaultFields returns the fields that may contain large payloads:
+// the data of the configmaps and secrets, the objects of the templates,
+// and the inline Dockerfile of the buildconfigs
+func DefaultFields() []normalize.Field {
+	return []normalize.Field{
+		{Kind: "ConfigMap", Path: "data[*]"},
+		{Kind: "Secret", Path: "data[*]"},
+		{Kind: "Template", Path: "objects"},
+		{Kind: "BuildConfig", Path: "spec.source.dockerfile"},
+	}
+}
+
+// Splitter splits the large payloads of some fields of the resources into sidecar files.
+// A nil Splitter does not split anything.
+type Splitter struct {
+	// Fields are the fields that may be split
+	Fields []normalize.Field
+
+	// Threshold is the size (in bytes) above which a payload is split
+	Threshold int
+}
+
+// NewSplitter instantiates a new Splitter, for the given fields,
+// that splits the payloads larger than the given threshold (in bytes)
+func NewSplitter(threshold int, fields []normalize.Field) *Splitter {
+	return &Splitter{
+		Fields:    fields,
+		Threshold: threshold,
+	}
+}
+
+// Split extracts the large payloads of the given content (in the given format, "json" or "yaml")
+// for the given kind, and returns the content referencing them, with the sidecar files.
+// The values of the content that look like references are escaped, so that Join restores them as-is
+// (even with a nil Splitter).
+// The content is returned as-is (with no files) if there is nothing to split or to escape.
+func (s *Splitter) Split(kind string, content []byte, format string) ([]byte, []File, error) {
+	fields := []normalize.Field{}
+	if s != nil {
+		for _, field := range s.Fields {
+			if field.AppliesTo(kind) {
+				fields = append(fields, field)
+			}
+		}
+	}
+	escape := bytes.Contains(content, []byte(referencePrefix))
+	if len(fields) == 0 && !escape {
+		return content, nil, nil
+	}
+
+	obj := map[string]interface{}{}
+	if err := yaml.Unmarshal(content, &obj); err != nil {
+		return nil, nil, err
+	}
+
+	files := []File{}
+	names := map[string]bool{}
+	for _, field := range fields {
+		err := normalize.TransformWithKey(obj, field.Path, func(key string, value interface{}) (interface{}, error) {
+			var (
+				data   []byte
+				prefix string
+				ext    string
+			)
+			switch v := value.(type) {
+			case nil, reference:
+				return value, nil
+			case string:
+				data, prefix = []byte(v), rawReferencePrefix
+			default:
+				encoded, err := encodeValue(v, format)
+				if err != nil {
+					return nil, err
+				}
+				data, prefix, ext = encoded, encodedReferencePrefix, "."+format
+			}
+			if len(data) <= s.Threshold {
+				return value, nil
+			}
+
+			name := uniqueName(sanitizeName(key), ext, names)
+			files = append(files, File{Name: name, Content: data})
+			return reference(prefix + name), nil
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if len(files) == 0 && !escape {
+		return content, nil, nil
+	}
+	escapeValues(obj)
+
+	result, err := normalize.Encode(obj, format)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(files) == 0 {
+		files = nil
+	}
+	return result, files, nil
+}
+
+// Join replaces all the references to sidecar files in the given content
+// (in the given format, "json" or "yaml") with the content of the files,
+// read with the given function - and unescapes the values escaped by Split.
+// The content is returned as-is if it does not reference any sidecar file.
+func Join(content []byte, format string, readFile func(name string) ([]byte, error)) ([]byte, error) {
+	if !bytes.Contains(content, []byte(referencePrefix)) {
+		return content, nil
+	}
+
+	obj := map[string]interface{}{}
+	if err := yaml.Unmarshal(content, &obj); err != nil {
+		return nil, err
+	}
+
+	var join func(value interface{}) (interface{}, error)
+	join = func(value interface{}) (interface{}, error) {
+		switch v := value.(type) {
+		case string:
+			return joinValue(v, readFile)
+		case map[string]interface{}:
+			for key, child := range v {
+				result, err := join(child)
+				if err != nil {
+					return nil, err
+				}
+				v[key] = result
+			}
+		case []interface{}:
+			for i, child := range v {
+				result, err := join(child)
+				if err != nil {
+					return nil, err
+				}
+				v[i] = result
+			}
+		}
+		return value, nil
+	}
+	if _, err := join(obj); err != nil {
+		return nil, err
+	}
+
+	return normalize.Encode(obj, format)
+}
+
+// IsSidecarDir returns true if the directory at the given path contains the sidecar files of a resource:
+// its name ends with DirSuffix, and the file of the resource is next to it
+// (like "ConfigMap/my-config.yaml" for "ConfigMap/my-config.files"),
+// so that the other directories (like a label value ending with DirSuffix) are not mistaken for it.
+func IsSidecarDir(path string) bool {
+	if !strings.HasSuffix(path, DirSuffix) {
+		return false
+	}
+	base := strings.TrimSuffix(path, DirSuffix)
+	for _, format := range formats {
+		if info, err := os.Stat(base + "." + format); err == nil && !info.IsDir() {
+			return true
+		}
+	}
+	return false
+}
+
+// joinValue returns the value referenced by the given value,
+// or the given value itself if it is not a reference to a sidecar file
+func joinValue(value string, readFile func(name string) ([]byte, error)) (interface{}, error) {
+	var name string
+	encoded := false
+	switch {
+	case strings.HasPrefix(value, rawReferencePrefix):
+		name = strings.TrimPrefix(value, rawReferencePrefix)
+	case strings.HasPrefix(value, encodedReferencePrefix):
+		name = strings.TrimPrefix(value, encodedReferencePrefix)
+		encoded = true
+	case strings.HasPrefix(value, escapedPrefix):
+		return strings.TrimPrefix(value, escapedPrefix), nil
+	default:
+		return value, nil
+	}
+
+	if len(name) == 0 || filepath.Base(name) != name || name == "." || name == ".." {
+		return nil, fmt.Errorf("Invalid sidecar file name '%s'", name)
+	}
+
+	data, err := readFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if !encoded {
+		return string(data), nil
+	}
+	var result interface{}
+	if err := yaml.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("Invalid sidecar file '%s': %v", name, err)
+	}
+	return result, nil
+}
+
+// escapeValues escapes the string values of the given (generic) value that start with referencePrefix,
+// and replaces the references with plain strings
+func escapeValues(value interface{}) interface{} {
+	switch v := value.(type) {
+	case reference:
+		return string(v)
+	case string:
+		if strings.HasPrefix(v, referencePrefix) {
+			return escapedPrefix + v
+		}
+	case map[string]interface{}:
+		for key, child := range v {
+			v[key] = escapeValues(child)
+		}
+	case []interface{}:
+		for i, child := range v {
+			v[i] = escapeValues(child)
+		}
+	}
+	return value
+}
+
+// encodeValue encodes the given (generic) value in the given format ("json" or "yaml")
+func encodeValue(value interface{}, format string) ([]byte, error) {
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(value, "", "    ")
+		if err != nil {
+			return nil, err
+		}
+		return append(data, '\n'), nil
+	default:
+		return yaml.Marshal(value)
+	}
+}
+
+// sanitizeName returns a valid file name for the given key
+func sanitizeName(key string) string {
+	name := strings.NewReplacer("/", "_", "\\", "_").Replace(key)
+	if len(name) == 0 || name == "." || name == ".." {
+		return "_"
+	}
+	return name
+}
+
+// uniqueName returns a name (with the given extension) that has not been used yet,
+// and records it in the given used names
+func uniqueName(name, ext string, used map[string]bool) string {
+	result := name + ext
+	for i := 2; used[result]; i++ {
+		result = fmt.Sprintf("%s-%d%s", name, i, ext)
+	}
+	used[result] = true
+	return result
+}
@@ -0,0 +1,172 @@
+package sidecar
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		kind            string
+		content         string
+		format          string
+		expectedContent string
+		expectedFiles   []File
+	}{
+		{
+			kind:            "ConfigMap",
+			content:         "data:\n  small: abc\n",
+			format:          "yaml",
+			expectedContent: "data:\n  small: abc\n",
+			expectedFiles:   nil,
+		},
+		{
+			kind:            "Service",
+			content:         "data:\n  large: abcdefghijklmnop\n",
+			format:          "yaml",
+			expectedContent: "data:\n  large: abcdefghijklmnop\n",
+			expectedFiles:   nil,
+		},
+		{
+			kind:            "ConfigMap",
+			content:         "data:\n  app.properties: |\n    key=value\n    other=value\n  small: abc\n",
+			format:          "yaml",
+			expectedContent: "data:\n  app.properties: openshift-git:file:app.properties\n  small: abc\n",
+			expectedFiles:   []File{{Name: "app.properties", Content: []byte("key=value\nother=value\n")}},
+		},
+		{
+			kind:            "Template",
+			content:         `{"objects": [{"kind": "Service", "metadata": {"name": "foo"}}]}`,
+			format:          "json",
+			expectedContent: "{\n    \"objects\": \"openshift-git:encoded-file:objects.json\"\n}\n",
+			expectedFiles:   []File{{Name: "objects.json", Content: []byte("[\n    {\n        \"kind\": \"Service\",\n        \"metadata\": {\n            \"name\": \"foo\"\n        }\n    }\n]\n")}},
+		},
+		{
+			kind:            "BuildConfig",
+			content:         "spec:\n  source:\n    dockerfile: |\n      FROM centos\n      RUN yum update\n",
+			format:          "yaml",
+			expectedContent: "spec:\n  source:\n    dockerfile: openshift-git:file:dockerfile\n",
+			expectedFiles:   []File{{Name: "dockerfile", Content: []byte("FROM centos\nRUN yum update\n")}},
+		},
+	}
+
+	splitter := NewSplitter(10, DefaultFields())
+	for count, test := range tests {
+		content, files, err := splitter.Split(test.kind, []byte(test.content), test.format)
+		if err != nil {
+			t.Errorf("Test[%d] Failed: %v", count, err)
+			continue
+		}
+		if string(content) != test.expectedContent {
+			t.Errorf("Test[%d] Failed: Expected content '%s' but got '%s'", count, test.expectedContent, string(content))
+		}
+		if !reflect.DeepEqual(files, test.expectedFiles) {
+			t.Errorf("Test[%d] Failed: Expected files %v but got %v", count, test.expectedFiles, files)
+		}
+	}
+}
+
+func TestSplitJoin(t *testing.T) {
+	content := []byte("data:\n  a: |\n    first payload\n  b/c: second payload\nkind: ConfigMap\n")
+
+	split, files, err := NewSplitter(0, DefaultFields()).Split("ConfigMap", content, "yaml")
+	if err != nil {
+		t.Fatalf("Failed to split: %v", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("Expected 2 files but got %v", files)
+	}
+
+	joined, err := Join(split, "yaml", func(name string) ([]byte, error) {
+		for _, file := range files {
+			if file.Name == name {
+				return file.Content, nil
+			}
+		}
+		return nil, fmt.Errorf("File %s not found", name)
+	})
+	if err != nil {
+		t.Fatalf("Failed to join: %v", err)
+	}
+	if string(joined) != string(content) {
+		t.Errorf("Expected '%s' but got '%s'", string(content), string(joined))
+	}
+}
+
+func TestSplitJoinEscaped(t *testing.T) {
+	content := []byte("data:\n  a: openshift-git:file:a\n  b: openshift-git:escaped:b\nkind: ConfigMap\nmetadata:\n  annotations:\n    note: openshift-git:encoded-file:note\n")
+
+	for count, splitter := range []*Splitter{nil, NewSplitter(1000, DefaultFields())} {
+		split, files, err := splitter.Split("ConfigMap", content, "yaml")
+		if err != nil {
+			t.Errorf("Test[%d] Failed to split: %v", count, err)
+			continue
+		}
+		if files != nil {
+			t.Errorf("Test[%d] Failed: Expected no files but got %v", count, files)
+		}
+
+		joined, err := Join(split, "yaml", func(name string) ([]byte, error) {
+			return nil, fmt.Errorf("Unexpected read of the sidecar file %s", name)
+		})
+		if err != nil {
+			t.Errorf("Test[%d] Failed to join: %v", count, err)
+			continue
+		}
+		if string(joined) != string(content) {
+			t.Errorf("Test[%d] Failed: Expected '%s' but got '%s'", count, string(content), string(joined))
+		}
+	}
+}
+
+func TestJoinInvalidName(t *testing.T) {
+	_, err := Join([]byte("data:\n  a: openshift-git:file:../../secret\n"), "yaml", func(name string) ([]byte, error) {
+		return []byte("oops"), nil
+	})
+	if err == nil {
+		t.Errorf("Expected an error for a sidecar file outside of the sidecar directory")
+	}
+}
+
+func TestNilSplitter(t *testing.T) {
+	var splitter *Splitter
+	content, files, err := splitter.Split("ConfigMap", []byte("data:\n  a: b\n"), "yaml")
+	if err != nil || string(content) != "data:\n  a: b\n" || files != nil {
+		t.Errorf("Expected the content as-is but got '%s' %v (%v)", string(content), files, err)
+	}
+}
+
+func TestIsSidecarDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sidecar-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, path := range []string{"ConfigMap/config.files", "web.files/ConfigMap"} {
+		if err := os.MkdirAll(filepath.Join(dir, path), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "ConfigMap", "config.yaml"), []byte("kind: ConfigMap\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path     string
+		expected bool
+	}{
+		{path: "ConfigMap/config.files", expected: true},
+		{path: "ConfigMap", expected: false},
+		{path: "web.files", expected: false},
+	}
+	for _, test := range tests {
+		if isSidecarDir := IsSidecarDir(filepath.Join(dir, test.path)); isSidecarDir != test.expected {
+			t.Errorf("Expected %s to be a sidecar directory: %v, but got %v", test.path, test.expected, isSidecarDir)
+		}
+	}
+}
@@ -0,0 +1,543 @@
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/vbehar/openshift-git/pkg/layout"
+	"github.com/vbehar/openshift-git/pkg/openshift"
+	"github.com/vbehar/openshift-git/pkg/sidecar"
+
+	"k8s.io/kubernetes/pkg/api/unversioned"
+
+	"github.com/golang/glog"
+)
+
+// DirectoryStore implements the Store interface
+var _ Store = &DirectoryStore{}
+
+// DirectoryStore is a Store that mirrors the resources as plain files in a directory,
+// without any version control - so that they can be versioned with another tool.
+// The changes are applied as soon as the resources are written (or deleted):
+// there is nothing to commit, pull or push.
+// Timestamped snapshots of the directory can be created in the SnapshotsDir.
+type DirectoryStore struct {
+	Paths
+
+	// SnapshotsDir is the path of the directory in which the snapshots are created
+	// (see CreateSnapshot). Defaults to a "snapshots" directory in the MetadataDir.
+	SnapshotsDir string
+
+	// index is the in-memory index of the resources stored in the directory
+	index *Index
+}
+
+// NewDirectoryStore instantiates a new DirectoryStore at the given path,
+// creating the directory if it does not exist.
+func NewDirectoryStore(dir string) (*DirectoryStore, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+
+	l, err := layout.New(layout.DefaultTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DirectoryStore{
+		Paths: Paths{
+			Dir:    dir,
+			Layout: l,
+		},
+		SnapshotsDir: filepath.Join(dir, MetadataDir, "snapshots"),
+		index:        NewIndex(),
+	}, nil
+}
+
+// SetLayout sets the layout of the resources in the directory (see layout.ForTemplate)
+func (s *DirectoryStore) SetLayout(template string, groupLayout bool) error {
+	l, err := layout.ForTemplate(template, groupLayout)
+	if err != nil {
+		return err
+	}
+	s.Layout = l
+
+	// the kinds and paths of the resources depend on the layout
+	s.index.Invalidate()
+	return nil
+}
+
+// String returns the path of the directory
+func (s *DirectoryStore) String() string {
+	return s.Dir
+}
+
+// Resource returns the given resource, stored in the given format
+func (s *DirectoryStore) Resource(resource *openshift.Resource, format string) Resource {
+	r := &directoryResource{
+		store:    s,
+		resource: resource,
+		format:   format,
+		path:     s.PathForResource(resource, format),
+	}
+
+	if s.Layout.UsesLabels() {
+		// the labels may have changed since the resource was stored
+		previousPath, _, err := s.indexedFile(resource.GroupKind(), resource.NamespacedName(), format)
+		if err != nil {
+			glog.Warningf("Failed to find the previous path of %s: %v", resource, err)
+		} else if len(previousPath) > 0 && previousPath != r.path {
+			r.previousPath = previousPath
+		}
+	}
+
+	return r
+}
+
+// NewBatch returns a new (empty) batch.
+// The changes are applied as soon as they are written, so committing the batch only resets it.
+func (s *DirectoryStore) NewBatch() Batch {
+	return &directoryBatch{}
+}
+
+// KeyListFuncForGroupKind returns a ListKeys function, that implements the cache.KeyLister interface
+// The keys are read from the in-memory index of the resources,
+// which is built by walking the FS the first time.
+func (s *DirectoryStore) KeyListFuncForGroupKind(gk unversioned.GroupKind) func() []string {
+	return func() []string {
+		if err := s.buildIndex(); err != nil {
+			glog.Errorf("Failed to walk FS %s for kind %s: %v", s.Dir, gk.String(), err)
+			return []string{}
+		}
+
+		keys := s.index.Keys(s.IndexKind(gk))
+		glog.V(2).Infof("Found %d local keys for %s", len(keys), gk.String())
+		return keys
+	}
+}
+
+// KeyGetFuncForGroupKindAndFormat returns a GetByKey function, implements the cache.KeyGetter interface
+// The object is looked up in the in-memory index of the resources.
+func (s *DirectoryStore) KeyGetFuncForGroupKindAndFormat(gk unversioned.GroupKind, format string) func(key string) (interface{}, bool, error) {
+	return func(key string) (interface{}, bool, error) {
+		path, _, err := s.indexedFile(gk, key, format)
+		if err != nil {
+			return "", false, err
+		}
+		if len(path) == 0 {
+			glog.V(3).Infof("key %s for kind %s does not exists", key, gk.String())
+			return "", false, nil
+		}
+
+		resource := openshift.NewResourceForGroupKind(gk, key)
+		glog.V(4).Infof("Found %v for %s %s at %s", resource, gk.String(), key, path)
+		return *resource, true, nil
+	}
+}
+
+// LoadResourceVersions returns the last resource versions (per kind)
+// persisted in the MetadataDir for the given scope
+func (s *DirectoryStore) LoadResourceVersions(scope string) (map[string]string, error) {
+	return LoadResourceVersions(s.metadataPath(ResourceVersionsFile), scope)
+}
+
+// SaveResourceVersions persists the given resource versions (per kind) for the given scope,
+// in the MetadataDir
+func (s *DirectoryStore) SaveResourceVersions(scope string, versions map[string]string) error {
+	return SaveResourceVersions(s.metadataPath(ResourceVersionsFile), scope, versions)
+}
+
+// CreateSnapshot copies the content of the directory into a new directory of the SnapshotsDir,
+// named after the given time and period (see SnapshotName).
+// The files are hard-linked when possible: they are never modified in place, only replaced.
+// Returns the name of the snapshot, or an empty string if it already exists.
+func (s *DirectoryStore) CreateSnapshot(t time.Time, period time.Duration) (string, error) {
+	name := SnapshotName(t, period)
+	target := filepath.Join(s.SnapshotsDir, name)
+	if _, err := os.Stat(target); err == nil {
+		glog.V(2).Infof("Snapshot %s already exists", name)
+		return "", nil
+	}
+
+	// copy to a temp directory first, so that a snapshot is never left half-copied
+	tmpTarget := target + ".tmp"
+	if err := os.RemoveAll(tmpTarget); err != nil {
+		return "", err
+	}
+	err := filepath.Walk(s.Dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && s.isSnapshotsDir(path) {
+			return filepath.SkipDir
+		}
+		if info.IsDir() && (info.Name() == ".git" || info.Name() == MetadataDir) {
+			return filepath.SkipDir
+		}
+
+		rel, err := filepath.Rel(s.Dir, path)
+		if err != nil {
+			return err
+		}
+		dest := filepath.Join(tmpTarget, rel)
+		if info.IsDir() {
+			return os.MkdirAll(dest, os.ModePerm)
+		}
+		return linkOrCopyFile(path, dest)
+	})
+	if err != nil {
+		os.RemoveAll(tmpTarget)
+		return "", err
+	}
+
+	if err := os.Rename(tmpTarget, target); err != nil {
+		os.RemoveAll(tmpTarget)
+		return "", err
+	}
+	return name, nil
+}
+
+// PruneSnapshots deletes the snapshots of the SnapshotsDir created before the given time.
+// Returns the names of the deleted snapshots.
+func (s *DirectoryStore) PruneSnapshots(before time.Time) ([]string, error) {
+	infos, err := ioutil.ReadDir(s.SnapshotsDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	deleted := []string{}
+	for _, info := range infos {
+		if !info.IsDir() {
+			continue
+		}
+		t, ok := ParseSnapshotName(info.Name())
+		if !ok || !t.Before(before) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(s.SnapshotsDir, info.Name())); err != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, info.Name())
+	}
+	return deleted, nil
+}
+
+// Pull does nothing: the directory is not shared
+func (s *DirectoryStore) Pull() error {
+	return nil
+}
+
+// Push does nothing: the directory is not shared
+func (s *DirectoryStore) Push() error {
+	return nil
+}
+
+// StopPush does nothing: there is nothing to push
+func (s *DirectoryStore) StopPush() {}
+
+// Close does nothing: the changes have already been applied
+func (s *DirectoryStore) Close() error {
+	return nil
+}
+
+// CheckWritable returns an error if the directory can't be written to
+func (s *DirectoryStore) CheckWritable() error {
+	dir := s.metadataPath("")
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return fmt.Errorf("Directory %s is not writable: %v", s.Dir, err)
+	}
+	file, err := ioutil.TempFile(dir, "openshift-git-check-")
+	if err != nil {
+		return fmt.Errorf("Directory %s is not writable: %v", s.Dir, err)
+	}
+	file.Close()
+	return os.Remove(file.Name())
+}
+
+// WalkResources walks the FS and calls the given function
+// for each resource stored in the directory - see Paths.WalkResources.
+// The SnapshotsDir is ignored, if it is inside the directory.
+func (s *DirectoryStore) WalkResources(walkFn func(path string, resource *openshift.Resource) error) error {
+	return s.walkResources(s.isSnapshotsDir, walkFn)
+}
+
+// isSnapshotsDir returns true if the given path is the SnapshotsDir
+func (s *DirectoryStore) isSnapshotsDir(path string) bool {
+	snapshotsDir, err := filepath.Abs(s.SnapshotsDir)
+	if err != nil {
+		return filepath.Clean(path) == filepath.Clean(s.SnapshotsDir)
+	}
+	absPath, err := filepath.Abs(path)
+	return err == nil && absPath == snapshotsDir
+}
+
+// metadataPath returns the path of the given file in the MetadataDir
+func (s *DirectoryStore) metadataPath(name string) string {
+	return filepath.Join(s.Dir, MetadataDir, name)
+}
+
+// buildIndex builds the index of the resources of the directory, if it has not been built yet
+func (s *DirectoryStore) buildIndex() error {
+	return s.index.Build(func(add func(kind, key, path, hash string)) error {
+		count := 0
+		err := s.WalkResources(func(path string, resource *openshift.Resource) error {
+			hash, err := FileHash(path)
+			if err != nil {
+				return err
+			}
+			add(s.IndexKind(resource.GroupKind()), resource.NamespacedName(), path, hash)
+			count++
+			return nil
+		})
+		if err == nil {
+			glog.V(1).Infof("Indexed %d resources in %s", count, s.Dir)
+		}
+		return err
+	})
+}
+
+// indexedFile returns the path and the content hash of the indexed file
+// of the resource of the given kind and key, in the given format
+// - or empty strings if there is none.
+func (s *DirectoryStore) indexedFile(gk unversioned.GroupKind, key, format string) (string, string, error) {
+	if err := s.buildIndex(); err != nil {
+		return "", "", err
+	}
+	path, hash := s.index.File(s.IndexKind(gk), key, format)
+	return path, hash, nil
+}
+
+// directoryResource is a resource in a DirectoryStore
+type directoryResource struct {
+	// store is the store in which the resource is stored
+	store *DirectoryStore
+
+	// resource is the underlying resource
+	resource *openshift.Resource
+
+	// format is the storage format of the resource (like YAML or JSON)
+	format string
+
+	// path is the full absolute path on the filesystem where the resource is stored
+	path string
+
+	// previousPath is the path where the resource was previously stored,
+	// if it has moved (when the layout uses labels) - or an empty string
+	previousPath string
+
+	// file is the temp file in which the resource is written, before replacing its file
+	file *os.File
+
+	// content is the content written to the file
+	content bytes.Buffer
+
+	// changed is true once the resource has been written or deleted
+	changed bool
+}
+
+// IsUnchanged returns true if the resource is already stored at its path,
+// with the given content hash (see ContentHash) - so that it does not need to be written again.
+func (r *directoryResource) IsUnchanged(hash string) bool {
+	if len(r.previousPath) > 0 {
+		// it needs to be moved
+		return false
+	}
+	path, indexedHash, err := r.store.indexedFile(r.resource.GroupKind(), r.resource.NamespacedName(), r.format)
+	if err != nil {
+		glog.Warningf("Failed to find %s in the index: %v", r.resource, err)
+		return false
+	}
+	return path == r.path && len(indexedHash) > 0 && indexedHash == hash
+}
+
+// Open opens the resource so that it could then be used as an io.Writer
+// It then needs to be closed at the end, to replace the file of the resource.
+// The existing sidecar files of the resource are removed.
+func (r *directoryResource) Open() error {
+	if len(r.previousPath) > 0 {
+		if err := removeResourceFiles(r.previousPath); err != nil {
+			return err
+		}
+		r.store.index.Remove(r.store.IndexKind(r.resource.GroupKind()), r.resource.NamespacedName(), r.previousPath)
+	}
+
+	if err := os.RemoveAll(SidecarDir(r.path)); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.path), os.ModePerm); err != nil {
+		return err
+	}
+
+	// the temp files are kept out of the layout, so that they are never read as resources
+	tmpDir := r.store.metadataPath("tmp")
+	if err := os.MkdirAll(tmpDir, os.ModePerm); err != nil {
+		return err
+	}
+
+	r.content.Reset()
+
+	var err error
+	r.file, err = ioutil.TempFile(tmpDir, filepath.Base(r.path)+".")
+	return err
+}
+
+// Write writes some data to the resource
+// implements the io.Writer interface
+func (r *directoryResource) Write(p []byte) (n int, err error) {
+	n, err = r.file.Write(p)
+	r.content.Write(p[:n])
+	return n, err
+}
+
+// Close closes the temp file, replaces the file of the resource with it,
+// and records it in the index of the store
+// implements the io.Closer interface
+func (r *directoryResource) Close() error {
+	tmpPath := r.file.Name()
+	if err := r.file.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Chmod(tmpPath, 0644); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, r.path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	r.changed = true
+	r.store.index.Add(r.store.IndexKind(r.resource.GroupKind()), r.resource.NamespacedName(), r.path, ContentHash(r.content.Bytes(), nil))
+	return nil
+}
+
+// WriteSidecarFiles writes the given sidecar files of the resource,
+// in the sidecar directory next to the resource's file
+func (r *directoryResource) WriteSidecarFiles(files []sidecar.File) error {
+	if len(files) == 0 {
+		return nil
+	}
+
+	dir := SidecarDir(r.path)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, file.Name), file.Content, 0644); err != nil {
+			return err
+		}
+	}
+
+	r.store.index.Add(r.store.IndexKind(r.resource.GroupKind()), r.resource.NamespacedName(), r.path, ContentHash(r.content.Bytes(), files))
+	return nil
+}
+
+// Delete deletes the resource (and its sidecar files) from the filesystem
+// does not complains if the file does not exists
+func (r *directoryResource) Delete() error {
+	if len(r.previousPath) > 0 {
+		// the resource is still stored at its previous path
+		r.path = r.previousPath
+		r.previousPath = ""
+	}
+
+	_, err := os.Stat(r.path)
+	exists := err == nil
+
+	if err := removeResourceFiles(r.path); err != nil {
+		return err
+	}
+	r.store.index.Remove(r.store.IndexKind(r.resource.GroupKind()), r.resource.NamespacedName(), r.path)
+
+	r.changed = exists
+	return nil
+}
+
+// Commit does nothing: the changes have already been applied
+func (r *directoryResource) Commit() error {
+	return nil
+}
+
+// directoryBatch is a Batch of a DirectoryStore, which only counts the changes:
+// they have already been applied
+type directoryBatch struct {
+	// count is the number of changed resources
+	count int
+}
+
+// Add counts the given resource, if it has been changed
+func (b *directoryBatch) Add(resource Resource) error {
+	r, ok := resource.(*directoryResource)
+	if !ok {
+		return fmt.Errorf("Can't add %T to a batch of a directory", resource)
+	}
+	if r.changed {
+		b.count++
+	}
+	return nil
+}
+
+// Len returns the number of resources changed in the batch
+func (b *directoryBatch) Len() int {
+	return b.count
+}
+
+// Commit resets the batch: the changes have already been applied
+func (b *directoryBatch) Commit(title string) error {
+	glog.V(2).Infof("%s: %d changes", title, b.count)
+	b.count = 0
+	return nil
+}
+
+// removeResourceFiles removes the file of a resource and its sidecar files
+// does not complains if they don't exist
+func removeResourceFiles(path string) error {
+	if err := os.RemoveAll(SidecarDir(path)); err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// linkOrCopyFile hard-links the given file to the given destination,
+// or copies it if it can't be linked (if they are on different filesystems for example)
+func linkOrCopyFile(src, dest string) error {
+	if err := os.Link(src, dest); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,235 @@
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/vbehar/openshift-git/pkg/openshift"
+	"github.com/vbehar/openshift-git/pkg/sidecar"
+
+	"k8s.io/kubernetes/pkg/api/unversioned"
+)
+
+// newTestDirectoryStore instantiates a new DirectoryStore in a temp dir
+func newTestDirectoryStore(t *testing.T) *DirectoryStore {
+	dir, err := ioutil.TempDir("", "directory-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewDirectoryStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// writeResource writes the given content and sidecar files of the given resource to the given store,
+// and adds it to the given batch (if not nil)
+func writeResource(t *testing.T, s Store, resource *openshift.Resource, content string, files []sidecar.File, batch Batch) Resource {
+	r := s.Resource(resource, "yaml")
+	if err := r.Open(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.WriteSidecarFiles(files); err != nil {
+		t.Fatal(err)
+	}
+	if batch != nil {
+		if err := batch.Add(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return r
+}
+
+// walkedPaths returns the paths (relative to the directory) of the resources walked in the given store
+func walkedPaths(t *testing.T, s *DirectoryStore) []string {
+	paths := []string{}
+	err := s.WalkResources(func(path string, resource *openshift.Resource) error {
+		rel, err := filepath.Rel(s.Dir, path)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestDirectoryStoreWriteAndDelete(t *testing.T) {
+	s := newTestDirectoryStore(t)
+	defer os.RemoveAll(s.Dir)
+
+	gk := unversioned.GroupKind{Kind: "Service"}
+	content := "kind: Service\nmetadata:\n  name: a\n"
+	batch := s.NewBatch()
+	writeResource(t, s, openshift.NewResource("Service", "foo/a"), content, nil, batch)
+	writeResource(t, s, openshift.NewResource("Namespace", "foo"), "kind: Namespace\n", nil, batch)
+	if batch.Len() != 2 {
+		t.Errorf("Expected 2 changes in the batch, but got %d", batch.Len())
+	}
+	if err := batch.Commit("Test"); err != nil || batch.Len() != 0 {
+		t.Errorf("Expected the batch to be reset, but got %d changes (%v)", batch.Len(), err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(s.Dir, "Namespace", "foo", "Service", "a.yaml"))
+	if err != nil || string(data) != content {
+		t.Errorf("Expected the file of the service to contain '%s', but got '%s' (%v)", content, string(data), err)
+	}
+	if paths := walkedPaths(t, s); !reflect.DeepEqual(paths, []string{"Namespace/foo.yaml", "Namespace/foo/Service/a.yaml"}) {
+		t.Errorf("Expected the namespace and the service to be walked, but got %v", paths)
+	}
+	if keys := s.KeyListFuncForGroupKind(gk)(); !reflect.DeepEqual(keys, []string{"foo/a"}) {
+		t.Errorf("Expected the key of the service, but got %v", keys)
+	}
+	if _, exists, err := s.KeyGetFuncForGroupKindAndFormat(gk, "yaml")("foo/a"); !exists || err != nil {
+		t.Errorf("Expected the service to exist, but got %v (%v)", exists, err)
+	}
+	if !s.Resource(openshift.NewResource("Service", "foo/a"), "yaml").IsUnchanged(ContentHash([]byte(content), nil)) {
+		t.Errorf("Expected the service to be unchanged with the same content")
+	}
+	if s.Resource(openshift.NewResource("Service", "foo/a"), "yaml").IsUnchanged(ContentHash([]byte("kind: Service\n"), nil)) {
+		t.Errorf("Expected the service to be changed with another content")
+	}
+
+	r := s.Resource(openshift.NewResource("Service", "foo/a"), "yaml")
+	if err := r.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if err := batch.Add(r); err != nil || batch.Len() != 1 {
+		t.Errorf("Expected the deletion to be counted in the batch, but got %d changes (%v)", batch.Len(), err)
+	}
+	if _, err := os.Stat(filepath.Join(s.Dir, "Namespace", "foo", "Service", "a.yaml")); !os.IsNotExist(err) {
+		t.Errorf("Expected the file of the service to be deleted, but got %v", err)
+	}
+	if keys := s.KeyListFuncForGroupKind(gk)(); len(keys) != 0 {
+		t.Errorf("Expected no keys after the deletion, but got %v", keys)
+	}
+
+	// deleting a resource which does not exist is not a change
+	r = s.Resource(openshift.NewResource("Service", "foo/b"), "yaml")
+	if err := r.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if err := batch.Add(r); err != nil || batch.Len() != 1 {
+		t.Errorf("Expected the deletion of a missing resource not to be counted, but got %d changes (%v)", batch.Len(), err)
+	}
+}
+
+func TestDirectoryStoreSidecarFiles(t *testing.T) {
+	s := newTestDirectoryStore(t)
+	defer os.RemoveAll(s.Dir)
+
+	resource := openshift.NewResource("ConfigMap", "foo/config")
+	content := "data:\n  app.properties: openshift-git:file:app.properties\nkind: ConfigMap\n"
+	files := []sidecar.File{{Name: "app.properties", Content: []byte("key=value\n")}}
+	writeResource(t, s, resource, content, files, nil)
+
+	path := filepath.Join(s.Dir, "Namespace", "foo", "ConfigMap", "config.yaml")
+	joined, err := ReadResourceFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "data:\n  app.properties: |\n    key=value\nkind: ConfigMap\n"; string(joined) != expected {
+		t.Errorf("Expected the sidecar files to be joined into '%s', but got '%s'", expected, string(joined))
+	}
+	if paths := walkedPaths(t, s); !reflect.DeepEqual(paths, []string{"Namespace/foo/ConfigMap/config.yaml"}) {
+		t.Errorf("Expected the sidecar files not to be walked, but got %v", paths)
+	}
+	if !s.Resource(resource, "yaml").IsUnchanged(ContentHash([]byte(content), files)) {
+		t.Errorf("Expected the configmap to be unchanged with the same content and sidecar files")
+	}
+
+	// the sidecar files are replaced when the resource is written again
+	writeResource(t, s, resource, "data:\n  app.properties: key=value\nkind: ConfigMap\n", nil, nil)
+	if _, err := os.Stat(SidecarDir(path)); !os.IsNotExist(err) {
+		t.Errorf("Expected the sidecar files to be removed, but got %v", err)
+	}
+
+	writeResource(t, s, resource, content, files, nil)
+	if err := s.Resource(resource, "yaml").Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(SidecarDir(path)); !os.IsNotExist(err) {
+		t.Errorf("Expected the sidecar files to be deleted with the resource, but got %v", err)
+	}
+}
+
+func TestDirectoryStoreSnapshots(t *testing.T) {
+	s := newTestDirectoryStore(t)
+	defer os.RemoveAll(s.Dir)
+
+	// the snapshots of the resources without namespace match this layout,
+	// so they would be walked as resources if the snapshots dir was not skipped
+	if err := s.SetLayout("[{namespace}/{label:app}/]{kind}/{name}", false); err != nil {
+		t.Fatal(err)
+	}
+	s.SnapshotsDir = filepath.Join(s.Dir, "snapshots")
+
+	writeResource(t, s, openshift.NewResource("Namespace", "foo"), "kind: Namespace\n", nil, nil)
+
+	day := 24 * time.Hour
+	now := time.Date(2016, 6, 1, 10, 0, 0, 0, time.UTC)
+	name, err := s.CreateSnapshot(now, day)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "2016-06-01" {
+		t.Errorf("Expected the snapshot 2016-06-01, but got '%s'", name)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(s.SnapshotsDir, name, "Namespace", "foo.yaml"))
+	if err != nil || string(data) != "kind: Namespace\n" {
+		t.Errorf("Expected the snapshot to contain the namespace, but got '%s' (%v)", string(data), err)
+	}
+	if name, err := s.CreateSnapshot(now.Add(time.Hour), day); err != nil || len(name) > 0 {
+		t.Errorf("Expected the snapshot of the same period not to be created again, but got '%s' (%v)", name, err)
+	}
+	if _, err := s.CreateSnapshot(now.Add(day), day); err != nil {
+		t.Fatal(err)
+	}
+
+	if paths := walkedPaths(t, s); !reflect.DeepEqual(paths, []string{"Namespace/foo.yaml"}) {
+		t.Errorf("Expected the snapshots not to be walked, but got %v", paths)
+	}
+	if keys := s.KeyListFuncForGroupKind(unversioned.GroupKind{Kind: "Namespace"})(); !reflect.DeepEqual(keys, []string{"foo"}) {
+		t.Errorf("Expected the snapshots not to be indexed, but got %v", keys)
+	}
+
+	deleted, err := s.PruneSnapshots(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(deleted, []string{"2016-06-01"}) {
+		t.Errorf("Expected the snapshot 2016-06-01 to be deleted, but got %v", deleted)
+	}
+	if _, err := os.Stat(filepath.Join(s.SnapshotsDir, "2016-06-02")); err != nil {
+		t.Errorf("Expected the snapshot 2016-06-02 to be kept, but got %v", err)
+	}
+}
+
+func TestContentHash(t *testing.T) {
+	// the git blob OIDs of the contents (see "git hash-object")
+	if hash := ContentHash([]byte("kind: Service\n"), nil); hash != "4fffa8482c3e834f679b98fddaab47f3c8679d0a" {
+		t.Errorf("Expected the blob OID of the content, but got '%s'", hash)
+	}
+
+	files := []sidecar.File{{Name: "app.properties", Content: []byte("key=value\n")}}
+	expected := "4fffa8482c3e834f679b98fddaab47f3c8679d0a app.properties:7b89edbafe4de7e062c3fef0050fd6b3f9af4cf7"
+	if hash := ContentHash([]byte("kind: Service\n"), files); hash != expected {
+		t.Errorf("Expected the hash '%s', but got '%s'", expected, hash)
+	}
+}
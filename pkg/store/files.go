@@ -0,0 +1,212 @@
+package store
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/vbehar/openshift-git/pkg/gitobj"
+	"github.com/vbehar/openshift-git/pkg/layout"
+	"github.com/vbehar/openshift-git/pkg/openshift"
+	"github.com/vbehar/openshift-git/pkg/sidecar"
+
+	"k8s.io/kubernetes/pkg/api/meta"
+	"k8s.io/kubernetes/pkg/api/unversioned"
+)
+
+// MetadataDir is the name of the directory in which the stores keep their own files
+// (like the resource versions), ignored when walking the resources
+const MetadataDir = ".openshift-git"
+
+// Paths maps the resources to the paths of their files in a directory, following a layout
+type Paths struct {
+	// Dir is the full absolute path of the directory in which the resources are stored
+	Dir string
+
+	// Layout is the layout of the resources in the directory
+	Layout *layout.Layout
+
+	// ClusterName is the (optional) name of the cluster from which the resources are exported
+	ClusterName string
+}
+
+// PathForResource returns the full absolute path of the given resource, for the given format
+func (p Paths) PathForResource(resource *openshift.Resource, format string) string {
+	fields := layout.Fields{
+		Cluster:   p.ClusterName,
+		Namespace: resource.Namespace,
+		Kind:      resource.Kind,
+		Group:     resource.GroupKind().Group,
+		Name:      resource.Name,
+	}
+	if resource.Object != nil {
+		if accessor, err := meta.Accessor(resource.Object); err == nil {
+			fields.Labels = accessor.GetLabels()
+		}
+	}
+
+	path := fmt.Sprintf("%s.%s", p.Layout.Path(fields), format)
+	return filepath.Join(p.Dir, filepath.FromSlash(path))
+}
+
+// ResourceFromPath returns a (minimalist) representation of the resource
+// stored at the given path.
+// Returns nil if no resource could be found at that path (if it does not match the layout,
+// or if it belongs to another cluster).
+// Note that the returned resource contains only a reference
+// (with kind - and API group, namespace and name), not the resource (content) itself.
+func (p Paths) ResourceFromPath(path string) *openshift.Resource {
+	if !strings.HasPrefix(path, p.Dir+"/") {
+		return nil
+	}
+
+	path = strings.TrimPrefix(path, p.Dir+"/")
+	path = strings.TrimSuffix(path, filepath.Ext(path))
+	fields, ok := p.Layout.Parse(filepath.ToSlash(path))
+	if !ok {
+		return nil
+	}
+
+	if p.Layout.HasVariable("cluster") && fields.Cluster != layout.Sanitize(p.ClusterName) {
+		// belongs to another cluster
+		return nil
+	}
+
+	namespacedName := fields.Name
+	if len(fields.Namespace) > 0 {
+		namespacedName = fmt.Sprintf("%s/%s", fields.Namespace, fields.Name)
+	}
+	return openshift.NewResourceForGroupKind(unversioned.GroupKind{Group: fields.Group, Kind: fields.Kind}, namespacedName)
+}
+
+// IsResourceOfKind returns true if the given resource is of the given (API group and) kind.
+// The API group is ignored if the layout does not use it.
+func (p Paths) IsResourceOfKind(resource *openshift.Resource, gk unversioned.GroupKind) bool {
+	if resource.Kind != gk.Kind {
+		return false
+	}
+	return !p.Layout.HasVariable("group") || resource.GroupKind().Group == gk.Group
+}
+
+// IndexKind returns the kind used in an Index for the given (API group and) kind:
+// the API group is ignored if the layout does not use it (see IsResourceOfKind)
+func (p Paths) IndexKind(gk unversioned.GroupKind) string {
+	if !p.Layout.HasVariable("group") {
+		return gk.Kind
+	}
+	return gk.String()
+}
+
+// WalkResources walks the FS and calls the given function
+// for each resource stored in the directory, with the path of the file
+// and a (minimalist) representation of the resource - see ResourceFromPath.
+// The sidecar files of the resources, the .git directory and the MetadataDir are ignored.
+func (p Paths) WalkResources(walkFn func(path string, resource *openshift.Resource) error) error {
+	return p.walkResources(nil, walkFn)
+}
+
+// walkResources is like WalkResources, but it also ignores the directories
+// for which the given skipDir function (if not nil) returns true
+func (p Paths) walkResources(skipDir func(path string) bool, walkFn func(path string, resource *openshift.Resource) error) error {
+	return filepath.Walk(p.Dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			if info.Name() == ".git" || info.Name() == MetadataDir || sidecar.IsSidecarDir(path) {
+				return filepath.SkipDir
+			}
+			if skipDir != nil && path != p.Dir && skipDir(path) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		resource := p.ResourceFromPath(path)
+		if resource == nil {
+			return nil
+		}
+		return walkFn(path, resource)
+	})
+}
+
+// SidecarDir returns the path of the directory containing
+// the sidecar files of the resource stored at the given path
+func SidecarDir(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + sidecar.DirSuffix
+}
+
+// ReadResourceFile reads the content of the resource stored at the given path,
+// with the payloads of its sidecar files (if any) joined back into it.
+func ReadResourceFile(path string) ([]byte, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := SidecarDir(path)
+	return sidecar.Join(content, strings.TrimPrefix(filepath.Ext(path), "."), func(name string) ([]byte, error) {
+		return ioutil.ReadFile(filepath.Join(dir, name))
+	})
+}
+
+// ContentHash returns the hash of the given content of a resource,
+// and of the given sidecar files (in any order).
+// It is made of the git blob OIDs of the files (see BlobsHash),
+// so that it can be compared with the files committed in a git repository without reading them.
+func ContentHash(content []byte, files []sidecar.File) string {
+	oids := map[string]string{}
+	for _, file := range files {
+		oids[file.Name] = gitobj.HashObject(gitobj.TypeBlob, file.Content).String()
+	}
+	return BlobsHash(gitobj.HashObject(gitobj.TypeBlob, content).String(), oids)
+}
+
+// BlobsHash returns the content hash of a resource (see ContentHash),
+// from the git blob OID of its file and the git blob OIDs of its sidecar files (per name), like
+// "<oid>" or "<oid> app.properties:<oid>"
+func BlobsHash(oid string, files map[string]string) string {
+	names := []string{}
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	hash := oid
+	for _, name := range names {
+		hash += fmt.Sprintf(" %s:%s", name, files[name])
+	}
+	return hash
+}
+
+// FileHash returns the content hash of the resource stored at the given path,
+// including its sidecar files (see ContentHash)
+func FileHash(path string) (string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	dir := SidecarDir(path)
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		// no sidecar files
+		return ContentHash(content, nil), nil
+	}
+	files := []sidecar.File{}
+	for _, info := range infos {
+		if info.IsDir() {
+			continue
+		}
+		fileContent, err := ioutil.ReadFile(filepath.Join(dir, info.Name()))
+		if err != nil {
+			return "", err
+		}
+		files = append(files, sidecar.File{Name: info.Name(), Content: fileContent})
+	}
+	return ContentHash(content, files), nil
+}
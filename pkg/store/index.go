@@ -0,0 +1,152 @@
+package store
+
+import (
+	"path/filepath"
+	"sync"
+)
+
+// Index is an in-memory index of the resources of a store:
+// for each kind (see Paths.IndexKind), the keys ("namespace/name" format) of the resources,
+// with the paths of their files and the hashes of their contents (see ContentHash).
+// An empty hash means that the content is unknown, and must be written again.
+// It is built the first time it is used (see Build),
+// and is then updated by the writes and deletes of the resources.
+// It is safe for concurrent use.
+type Index struct {
+	lock sync.RWMutex
+
+	// built is true once the index has been built
+	built bool
+
+	// files are the hashes of the files, per path, key and kind
+	files map[string]map[string]map[string]string
+}
+
+// NewIndex instantiates a new (not built yet) index
+func NewIndex() *Index {
+	return &Index{}
+}
+
+// Build builds the index if it has not been built yet, by calling the given function
+// with a function to add each (kind, key, path and hash) file to the index.
+func (i *Index) Build(build func(add func(kind, key, path, hash string)) error) error {
+	i.lock.RLock()
+	built := i.built
+	i.lock.RUnlock()
+	if built {
+		return nil
+	}
+
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	if i.built {
+		return nil
+	}
+
+	files := map[string]map[string]map[string]string{}
+	err := build(func(kind, key, path, hash string) {
+		addFile(files, kind, key, path, hash)
+	})
+	if err != nil {
+		return err
+	}
+
+	i.files = files
+	i.built = true
+	return nil
+}
+
+// Invalidate invalidates the index, when the files may have been changed
+// by something else than the resources of the store (a pull, a migration, ...).
+// It will be built again the next time it is used.
+func (i *Index) Invalidate() {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	i.built = false
+	i.files = nil
+}
+
+// Keys returns the keys of the indexed resources of the given kind
+func (i *Index) Keys(kind string) []string {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+	keys := []string{}
+	for key := range i.files[kind] {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// File returns the path and the content hash of the indexed file
+// of the resource of the given kind and key, in the given format
+// - or empty strings if there is none.
+func (i *Index) File(kind, key, format string) (string, string) {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+	for path, hash := range i.files[kind][key] {
+		if filepath.Ext(path) == "."+format {
+			return path, hash
+		}
+	}
+	return "", ""
+}
+
+// Add records the given file of the resource of the given kind and key (if the index has been built)
+func (i *Index) Add(kind, key, path, hash string) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	if !i.built {
+		return
+	}
+	addFile(i.files, kind, key, path, hash)
+}
+
+// Remove removes the given file of the resource of the given kind and key (if the index has been built)
+func (i *Index) Remove(kind, key, path string) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	if !i.built {
+		return
+	}
+
+	delete(i.files[kind][key], path)
+	if len(i.files[kind][key]) == 0 {
+		delete(i.files[kind], key)
+	}
+}
+
+// ForgetHashes forgets the content hashes of the given files,
+// for example if they could not be committed: they will be written again
+// the next time their resources are saved
+func (i *Index) ForgetHashes(paths ...string) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	if !i.built {
+		return
+	}
+
+	forget := map[string]bool{}
+	for _, path := range paths {
+		forget[path] = true
+	}
+	for _, keys := range i.files {
+		for _, files := range keys {
+			for path := range files {
+				if forget[path] {
+					files[path] = ""
+				}
+			}
+		}
+	}
+}
+
+// addFile adds the given file to the given index files
+func addFile(files map[string]map[string]map[string]string, kind, key, path, hash string) {
+	if _, ok := files[kind]; !ok {
+		files[kind] = map[string]map[string]string{}
+	}
+	if _, ok := files[kind][key]; !ok {
+		files[kind][key] = map[string]string{}
+	}
+	files[kind][key][path] = hash
+}
@@ -0,0 +1,39 @@
+package store
+
+import (
+	"time"
+)
+
+const (
+	// dailySnapshotFormat is the time format of the names of the daily snapshots
+	dailySnapshotFormat = "2006-01-02"
+
+	// snapshotFormat is the time format of the names of the more frequent snapshots
+	// (without colons, which are not allowed in the names of the git tags)
+	snapshotFormat = "2006-01-02T15-04Z"
+)
+
+// SnapshotName returns the name of the snapshot of the given period containing the given time
+// (the periods are aligned on multiples of the period since the zero time, in UTC):
+// "2016-06-01" for a daily period, or "2016-06-01T10-00Z" for a shorter period.
+func SnapshotName(t time.Time, period time.Duration) string {
+	format := snapshotFormat
+	if period%(24*time.Hour) == 0 {
+		format = dailySnapshotFormat
+	}
+	if period > 0 {
+		t = t.Truncate(period)
+	}
+	return t.UTC().Format(format)
+}
+
+// ParseSnapshotName returns the time of the snapshot with the given name (see SnapshotName)
+// - and false if it is not the name of a snapshot.
+func ParseSnapshotName(name string) (time.Time, bool) {
+	for _, format := range []string{dailySnapshotFormat, snapshotFormat} {
+		if t, err := time.Parse(format, name); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,113 @@
+package store
+
+import (
+	"io"
+	"time"
+
+	"github.com/vbehar/openshift-git/pkg/openshift"
+	"github.com/vbehar/openshift-git/pkg/sidecar"
+
+	"k8s.io/kubernetes/pkg/api/unversioned"
+)
+
+// Store is where the exported resources are stored:
+// a git repository (see git.Repository), or a plain directory (see DirectoryStore).
+// It is not safe for concurrent use, except for the functions
+// returned by KeyListFuncForGroupKind and KeyGetFuncForGroupKindAndFormat.
+type Store interface {
+	// String returns a description of the store, used in the logs
+	// (like the URL of the remote repository, or the path of the directory)
+	String() string
+
+	// Resource returns the given resource, stored in the given format (like YAML or JSON)
+	Resource(resource *openshift.Resource, format string) Resource
+
+	// NewBatch returns a new (empty) batch, to commit the changes of several resources together
+	NewBatch() Batch
+
+	// WalkResources calls the given function for each resource in the store,
+	// with the path of its file and a (minimalist) representation of the resource
+	// (with kind - and API group, namespace and name).
+	WalkResources(walkFn func(path string, resource *openshift.Resource) error) error
+
+	// IsResourceOfKind returns true if the given resource is of the given (API group and) kind.
+	// The API group is ignored if the layout of the store does not use it.
+	IsResourceOfKind(resource *openshift.Resource, gk unversioned.GroupKind) bool
+
+	// KeyListFuncForGroupKind returns a function that returns the keys ("namespace/name" format)
+	// of the stored resources of the given kind - see cache.KeyLister
+	KeyListFuncForGroupKind(gk unversioned.GroupKind) func() []string
+
+	// KeyGetFuncForGroupKindAndFormat returns a function that returns the stored resource
+	// of the given kind and format for the given key - and a boolean if it exists - see cache.KeyGetter
+	KeyGetFuncForGroupKindAndFormat(gk unversioned.GroupKind, format string) func(key string) (interface{}, bool, error)
+
+	// LoadResourceVersions returns the last resource versions (per kind)
+	// persisted with SaveResourceVersions for the given scope.
+	LoadResourceVersions(scope string) (map[string]string, error)
+
+	// SaveResourceVersions persists the given resource versions (per kind) for the given scope
+	SaveResourceVersions(scope string, versions map[string]string) error
+
+	// CreateSnapshot records a snapshot of the stored resources, created at the given time,
+	// for the given period (see SnapshotName).
+	// Returns the name of the snapshot, or an empty string if it already exists.
+	CreateSnapshot(t time.Time, period time.Duration) (string, error)
+
+	// PruneSnapshots deletes the snapshots created before the given time,
+	// and returns their names.
+	PruneSnapshots(before time.Time) ([]string, error)
+
+	// Pull retrieves the changes made by others (if the store is shared)
+	Pull() error
+
+	// Push publishes the committed changes (if the store is shared)
+	Push() error
+
+	// StopPush stops the push in progress (if any), which returns as soon as possible,
+	// and the failed pushes are not retried anymore. It is safe to call it concurrently with Push.
+	StopPush()
+
+	// CheckWritable returns an error if the store can't be written to
+	CheckWritable() error
+
+	// Close releases the store, once all the changes have been committed.
+	// It stops (and waits for) the push in progress, if any.
+	Close() error
+}
+
+// Resource is a resource in a Store.
+// It is written (between Open and Close) or deleted, and then committed
+// - either alone with Commit, or with other resources in a Batch.
+type Resource interface {
+	io.WriteCloser
+
+	// IsUnchanged returns true if the resource is already stored with the given content hash
+	// (see ContentHash) - so that it does not need to be written again.
+	IsUnchanged(hash string) bool
+
+	// Open opens the resource so that it can be written
+	Open() error
+
+	// WriteSidecarFiles writes the given sidecar files of the resource
+	WriteSidecarFiles(files []sidecar.File) error
+
+	// Delete deletes the resource (and its sidecar files)
+	Delete() error
+
+	// Commit commits the changes of the resource
+	Commit() error
+}
+
+// Batch is a set of changes on multiple resources, committed together
+type Batch interface {
+	// Add adds the changes of the given resource (of the same store) to the batch
+	Add(resource Resource) error
+
+	// Len returns the number of resources changed in the batch
+	Len() int
+
+	// Commit commits all the changes of the batch together, with the given title.
+	// The batch is then reset, and can be used for new changes.
+	Commit(title string) error
+}
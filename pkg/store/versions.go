@@ -0,0 +1,71 @@
+package store
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// ResourceVersionsFile is the name of the file in which the last resource versions are persisted
+const ResourceVersionsFile = "resource-versions.json"
+
+// resourceVersions is the content of a ResourceVersionsFile
+type resourceVersions struct {
+	// Scope identifies what has been watched (the cluster, namespace, selector, ...):
+	// the versions are only valid for the same scope
+	Scope string `json:"scope"`
+
+	// Versions are the last resource versions, per (API group and) kind
+	Versions map[string]string `json:"versions"`
+}
+
+// LoadResourceVersions returns the last resource versions (per kind)
+// persisted in the file at the given path with SaveResourceVersions, for the given scope.
+// Returns an empty map if there are none, or if they were saved for another scope.
+func LoadResourceVersions(path, scope string) (map[string]string, error) {
+	versions := map[string]string{}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return versions, nil
+		}
+		return nil, err
+	}
+
+	content := &resourceVersions{}
+	if err := json.Unmarshal(data, content); err != nil {
+		return nil, err
+	}
+	if content.Scope != scope {
+		return versions, nil
+	}
+	for kind, version := range content.Versions {
+		versions[kind] = version
+	}
+	return versions, nil
+}
+
+// SaveResourceVersions persists the given resource versions (per kind) for the given scope,
+// in the file at the given path.
+func SaveResourceVersions(path, scope string, versions map[string]string) error {
+	data, err := json.Marshal(&resourceVersions{
+		Scope:    scope,
+		Versions: versions,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	// write to a temp file first, so that the file is never left half-written
+	tmpPath := path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}